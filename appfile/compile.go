@@ -2,20 +2,30 @@ package appfile
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"log"
+	"net/url"
 	"os"
 	"path/filepath"
+	"reflect"
+	"runtime"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/hashicorp/go-getter"
 	"github.com/hashicorp/go-multierror"
 	"github.com/hashicorp/otto/helper/oneline"
+	"github.com/hashicorp/otto/helper/uuid"
 	"github.com/hashicorp/terraform/dag"
+	"github.com/mitchellh/copystructure"
 )
 
 const (
@@ -28,6 +38,14 @@ const (
 	CompileDepsFolder      = "deps"
 	CompileImportsFolder   = "deps"
 	CompileVersionFilename = "version"
+
+	// DefaultMaxParallelImports is the default for
+	// CompileOpts.MaxParallelImports.
+	DefaultMaxParallelImports = 8
+
+	// DefaultImportCacheSize is the default for
+	// CompileOpts.ImportCacheSize.
+	DefaultImportCacheSize = 512
 )
 
 // Compiled represents a "Compiled" Appfile. A compiled Appfile is one
@@ -45,10 +63,66 @@ type Compiled struct {
 	// Graph is the DAG that has all the dependencies. This is already
 	// verified to have no cycles. Each vertex is a *CompiledGraphVertex.
 	Graph *dag.AcyclicGraph
+
+	// Declared are the dependencies and imports that the root Appfile
+	// declared itself when it was compiled, with Profile applied but
+	// before its imports were merged. This is used by LoadCompiledFor to
+	// tell if the Appfile changed. It is nil for Appfiles compiled by
+	// older versions.
+	Declared []string
+
+	// Profile is the profile that was applied when compiling, from
+	// CompileOpts.Profile. It is empty if no profile was applied.
+	Profile string
+}
+
+// ValidateOpts are the options for Compiled.ValidateWithOpts.
+type ValidateOpts struct {
+	// FailFast, if true, stops validation at the first error and returns
+	// only that error. By default, every file is validated and all the
+	// errors are returned.
+	FailFast bool
+
+	// Parallelism is the maximum number of files that are validated at
+	// the same time. If this is zero, the number of CPUs is used.
+	Parallelism int
+
+	// Strict, if true, treats warnings as errors.
+	Strict bool
 }
 
 func (c *Compiled) Validate() error {
-	var result error
+	return c.ValidateWithOpts(&ValidateOpts{})
+}
+
+// ValidateWithOpts is like Validate but with options to control how
+// the validation is done.
+func (c *Compiled) ValidateWithOpts(opts *ValidateOpts) error {
+	results := c.ValidateResults(opts)
+	if opts.FailFast {
+		for _, r := range results {
+			if r.fails(opts.Strict) {
+				return r
+			}
+		}
+
+		return nil
+	}
+
+	return results.Err(opts.Strict)
+}
+
+// ValidateResults validates the compiled Appfile like ValidateWithOpts,
+// but returns all the problems found, tagged with their severity. If
+// FailFast is set, this stops at the first problem that fails validation.
+func (c *Compiled) ValidateResults(opts *ValidateOpts) ValidationResults {
+	var result ValidationResults
+	fail := func(err error) {
+		result = append(result, &ValidationResult{
+			Severity: SeverityError,
+			Err:      err,
+		})
+	}
 
 	// First validate that there are no cycles in the dependency graph
 	if cycles := c.Graph.Cycles(); len(cycles) > 0 {
@@ -58,28 +132,125 @@ func (c *Compiled) Validate() error {
 				vertices[i] = dag.VertexName(v)
 			}
 
-			result = multierror.Append(result, fmt.Errorf(
+			fail(fmt.Errorf(
 				"Dependency cycle: %s", strings.Join(vertices, ", ")))
+			if opts.FailFast {
+				return result
+			}
+		}
+	} else if err := c.validateReachable(); err != nil {
+		fail(err)
+		if opts.FailFast {
+			return result
 		}
 	}
 
-	// Validate all the files
-	var errLock sync.Mutex
-	c.Graph.Walk(func(raw dag.Vertex) error {
-		v := raw.(*CompiledGraphVertex)
-		if err := v.File.Validate(); err != nil {
-			errLock.Lock()
-			defer errLock.Unlock()
+	// Validate all the files with a pool of workers. Each worker keeps
+	// its own results so that they only need to be merged at the end.
+	parallel := opts.Parallelism
+	if parallel <= 0 {
+		parallel = runtime.NumCPU()
+	}
+
+	var wg sync.WaitGroup
+	var failOnce sync.Once
+	failCh := make(chan struct{})
+	vertexCh := make(chan *CompiledGraphVertex)
+	results := make([]ValidationResults, parallel)
+	for i := 0; i < parallel; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for v := range vertexCh {
+				for _, r := range validateVertex(v) {
+					if opts.FailFast && r.fails(opts.Strict) {
+						failOnce.Do(func() {
+							results[i] = append(results[i], r)
+							close(failCh)
+						})
+
+						return
+					}
 
-			if s := v.File.Source; s != "" {
-				err = multierror.Prefix(err, fmt.Sprintf("Dependency %s:", s))
+					results[i] = append(results[i], r)
+				}
 			}
+		}(i)
+	}
 
-			result = multierror.Append(result, err)
+Feed:
+	for _, raw := range c.Graph.Vertices() {
+		select {
+		case vertexCh <- raw.(*CompiledGraphVertex):
+		case <-failCh:
+			break Feed
 		}
+	}
+	close(vertexCh)
+	wg.Wait()
 
-		return nil
-	})
+	for _, rs := range results {
+		result = append(result, rs...)
+	}
+
+	return result
+}
+
+// validateVertex validates the File of a single vertex, loading it
+// first if necessary.
+func validateVertex(v *CompiledGraphVertex) ValidationResults {
+	f, err := v.LoadFile()
+	if err != nil {
+		return ValidationResults{&ValidationResult{
+			Severity: SeverityError,
+			Err:      err,
+		}}
+	}
+
+	results := f.ValidateResults()
+	if s := f.Source; s != "" {
+		for _, r := range results {
+			r.Err = multierror.Prefix(r.Err, fmt.Sprintf("Dependency %s:", s))
+		}
+	}
+
+	return results
+}
+
+// validateReachable verifies that every vertex in the graph is reachable
+// from the root. Every vertex should be a dependency of the root, so any
+// others point to a bug in building the graph.
+func (c *Compiled) validateReachable() error {
+	root, err := c.Graph.Root()
+	if err != nil {
+		// If there are unreachable vertices there will be multiple
+		// roots, so find the root that is our own Appfile.
+		if c.File == nil || c.File.Application == nil {
+			return err
+		}
+
+		v := c.vertex(c.File.Application.Name)
+		if v == nil {
+			return err
+		}
+
+		root = v
+	}
+
+	reachable, err := c.Graph.Ancestors(root)
+	if err != nil {
+		return err
+	}
+	reachable.Add(root)
+
+	var result error
+	for _, v := range c.Graph.Vertices() {
+		if !reachable.Include(v) {
+			result = multierror.Append(result, fmt.Errorf(
+				"Dependency '%s' isn't reachable from the root application '%s'",
+				dag.VertexName(v), dag.VertexName(root)))
+		}
+	}
 
 	return result
 }
@@ -93,6 +264,192 @@ func (c *Compiled) String() string {
 	return buf.String()
 }
 
+// Subgraph returns a new Compiled containing only the application with
+// the given name and all of its transitive dependencies. The File of the
+// result is the File of that application.
+func (c *Compiled) Subgraph(name string) (*Compiled, error) {
+	root := c.vertex(name)
+	if root == nil {
+		return nil, fmt.Errorf(
+			"Application '%s' not found in the dependency graph", name)
+	}
+
+	// Edges point from an application to its dependencies, so the
+	// "ancestors" in the graph are all of the transitive dependencies.
+	deps, err := c.Graph.Ancestors(root)
+	if err != nil {
+		return nil, err
+	}
+	deps.Add(root)
+
+	graph := new(dag.AcyclicGraph)
+	for _, v := range c.Graph.Vertices() {
+		if deps.Include(v) {
+			graph.Add(v)
+		}
+	}
+	for _, e := range c.Graph.Edges() {
+		if deps.Include(e.Source()) && deps.Include(e.Target()) {
+			graph.Connect(e)
+		}
+	}
+
+	return &Compiled{File: root.File, Graph: graph}, nil
+}
+
+// IDs returns a mapping of application name to Otto ID for every
+// application in the graph.
+func (c *Compiled) IDs() map[string]string {
+	result := make(map[string]string)
+	for _, raw := range c.Graph.Vertices() {
+		v := raw.(*CompiledGraphVertex)
+		if v.File != nil {
+			result[v.Name()] = v.File.ID
+		}
+	}
+
+	return result
+}
+
+// Dependents returns the applications that depend on the application
+// with the given name, sorted by name. If transitive is true, this
+// includes applications that depend on it indirectly as well.
+//
+// If there is no application with the given name, nil is returned.
+func (c *Compiled) Dependents(name string, transitive bool) []*CompiledGraphVertex {
+	target := c.vertex(name)
+	if target == nil {
+		return nil
+	}
+
+	// Edges point from an application to its dependencies, so the
+	// dependents are the vertices walking up the edges.
+	set := c.Graph.UpEdges(target)
+	if transitive {
+		var err error
+		set, err = c.Graph.Descendents(target)
+		if err != nil {
+			// This can only fail if the walk callback fails, which ours
+			// never does.
+			panic(err)
+		}
+	}
+
+	result := make([]*CompiledGraphVertex, 0, set.Len())
+	for _, raw := range set.List() {
+		result = append(result, raw.(*CompiledGraphVertex))
+	}
+	sort.Sort(vertexByName(result))
+	return result
+}
+
+// WhyDepended returns every path of dependencies from the root application
+// to the application with the given name, explaining why it is in the
+// graph. Each path starts with the root and ends with the application. The
+// paths are sorted by the names of the applications along them.
+//
+// If there is no application with the given name, nil is returned.
+func (c *Compiled) WhyDepended(name string) [][]*CompiledGraphVertex {
+	target := c.vertex(name)
+	if target == nil {
+		return nil
+	}
+	raw, err := c.Graph.Root()
+	if err != nil {
+		return nil
+	}
+
+	// The graph is acyclic, so a depth-first walk of the dependencies
+	// from the root finds every path without revisiting a path.
+	var result [][]*CompiledGraphVertex
+	var walk func(path []*CompiledGraphVertex)
+	walk = func(path []*CompiledGraphVertex) {
+		current := path[len(path)-1]
+		if current == target {
+			result = append(result, append([]*CompiledGraphVertex(nil), path...))
+			return
+		}
+
+		for _, dep := range c.Graph.DownEdges(current).List() {
+			walk(append(path, dep.(*CompiledGraphVertex)))
+		}
+	}
+	walk([]*CompiledGraphVertex{raw.(*CompiledGraphVertex)})
+
+	sort.Sort(pathByNames(result))
+	return result
+}
+
+// Unused returns the dependencies declared by the root application that
+// don't contribute to its resolved configuration, sorted by name, so that
+// they can be removed from the Appfile.
+//
+// Nothing is merged into the root from its dependencies: a dependency
+// only contributes by being in the dependency graph. So this is
+// conservative and only returns dependencies that the root declares but
+// that are also dependencies of another one of its dependencies. Removing
+// them from the root's Appfile leaves the dependency graph unchanged.
+func (c *Compiled) Unused() []*CompiledGraphVertex {
+	raw, err := c.Graph.Root()
+	if err != nil {
+		return nil
+	}
+	root := raw.(*CompiledGraphVertex)
+
+	direct := c.Graph.DownEdges(root).List()
+	result := make([]*CompiledGraphVertex, 0)
+	for _, dep := range direct {
+		for _, other := range direct {
+			if other == dep {
+				continue
+			}
+
+			// Edges point to dependencies, so the ancestors of a
+			// dependency are all of its transitive dependencies.
+			deps, err := c.Graph.Ancestors(other)
+			if err != nil {
+				// This can only fail if the walk callback fails, which
+				// ours never does.
+				panic(err)
+			}
+			if deps.Include(dep) {
+				result = append(result, dep.(*CompiledGraphVertex))
+				break
+			}
+		}
+	}
+
+	sort.Sort(vertexByName(result))
+	return result
+}
+
+// FilterByLabel returns the applications in the graph that have the label
+// with the given key and value, sorted by name.
+func (c *Compiled) FilterByLabel(key, value string) []*CompiledGraphVertex {
+	result := make([]*CompiledGraphVertex, 0)
+	for _, raw := range c.Graph.Vertices() {
+		v := raw.(*CompiledGraphVertex)
+		if actual, ok := v.Labels[key]; ok && actual == value {
+			result = append(result, v)
+		}
+	}
+
+	sort.Sort(vertexByName(result))
+	return result
+}
+
+// vertex returns the vertex in the graph with the given name, or nil
+// if there isn't one.
+func (c *Compiled) vertex(name string) *CompiledGraphVertex {
+	for _, raw := range c.Graph.Vertices() {
+		if v := raw.(*CompiledGraphVertex); v.Name() == name {
+			return v
+		}
+	}
+
+	return nil
+}
+
 // CompiledGraphVertex is the type of the vertex within the Graph of Compiled.
 type CompiledGraphVertex struct {
 	// File is the raw Appfile that this represents
@@ -103,14 +460,87 @@ type CompiledGraphVertex struct {
 	// this value).
 	Dir string
 
+	// License is the SPDX identifier of the license detected in the
+	// directory of the Appfile when this dependency was fetched, or
+	// LicenseUnknown if none was found. This is empty for the root.
+	License string
+
+	// Labels are the labels of the application from its Appfile. They're
+	// kept here as well so that they can be filtered on without loading
+	// the File, see LoadCompiledLazy.
+	Labels map[string]string
+
 	// Don't use this outside of this package.
 	NameValue string
+
+	// lazy is set if this vertex was loaded with LoadCompiledLazy and
+	// holds the File until it is loaded with LoadFile.
+	lazy *lazyFile
+}
+
+// lazyFile is the raw JSON of a File that hasn't been decoded yet.
+type lazyFile struct {
+	raw  json.RawMessage
+	once sync.Once
+	err  error
 }
 
 func (v *CompiledGraphVertex) Name() string {
 	return v.NameValue
 }
 
+// LoadFile returns the File for this vertex. If the Compiled was loaded
+// with LoadCompiledLazy, File is nil until this is called, and this
+// decodes it. Otherwise, this returns File as-is.
+func (v *CompiledGraphVertex) LoadFile() (*File, error) {
+	if v.lazy == nil {
+		return v.File, nil
+	}
+
+	v.lazy.once.Do(func() {
+		if err := json.Unmarshal(v.lazy.raw, &v.File); err != nil {
+			v.lazy.err = fmt.Errorf(
+				"Error loading Appfile for %s: %s", v.Name(), err)
+		}
+
+		// We don't need the raw data anymore
+		v.lazy.raw = nil
+	})
+
+	return v.File, v.lazy.err
+}
+
+// vertexByName implements sort.Interface to sort vertices by name.
+type vertexByName []*CompiledGraphVertex
+
+func (v vertexByName) Len() int           { return len(v) }
+func (v vertexByName) Swap(i, j int)      { v[i], v[j] = v[j], v[i] }
+func (v vertexByName) Less(i, j int) bool { return v[i].Name() < v[j].Name() }
+
+// pathByNames implements sort.Interface to sort paths of vertices by the
+// names of the vertices along them.
+type pathByNames [][]*CompiledGraphVertex
+
+func (p pathByNames) Len() int      { return len(p) }
+func (p pathByNames) Swap(i, j int) { p[i], p[j] = p[j], p[i] }
+func (p pathByNames) Less(i, j int) bool {
+	for k := 0; k < len(p[i]) && k < len(p[j]); k++ {
+		if a, b := p[i][k].Name(), p[j][k].Name(); a != b {
+			return a < b
+		}
+	}
+
+	return len(p[i]) < len(p[j])
+}
+
+// dependencyBySource implements sort.Interface to sort dependencies by
+// source.
+type dependencyBySource []*Dependency
+
+func (d dependencyBySource) Len() int           { return len(d) }
+func (d dependencyBySource) Swap(i, j int)      { d[i], d[j] = d[j], d[i] }
+func (d dependencyBySource) Less(i, j int) bool { return d[i].Source < d[j].Source }
+
 // CompileOpts are the options for compilation.
 type CompileOpts struct {
 	// Dir is the directory where all the compiled data will be stored.
@@ -123,32 +553,330 @@ type CompileOpts struct {
 	// an opportunity to modify the Appfile prior to full compilation.
 	//
 	// The File given will already have all the imports merged.
+	//
+	// This is only called for dependencies, unless LoadRoot is set.
 	Loader func(f *File, dir string) (*File, error)
 
+	// LoadRoot, if true, also calls Loader for the root Appfile given to
+	// Compile or CompileAndValidate, so that the root and its dependencies
+	// are preprocessed the same way. As with dependencies, it is called
+	// once the imports are merged, and dir is the directory of the root
+	// Appfile, or the current working directory if the File has no Path.
+	//
+	// MinCompile never calls the Loader, since loaders may use it to merge
+	// the imports of the Appfile they're loading.
+	LoadRoot bool
+
 	// Callback is an optional way to receive notifications of events
 	// during the compilation process. The CompileEvent argument should be
 	// type switched to determine what it is.
 	Callback func(CompileEvent)
+
+	// Events is an optional channel to receive notifications of events
+	// during the compilation process. This is an alternative to Callback
+	// for consumers that don't want to block compilation: events are sent
+	// without blocking and are dropped if the channel is full, so it
+	// should be buffered. The compiler never closes this channel.
+	//
+	// Both Callback and Events can be set, in which case both receive
+	// every event (subject to Events being full).
+	Events chan<- CompileEvent
+
+	// Logger is an optional logger for the debug output of the compiler.
+	// If this is nil, the global logger from the standard "log" package
+	// is used.
+	Logger *log.Logger
+
+	// MaxTotalBytes is the maximum total size in bytes of all the
+	// dependencies and imports fetched during a single compilation. If
+	// this is exceeded, compilation is aborted with an error. If this is
+	// zero, there is no limit.
+	MaxTotalBytes int64
+
+	// AppfileFilename and AppfileDir are used to locate the Appfile within
+	// fetched dependencies and imports that use a non-standard layout.
+	// AppfileDir is relative to the root of the fetched source. The
+	// configured location is tried first, falling back to "Appfile" in
+	// the root of the source.
+	AppfileFilename string
+	AppfileDir      string
+
+	// ContentAddressable, if true, stores fetched dependencies and
+	// imports by the hash of their contents so that identical contents
+	// fetched from multiple sources are only stored once. See
+	// ContentStorage.
+	ContentAddressable bool
+
+	// EventWriter, if set, receives every compilation event encoded as
+	// a single line of JSON. This is a stable format for consumers that
+	// can't use Callback or Events. See CompileEventJSON.
+	EventWriter io.Writer
+
+	// WebhookURL, if set, is a URL that every compilation event is POSTed
+	// to as a JSON object, encoded like the lines written to EventWriter.
+	// Events are posted in order in the background, so this never blocks
+	// compilation. Events that can't be delivered are logged rather than
+	// failing the compilation. Compiler.Close waits for the queued events
+	// to be posted.
+	WebhookURL string
+
+	// IDFilename, if set, is the path relative to each Appfile where its
+	// Otto ID is stored, rather than IDFile. See File.IDFilename.
+	IDFilename string
+
+	// IDFromGitRemote, if true, recovers the Otto ID of the Appfile
+	// being compiled from the default branch of the "origin" remote of
+	// its Git repository if the ID file is missing from the working copy,
+	// rather than generating a new ID. This is for when the ID file was
+	// committed but is missing locally, since a new ID would break the
+	// tracking of deployed applications. The recovered ID file is written
+	// next to the Appfile and a CompileEventWarning is sent.
+	//
+	// The branch is fetched into a temporary ref that is deleted
+	// afterwards, so FETCH_HEAD and the remote-tracking branches of the
+	// repository are left as they were. This requires Git 2.29 or later.
+	IDFromGitRemote bool
+
+	// AllowMissingDepID, if true, allows dependencies that don't have an
+	// Otto ID yet. A temporary ID is used for them instead, which changes
+	// on every compilation, and a CompileEventWarning is sent. This
+	// should only be used for development.
+	AllowMissingDepID bool
+
+	// AllowMissingLocalDepID is like AllowMissingDepID, but only applies
+	// to dependencies on the local filesystem. Dependencies from any other
+	// source still must have an Otto ID. This is useful for working on
+	// multiple applications in one checkout before they are published.
+	AllowMissingLocalDepID bool
+
+	// StrictValidation, if true, treats validation warnings as errors
+	// so that compilation fails on them. This includes dependencies
+	// whose declared infrastructure is overridden by the root. By
+	// default, warnings are sent as CompileEventWarning.
+	StrictValidation bool
+
+	// Tracer, if set, is used to start spans for the compilation and
+	// each of its phases. See CompileTracer and CompileContext.
+	Tracer CompileTracer
+
+	// Metrics, if set, receives metrics about compilations, such as the
+	// number of dependencies fetched and the duration of each phase. See
+	// CompileMetrics for the metrics that are sent.
+	Metrics CompileMetrics
+
+	// TraversalOrder is the order that the dependency graph is traversed
+	// when loading dependencies. This determines the order that
+	// dependencies are fetched and events are sent. The default is
+	// TraversalDFS.
+	TraversalOrder TraversalOrder
+
+	// Update, if true, downloads every dependency and import again even
+	// if it is already stored in the compilation directory. By default,
+	// a stored copy is reused.
+	Update bool
+
+	// Profile, if set, is the name of the profile to apply to the Appfile
+	// being compiled once its imports are merged, such as "staging" or
+	// "production". The Appfile must define the profile. Dependencies
+	// that define a profile with the same name have it applied too, and
+	// dependencies that don't are compiled as-is. See File.ApplyProfile.
+	Profile string
+
+	// ActiveTags are the tags of the optional dependencies to compile,
+	// such as "prod". A dependency with tags is only compiled if at least
+	// one of them is active, and is skipped otherwise. Dependencies
+	// without tags are always compiled. See Dependency.Tags.
+	ActiveTags []string
+
+	// SecretResolver, if set, resolves the references to secrets in Vault
+	// in the configuration of customizations and foundations, such as
+	// "vault:secret/api#token", once the imports and profile are merged.
+	// The secrets are then part of the compiled Appfile. If this is nil,
+	// the references are left as-is and a CompileEventWarning is sent,
+	// so secrets are never in the compiled Appfile unless resolved. See
+	// SecretRefPrefix.
+	SecretResolver SecretResolver
+
+	// MaxParallelImports is the maximum number of imports that are
+	// downloaded and parsed at the same time. This is enforced across all
+	// the imports of every Appfile being compiled by the Compiler,
+	// including nested imports, and no goroutine is started for an import
+	// until it can be loaded. If this is zero, DefaultMaxParallelImports
+	// is used.
+	MaxParallelImports int
+
+	// ImportCacheTTL is how long a loaded import is cached in memory by
+	// the Compiler and reused by later compilations. Once an import is
+	// older than this, it is fetched again the next time it is used. If
+	// this is zero, cached imports never expire. This is useful for
+	// long-lived Compilers so that changes to imports are picked up.
+	ImportCacheTTL time.Duration
+
+	// ImportCacheSize is the maximum number of loaded imports that are
+	// cached in memory by the Compiler. When the cache is full, the
+	// least recently used import is evicted and is loaded again the next
+	// time it is used. If this is zero, DefaultImportCacheSize is used.
+	ImportCacheSize int
+
+	// Detectors are the detectors used to turn the sources of imports
+	// and dependencies into URLs that can be fetched. If this is nil,
+	// the default detectors from go-getter are used.
+	Detectors []getter.Detector
+
+	// Getters are the getters used to download imports and dependencies,
+	// keyed by the scheme or forced getter ("hg::", for example) of the
+	// sources they download. If this is nil, DefaultGetters is used.
+	Getters map[string]getter.Getter
+
+	// SharedDepsDir, if set, is a read-only directory of dependencies
+	// that were downloaded ahead of time, such as a cache shared by every
+	// user and project on a build host. It is checked for a dependency
+	// before the dependencies stored in Dir and before downloading it.
+	// Dependencies that aren't in it are still downloaded into Dir, and
+	// nothing is ever written to it.
+	//
+	// It has the same layout as the CompileDepsFolder of a compilation
+	// directory, so it can be populated by compiling the Appfiles that
+	// use it with a separate Compiler and copying or pointing at that
+	// folder. ContentAddressable must be the same for both Compilers.
+	// The shared copies aren't used if Update is set.
+	SharedDepsDir string
+
+	// RemoveOnClose, if true, removes the directories where dependencies
+	// and imports are stored when Compiler.Close is called. Compiled
+	// Appfiles refer to the dependencies in these directories, so this
+	// should only be set if the compiled result isn't used afterwards.
+	RemoveOnClose bool
+
+	// VertexHook, if set, is called once for every application in the
+	// dependency graph, including the root, after its Appfile is loaded
+	// and its imports are merged but before it is added to the graph.
+	// It can modify the vertex. If it returns an error, compilation is
+	// aborted.
+	VertexHook func(v *CompiledGraphVertex) error
 }
 
+// TraversalOrder is the order that dependencies are loaded in.
+type TraversalOrder byte
+
+const (
+	// TraversalDFS loads dependencies depth-first, in the order they're
+	// declared. The order of loading is only stable as long as the
+	// declaration order in every Appfile is.
+	TraversalDFS TraversalOrder = iota
+
+	// TraversalBFS loads dependencies breadth-first, and loads the
+	// dependencies of each Appfile sorted by source. This gives the same
+	// order regardless of the declaration order.
+	TraversalBFS
+)
+
 // Compiler is responsible for compiling Appfiles. For each instance
 // of the compiler, the directory where Appfile data is stored is cleared
 // and reloaded.
 //
 // Multiple calls to Compile can be made with a single Appfile and the
-// dependencies won't be reloaded.
+// dependencies won't be reloaded. Compile is also safe to call
+// concurrently with different Appfiles, in which case the imports and
+// dependencies are shared between them. The same *File must not be
+// compiled concurrently, since compilation modifies it.
+//
+// Some state is per compilation directory rather than per compilation,
+// however. The compiled output reflects whichever compilation finished
+// last, and Stats and MaxTotalBytes cover all the compilations that
+// overlap.
 type Compiler struct {
 	opts          *CompileOpts
+	getterPool    sync.Pool
 	depStorage    getter.Storage
-	importCache   map[string]*File
+	sharedStorage getter.Storage
+	importCache   *importLRU
 	importLock    sync.Mutex
 	importStorage getter.Storage
+	importSem     chan struct{}
+	totalBytes    int64
+	totalLock     sync.Mutex
+	stats         CompileStats
+	statsLock     sync.Mutex
+	eventLock     sync.Mutex
+	webhook       webhook
+	detectCache   map[detectKey]string
+	detectLock    sync.Mutex
+	fetchLocks    map[string]*sync.Mutex
+	fetchLock     sync.Mutex
+	running       int
+	runLock       sync.Mutex
+	writeLock     sync.Mutex
+}
+
+// detectKey is the key for the cache of getter.Detect results.
+type detectKey struct {
+	Source string
+	Pwd    string
+}
+
+// CompileStats are statistics about the dependencies and imports loaded
+// by a Compiler. See Compiler.Stats.
+type CompileStats struct {
+	// DepsFetched and ImportsFetched are the number of dependencies and
+	// imports that were downloaded during the last compilation.
+	DepsFetched    int
+	ImportsFetched int
+
+	// DepsCached and ImportsCached are the number of dependencies and
+	// imports that were referenced again during the last compilation
+	// and reused without being downloaded again.
+	DepsCached    int
+	ImportsCached int
+
+	// NetworkUsed is true if any of the dependencies and imports that
+	// were downloaded during the last compilation came from a source
+	// that isn't on the local filesystem. If this is false, everything
+	// was either local or already stored, so compiling again doesn't
+	// need network access unless CompileOpts.Update is set.
+	NetworkUsed bool
+
+	// DiskUsage is the total size in bytes of the dependencies and
+	// imports stored in the compilation directory.
+	DiskUsage int64
+}
+
+// CompileError is the error returned by Compile when loading or
+// validating the dependencies fails. It wraps the typed errors for
+// dependencies, such as DependencyFetchError. Partial is the graph as far as it
+// was built before the error, so that tooling can show what succeeded.
+// It must not be used as a complete compiled Appfile.
+type CompileError struct {
+	Partial *Compiled
+	Err     error
+}
+
+func (e *CompileError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *CompileError) Unwrap() error {
+	return e.Err
 }
 
 // CompileEvent is a potential event that a Callback can receive during
 // Compilation.
 type CompileEvent interface{}
 
+// CompileEventStart is the event that is called at the very beginning of
+// a compilation, before anything is loaded.
+type CompileEventStart struct {
+	// Name is the name of the root application. This is empty if the
+	// application is only set by an import, since imports aren't loaded
+	// yet when this is sent.
+	Name string
+
+	// Fresh is true if there is no previous compilation to reuse stored
+	// dependencies and imports from, or if Update is set so that they're
+	// all fetched again.
+	Fresh bool
+}
+
 // CompileEventDep is the event that is called when a dependency is
 // being loaded.
 type CompileEventDep struct {
@@ -161,70 +889,418 @@ type CompileEventImport struct {
 	Source string
 }
 
-// LoadCompiled loads and verifies a compiled Appfile (*Compiled) from
-// disk.
-func LoadCompiled(dir string) (*Compiled, error) {
-	// Check the version
-	vsnStr, err := oneline.Read(filepath.Join(dir, CompileVersionFilename))
-	if err != nil {
-		return nil, err
-	}
-	vsn, err := strconv.ParseInt(vsnStr, 0, 0)
-	if err != nil {
-		return nil, err
+// CompileEventPlan is the event that is called with the number of
+// dependencies and imports that are known to need loading, so that
+// progress can be shown. Dependencies are only discovered as they're
+// loaded, so this is first sent with the dependencies and imports of the
+// root Appfile before anything is fetched, and then sent again with an
+// updated TotalDeps whenever more dependencies are discovered.
+type CompileEventPlan struct {
+	// DirectDeps and Imports are the number of dependencies and imports
+	// of the root Appfile.
+	DirectDeps int
+	Imports    int
+
+	// TotalDeps is the number of dependencies discovered so far,
+	// including the direct dependencies.
+	TotalDeps int
+}
+
+// CompileEventWarning is the event that is called when there is something
+// the user should be warned about that doesn't prevent compilation.
+type CompileEventWarning struct {
+	Source  string
+	Message string
+}
+
+// CompileEventFinish is the event that is called at the very end of a
+// compilation that succeeded.
+type CompileEventFinish struct {
+	// Name is the name of the root application.
+	Name string
+
+	// Duration is how long the compilation took.
+	Duration time.Duration
+}
+
+// CompileEventError is the event that is called at the very end of a
+// compilation that failed, instead of CompileEventFinish.
+type CompileEventError struct {
+	Err error
+}
+
+// Stats returns statistics about the last compilation with this
+// Compiler, along with the current disk usage of the stored dependencies
+// and imports.
+func (c *Compiler) Stats() (*CompileStats, error) {
+	c.statsLock.Lock()
+	result := c.stats
+	c.statsLock.Unlock()
+
+	// The folders may be the same, so only count each once
+	dirs := map[string]struct{}{
+		filepath.Join(c.opts.Dir, CompileDepsFolder):    struct{}{},
+		filepath.Join(c.opts.Dir, CompileImportsFolder): struct{}{},
 	}
+	for dir := range dirs {
+		size, err := diskUsage(dir)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
 
-	// If the version is too new, then we can't handle it
-	if vsn > CompileVersion {
-		return nil, fmt.Errorf(
-			"The Appfile for this enviroment was compiled with a newer version\n" +
-				"of Otto. Otto can't load this environment. You can recompile this\n" +
-				"environment to this version of Otto with `otto compile`.")
+		result.DiskUsage += size
 	}
 
-	f, err := os.Open(filepath.Join(dir, CompileFilename))
-	if err != nil {
-		return nil, err
+	return &result, nil
+}
+
+// Close releases the resources held by the compiler, such as the cache
+// of loaded imports. If RemoveOnClose is set, the stored dependencies
+// and imports are removed as well.
+//
+// This must not be called while a compilation is running. The Compiler
+// can still be used afterwards, but will have to load everything again.
+func (c *Compiler) Close() error {
+	c.flushWebhook()
+	c.resetCaches()
+
+	if !c.opts.RemoveOnClose {
+		return nil
 	}
-	defer f.Close()
 
-	var c Compiled
-	dec := json.NewDecoder(f)
-	if err := dec.Decode(&c); err != nil {
-		return nil, err
+	for _, dir := range c.cachePaths() {
+		c.logf("[DEBUG] removing compiler storage: %s", dir)
+		if err := os.RemoveAll(dir); err != nil {
+			return err
+		}
 	}
 
-	return &c, nil
+	return nil
 }
 
-// NewCompiler initializes a compiler with the given options.
-func NewCompiler(opts *CompileOpts) (*Compiler, error) {
-	// Create the directory if it doesn't already exist
-	if err := os.MkdirAll(opts.Dir, 0755); err != nil {
-		return nil, err
+// resetCaches clears the in-memory caches of imports, detected sources
+// and fetch locks.
+func (c *Compiler) resetCaches() {
+	c.importLock.Lock()
+	c.importCache = newImportLRU(c.importCache.size)
+	c.importLock.Unlock()
+
+	c.detectLock.Lock()
+	c.detectCache = nil
+	c.detectLock.Unlock()
+
+	c.fetchLock.Lock()
+	c.fetchLocks = nil
+	c.fetchLock.Unlock()
+}
+
+// detect is a memoized version of getter.Detect with the configured
+// detectors, so that each unique source is only detected once.
+func (c *Compiler) detect(src, pwd string) (string, error) {
+	key := detectKey{Source: src, Pwd: pwd}
+
+	c.detectLock.Lock()
+	defer c.detectLock.Unlock()
+	if result, ok := c.detectCache[key]; ok {
+		return result, nil
 	}
 
-	// Setup our result
-	c := &Compiler{opts: opts}
+	detectors := c.opts.Detectors
+	if detectors == nil {
+		detectors = getter.Detectors
+	}
 
-	// Setup our import storage and locks
-	c.importCache = make(map[string]*File)
-	c.importStorage = &getter.FolderStorage{
-		StorageDir: filepath.Join(opts.Dir, CompileImportsFolder)}
+	result, err := getter.Detect(src, pwd, detectors)
+	if err != nil {
+		return "", err
+	}
 
-	// Setup dep storage
-	c.depStorage = &getter.FolderStorage{
-		StorageDir: filepath.Join(opts.Dir, CompileDepsFolder)}
-	return c, nil
+	if c.detectCache == nil {
+		c.detectCache = make(map[detectKey]string)
+	}
+	c.detectCache[key] = result
+	return result, nil
 }
 
-// Compile compiles an Appfile.
-//
-// This may require network connectivity if there are imports or
-// non-local dependencies. The repositories that dependencies point to
-// will be fully loaded into the given directory, and the compiled Appfile
-// will be saved there.
-//
+// isLocalSource returns true if the detected source is on the local
+// filesystem.
+func isLocalSource(source string) bool {
+	if strings.HasPrefix(source, "file::") {
+		return true
+	}
+
+	u, err := url.Parse(source)
+	return err == nil && u.Scheme == "file"
+}
+
+// rootSource returns the resolved source of the root Appfile f.
+func (c *Compiler) rootSource(f *File) (string, error) {
+	dir, err := sourceDir(f, "")
+	if err != nil {
+		return "", err
+	}
+
+	return c.detect(".", dir)
+}
+
+// sourceDir returns the directory that relative sources in the Appfile f
+// are resolved against. source is the detected source that f was loaded
+// from, if any.
+//
+// If f was loaded from a local source, this is the directory of that
+// source rather than the stored copy of it, so that relative sources such
+// as "../sibling" resolve the same as they do for the Appfile in place.
+// Otherwise this is the absolute directory of f.Path, or the current
+// working directory if f wasn't loaded from a file.
+func sourceDir(f *File, source string) (string, error) {
+	if dir, ok := localSourcePath(source); ok {
+		return dir, nil
+	}
+
+	if f.Path == "" {
+		return os.Getwd()
+	}
+
+	return filepath.Abs(filepath.Dir(f.Path))
+}
+
+// localSourcePath returns the path on the local filesystem of a detected
+// local source, including its "//" subdirectory. The boolean is false if
+// the source isn't local.
+func localSourcePath(source string) (string, bool) {
+	if !isLocalSource(source) {
+		return "", false
+	}
+
+	source, subDir := getter.SourceDirSubdir(strings.TrimPrefix(source, "file::"))
+	u, err := url.Parse(source)
+	if err != nil {
+		return "", false
+	}
+
+	// Windows paths are formatted as "file://C:/path", so the drive
+	// letter is the host.
+	path := filepath.FromSlash(u.Host + u.Path)
+	if !filepath.IsAbs(path) {
+		return "", false
+	}
+
+	return filepath.Join(path, subDir), true
+}
+
+// recordStat increments the given stat counter and the metric with the
+// given name.
+func (c *Compiler) recordStat(v *int, metric string) {
+	c.incCounter(metric, 1)
+
+	c.statsLock.Lock()
+	defer c.statsLock.Unlock()
+	*v++
+}
+
+// recordFetch records that the source was downloaded with recordStat,
+// and whether that used the network.
+func (c *Compiler) recordFetch(source string, v *int, metric string) {
+	c.recordStat(v, metric)
+	if !isNetworkSource(source) {
+		return
+	}
+
+	c.statsLock.Lock()
+	defer c.statsLock.Unlock()
+	c.stats.NetworkUsed = true
+}
+
+// event delivers a compilation event to the Callback, Events channel,
+// EventWriter and WebhookURL, if they're set. Sending on the channel and
+// to the webhook never blocks: if either is full, the event is dropped.
+func (c *Compiler) event(e CompileEvent) {
+	if c.opts.Callback != nil {
+		c.opts.Callback(e)
+	}
+
+	if c.opts.Events != nil {
+		select {
+		case c.opts.Events <- e:
+		default:
+			c.logf("[DEBUG] compile event channel full, dropping: %#v", e)
+		}
+	}
+
+	if c.opts.EventWriter != nil {
+		c.eventLock.Lock()
+		defer c.eventLock.Unlock()
+		if err := writeEventJSON(c.opts.EventWriter, e); err != nil {
+			c.logf("[ERR] error writing compile event: %s", err)
+		}
+	}
+
+	if url := c.opts.WebhookURL; url != "" {
+		c.sendWebhook(url, e)
+	}
+}
+
+// logf logs a message to the configured Logger, or the global logger
+// if one isn't set.
+func (c *Compiler) logf(format string, v ...interface{}) {
+	if c.opts.Logger != nil {
+		c.opts.Logger.Printf(format, v...)
+		return
+	}
+
+	log.Printf(format, v...)
+}
+
+// LoadCompiled loads and verifies a compiled Appfile (*Compiled) from
+// disk.
+func LoadCompiled(dir string) (*Compiled, error) {
+	f, err := openCompiled(dir)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var c Compiled
+	dec := json.NewDecoder(f)
+	if err := dec.Decode(&c); err != nil {
+		return nil, err
+	}
+
+	return &c, nil
+}
+
+// LoadCompiledLazy is like LoadCompiled, but the File of each vertex in
+// the graph isn't decoded until it is accessed with
+// CompiledGraphVertex.LoadFile. Until then, File is nil. This is useful
+// for large graphs when only a part of the graph is needed.
+//
+// The root File (Compiled.File) is always loaded.
+func LoadCompiledLazy(dir string) (*Compiled, error) {
+	f, err := openCompiled(dir)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var raw compiledLazyJSON
+	dec := json.NewDecoder(f)
+	if err := dec.Decode(&raw); err != nil {
+		return nil, err
+	}
+
+	vertices := make([]*CompiledGraphVertex, len(raw.Vertices))
+	for i, v := range raw.Vertices {
+		vertices[i] = &CompiledGraphVertex{
+			Dir:       v.Dir,
+			License:   v.License,
+			Labels:    v.Labels,
+			NameValue: v.NameValue,
+			lazy:      &lazyFile{raw: v.File},
+		}
+	}
+
+	graph, err := compiledGraph(vertices, raw.Edges)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Compiled{
+		File:     raw.File,
+		Graph:    graph,
+		Declared: raw.Declared,
+		Profile:  raw.Profile,
+	}, nil
+}
+
+// openCompiled verifies the version of the compiled Appfile in dir and
+// opens it for reading.
+func openCompiled(dir string) (*os.File, error) {
+	// Check the version
+	vsnStr, err := oneline.Read(filepath.Join(dir, CompileVersionFilename))
+	if err != nil {
+		return nil, err
+	}
+	vsn, err := strconv.ParseInt(vsnStr, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	// If the version is too new, then we can't handle it
+	if vsn > CompileVersion {
+		return nil, fmt.Errorf(
+			"The Appfile for this enviroment was compiled with a newer version\n" +
+				"of Otto. Otto can't load this environment. You can recompile this\n" +
+				"environment to this version of Otto with `otto compile`.")
+	}
+
+	return os.Open(filepath.Join(dir, CompileFilename))
+}
+
+// NewCompiler initializes a compiler with the given options.
+func NewCompiler(opts *CompileOpts) (*Compiler, error) {
+	return NewCompilerWithOptions(opts.Dir, withCompileOpts(opts))
+}
+
+// NewCompilerWithOptions initializes a compiler that stores its data in
+// dir, configured with the given options. See CompilerOption.
+func NewCompilerWithOptions(dir string, options ...CompilerOption) (*Compiler, error) {
+	c := &Compiler{opts: DefaultCompileOpts(dir)}
+	for _, o := range options {
+		o(c)
+	}
+	opts := c.opts
+
+	// Create the directory if it doesn't already exist
+	if err := os.MkdirAll(opts.Dir, 0755); err != nil {
+		return nil, err
+	}
+
+	c.getterPool.New = func() interface{} { return DefaultGetters() }
+
+	// Setup our import storage and locks
+	cacheSize := opts.ImportCacheSize
+	if cacheSize <= 0 {
+		cacheSize = DefaultImportCacheSize
+	}
+	c.importCache = newImportLRU(cacheSize)
+	parallel := opts.MaxParallelImports
+	if parallel <= 0 {
+		parallel = DefaultMaxParallelImports
+	}
+	c.importSem = make(chan struct{}, parallel)
+	c.importStorage = &getter.FolderStorage{
+		StorageDir: filepath.Join(opts.Dir, CompileImportsFolder)}
+
+	// Setup dep storage
+	c.depStorage = &getter.FolderStorage{
+		StorageDir: filepath.Join(opts.Dir, CompileDepsFolder)}
+
+	// If we're content addressable, swap out the storage
+	if opts.ContentAddressable {
+		c.importStorage = &ContentStorage{
+			StorageDir: filepath.Join(opts.Dir, CompileImportsFolder)}
+		c.depStorage = &ContentStorage{
+			StorageDir: filepath.Join(opts.Dir, CompileDepsFolder)}
+	}
+
+	// Setup the shared dep storage, with the same layout as ours
+	if opts.SharedDepsDir != "" {
+		c.sharedStorage = &getter.FolderStorage{StorageDir: opts.SharedDepsDir}
+		if opts.ContentAddressable {
+			c.sharedStorage = &ContentStorage{StorageDir: opts.SharedDepsDir}
+		}
+	}
+
+	return c, nil
+}
+
+// Compile compiles an Appfile.
+//
+// This may require network connectivity if there are imports or
+// non-local dependencies. The repositories that dependencies point to
+// will be fully loaded into the given directory, and the compiled Appfile
+// will be saved there.
+//
 // LoadCompiled can be used to load a pre-compiled Appfile.
 //
 // If you have no interest in reloading a compiled Appfile, you can
@@ -232,235 +1308,981 @@ func NewCompiler(opts *CompileOpts) (*Compiler, error) {
 // Note that certain functions of Otto such as development environments
 // will depend on those directories existing, however.
 func (c *Compiler) Compile(f *File) (*Compiled, error) {
+	return c.CompileContext(context.Background(), f)
+}
+
+// CompileContext is like Compile, but with a context. The context is the
+// parent of the spans started with CompileOpts.Tracer. If it is canceled,
+// no more dependencies are loaded and its error is returned.
+func (c *Compiler) CompileContext(ctx context.Context, f *File) (*Compiled, error) {
+	return c.compile(ctx, f, true)
+}
+
+// CompileAndValidate loads all the imports and dependencies of an
+// Appfile and validates the result exactly like Compile, but doesn't
+// write the compiled Appfile. This is useful for checking an Appfile,
+// such as in CI.
+//
+// The dependencies and imports are still stored in the compilation
+// directory. If the Appfile doesn't have an Otto ID yet, a temporary
+// ID is used rather than writing a new one next to the Appfile.
+func (c *Compiler) CompileAndValidate(f *File) error {
+	_, err := c.compile(context.Background(), f, false)
+	return err
+}
+
+// compile does the actual compilation for Compile and
+// CompileAndValidate. The compiled Appfile and its version, as well as a
+// new Otto ID for the Appfile, are only written if write is true.
+func (c *Compiler) compile(ctx context.Context, f *File, write bool) (result *Compiled, err error) {
+	defer c.observeSince(MetricCompileDuration, time.Now())
+
+	ctx, span := c.startSpan(ctx, SpanCompile)
+	defer func() { span.Finish(err) }()
+	ctx = withDownloadSession(ctx)
+	ctx = withSourceGraph(ctx)
+
+	// Let listeners know we're starting, before anything is written
+	start := &CompileEventStart{Fresh: c.update(ctx)}
+	if f.Application != nil {
+		start.Name = f.Application.Name
+	}
+	if !start.Fresh {
+		_, err := os.Stat(filepath.Join(c.opts.Dir, CompileFilename))
+		start.Fresh = err != nil
+	}
+	c.event(start)
+	defer func(started time.Time) {
+		if err != nil {
+			c.event(&CompileEventError{Err: err})
+			return
+		}
+
+		finish := &CompileEventFinish{Duration: time.Since(started)}
+		if result != nil && result.File.Application != nil {
+			finish.Name = result.File.Application.Name
+		}
+		c.event(finish)
+	}(time.Now())
+
 	// Write the version of the compilation that we'll be completing.
-	if err := compileVersion(c.opts.Dir); err != nil {
-		return nil, fmt.Errorf("Error writing compiled Appfile version: %s", err)
+	if write {
+		c.writeLock.Lock()
+		err := compileVersion(c.opts.Dir)
+		c.writeLock.Unlock()
+		if err != nil {
+			return nil, fmt.Errorf("Error writing compiled Appfile version: %s", err)
+		}
+	}
+
+	// Check if we have an ID for this or not. If we don't, then we need
+	// to write the ID file. We only do this if the file has a path.
+	if f.Path != "" {
+		if c.opts.IDFilename != "" {
+			f.IDFilename = c.opts.IDFilename
+		}
+
+		hasID, err := f.hasID()
+		if err != nil {
+			return nil, fmt.Errorf(
+				"Error checking for Appfile UUID: %s", err)
+		}
+
+		if !hasID && !write {
+			// Use a temporary ID so that we don't modify the Appfile's
+			// directory when only validating.
+			f.ID = uuid.GenerateUUID()
+		} else {
+			if !hasID && c.opts.IDFromGitRemote {
+				hasID, err = c.recoverID(f)
+				if err != nil {
+					return nil, fmt.Errorf(
+						"Error recovering UUID for this Appfile from Git: %s", err)
+				}
+				if hasID {
+					c.event(&CompileEventWarning{
+						Message: fmt.Sprintf(
+							"The Otto ID of this Appfile was missing, so it was recovered\n"+
+								"from the default branch of the Git remote into %s.\n"+
+								"Make sure it is committed.", f.idPath()),
+					})
+				}
+			}
+			if !hasID {
+				if err := f.initID(); err != nil {
+					return nil, fmt.Errorf(
+						"Error writing UUID for this Appfile: %s", err)
+				}
+			}
+
+			if err := f.loadID(); err != nil {
+				return nil, fmt.Errorf(
+					"Error loading Appfile UUID: %s", err)
+			}
+		}
+	}
+
+	// Reset the download budget and stats for this compilation
+	c.begin()
+	defer c.end()
+
+	// Announce what we know needs loading before fetching anything
+	plan := &CompileEventPlan{Imports: len(f.Imports)}
+	if f.Application != nil {
+		plan.DirectDeps = len(c.activeDeps(f.Application.Dependencies))
+		plan.TotalDeps = plan.DirectDeps
+	}
+	planEvent := *plan
+	c.event(&planEvent)
+
+	// Do a minimum compile to start. The declarations of the root are
+	// recorded first, since merging the imports changes them.
+	declared, err := declaredProfileSources(f, c.opts.Profile)
+	if err != nil {
+		return nil, err
+	}
+	phase := time.Now()
+	phaseCtx, phaseSpan := c.startSpan(ctx, SpanImports)
+	compiled, err := c.minCompile(phaseCtx, f, c.opts.LoadRoot)
+	phaseSpan.Finish(err)
+	c.observeSince(MetricImportsDuration, phase)
+	if err != nil {
+		return nil, err
+	}
+	compiled.Declared = declared
+	compiled.Profile = c.opts.Profile
+
+	// Validate the root early
+	strict := c.opts.StrictValidation
+	if err := compiled.File.ValidateResults().Err(strict); err != nil {
+		return nil, err
+	}
+
+	// Get our root vertex
+	root, err := compiled.Graph.Root()
+	if err != nil {
+		return nil, err
+	}
+	vertex := root.(*CompiledGraphVertex)
+
+	// Build the storage we'll use for storing downloaded dependencies,
+	// then use that to trigger the recursive call to download all our
+	// dependencies.
+	phase = time.Now()
+	phaseCtx, phaseSpan = c.startSpan(ctx, SpanDeps)
+	err = c.compileDependencies(phaseCtx, vertex, compiled.Graph, plan)
+	phaseSpan.Finish(err)
+	c.observeSince(MetricDepsDuration, phase)
+	if err != nil {
+		return nil, &CompileError{Partial: compiled, Err: err}
+	}
+
+	// Validate the compiled file tree. Warnings are only reported unless
+	// validation is strict.
+	phase = time.Now()
+	_, phaseSpan = c.startSpan(ctx, SpanValidate)
+	results := compiled.ValidateResults(&ValidateOpts{Strict: strict})
+	err = results.Err(strict)
+	phaseSpan.Finish(err)
+	c.observeSince(MetricValidateDuration, phase)
+	if err != nil {
+		return nil, &CompileError{Partial: compiled, Err: err}
+	}
+	for _, w := range results.Warnings() {
+		c.logf("[WARN] %s", w)
+		c.event(&CompileEventWarning{Message: w.Err.Error()})
+	}
+
+	if !write {
+		return compiled, nil
+	}
+
+	// Write the compiled Appfile data
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+	phase = time.Now()
+	_, phaseSpan = c.startSpan(ctx, SpanWrite)
+	err = compileWrite(c.opts.Dir, compiled)
+	phaseSpan.Finish(err)
+	c.observeSince(MetricWriteDuration, phase)
+	if err != nil {
+		return nil, err
+	}
+
+	return compiled, nil
+}
+
+// begin is called when a compilation starts. The download budget and
+// stats are reset unless other compilations are still running, in which
+// case they're shared with them.
+func (c *Compiler) begin() {
+	c.runLock.Lock()
+	defer c.runLock.Unlock()
+
+	if c.running == 0 {
+		c.totalLock.Lock()
+		c.totalBytes = 0
+		c.totalLock.Unlock()
+
+		c.statsLock.Lock()
+		c.stats = CompileStats{}
+		c.statsLock.Unlock()
+	}
+
+	c.running++
+}
+
+// end is called when a compilation that called begin is done.
+func (c *Compiler) end() {
+	c.runLock.Lock()
+	defer c.runLock.Unlock()
+	c.running--
+}
+
+// MinCompile does a minimal compilation of the given Appfile.
+//
+// This will load and merge any imports. This is used for a very basic
+// Compiled Appfile that can be used with Otto core.
+//
+// This does not fetch dependencies.
+func (c *Compiler) MinCompile(f *File) (*Compiled, error) {
+	return c.minCompile(context.Background(), f, false)
+}
+
+// minCompile does the work of MinCompile. If load is set, the Loader is
+// called for f once its imports are merged. See CompileOpts.LoadRoot.
+func (c *Compiler) minCompile(ctx context.Context, f *File, load bool) (*Compiled, error) {
+	// Start building our compiled Appfile
+	compiled := &Compiled{File: f, Graph: new(dag.AcyclicGraph)}
+
+	// Load the imports for this single Appfile
+	source, err := c.rootSource(f)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.compileImports(ctx, source, f); err != nil {
+		return nil, err
+	}
+	if c.opts.Profile != "" {
+		if err := f.ApplyProfile(c.opts.Profile); err != nil {
+			return nil, err
+		}
+	}
+	if err := c.resolveSecrets(f, source); err != nil {
+		return nil, err
+	}
+
+	// Do any additional loading if we have a loader
+	if load && c.opts.Loader != nil {
+		dir, err := sourceDir(f, "")
+		if err != nil {
+			return nil, err
+		}
+
+		f, err = c.opts.Loader(f, dir)
+		if err != nil {
+			return nil, fmt.Errorf("Error loading Appfile in %s: %s", dir, err)
+		}
+		if f == nil {
+			return nil, fmt.Errorf("No Appfile loaded in %s", dir)
+		}
+		compiled.File = f
+	}
+
+	// Add our root vertex for this Appfile
+	vertex := &CompiledGraphVertex{
+		File:      f,
+		Labels:    f.Labels,
+		NameValue: f.Application.Name,
+	}
+	if err := c.vertexHook(vertex); err != nil {
+		return nil, err
+	}
+	compiled.Graph.Add(vertex)
+
+	return compiled, nil
+}
+
+func (c *Compiler) compileDependencies(
+	ctx context.Context,
+	root *CompiledGraphVertex, graph *dag.AcyclicGraph, plan *CompileEventPlan) error {
+	// For easier reference below
+	storage := c.depStorage
+
+	// Make a map to keep track of the dep source to vertex mapping
+	vertexMap := make(map[string]*CompiledGraphVertex)
+
+	// Store ourselves in the map
+	key, err := c.rootSource(root.File)
+	if err != nil {
+		return err
+	}
+	vertexMap[key] = root
+	rootKey := key
+
+	// Keep track of every dependency we've discovered to update the plan
+	known := make(map[string]struct{})
+
+	// Make a queue for the other vertices we need to still get
+	// dependencies for. We arbitrarily make the cap for this slice
+	// 30, since that is a ton of dependencies and we don't expect the
+	// average case to have more than this.
+	queue := make([]*CompiledGraphVertex, 1, 30)
+	queue[0] = root
+
+	// Keep track of the vertex that first depended on each vertex so we
+	// can determine the chain of dependencies leading to it.
+	parents := make(map[*CompiledGraphVertex]*CompiledGraphVertex)
+
+	// Keep track of dependencies that declare a different infrastructure
+	// than the root, since it is overridden with the root's.
+	var conflicts []string
+	rootInfra := declaredInfra(root.File)
+
+	// Keep track of the Otto IDs we've seen, since they must be unique
+	// to each application.
+	ids := make(map[string]*CompiledGraphVertex)
+	if root.File.ID != "" {
+		ids[root.File.ID] = root
+	}
+
+	// While we still have dependencies to get, continue loading them.
+	// TODO: parallelize
+	for len(queue) > 0 {
+		var current *CompiledGraphVertex
+		if c.opts.TraversalOrder == TraversalBFS {
+			current, queue = queue[0], queue[1:]
+		} else {
+			current, queue = queue[len(queue)-1], queue[:len(queue)-1]
+		}
+
+		c.logf("[DEBUG] compiling dependencies for: %s", current.Name())
+
+		pwd, err := sourceDir(current.File, current.File.Source)
+		if err != nil {
+			return fmt.Errorf(
+				"Error resolving the directory of %s: %s", current.Name(), err)
+		}
+
+		deps := c.activeDeps(current.File.Application.Dependencies)
+		if c.opts.TraversalOrder == TraversalBFS {
+			deps = append([]*Dependency(nil), deps...)
+			sort.Sort(dependencyBySource(deps))
+		}
+
+		// Update the plan with any dependencies we haven't seen. Errors
+		// detecting the sources are reported below.
+		for _, dep := range deps {
+			key, err := c.detect(
+				current.File.resolveAlias(dep.Source), pwd)
+			if err == nil && key != rootKey {
+				known[key] = struct{}{}
+			}
+		}
+		direct := plan.DirectDeps
+		if current == root {
+			direct = len(known)
+		}
+		if direct != plan.DirectDeps || len(known) != plan.TotalDeps {
+			plan.DirectDeps = direct
+			plan.TotalDeps = len(known)
+			planEvent := *plan
+			c.event(&planEvent)
+		}
+
+		// Keep track of the names of the dependencies of this file, since
+		// two dependencies with the same name would be ambiguous.
+		names := make(map[string]string)
+		for _, dep := range deps {
+			key, err := c.detect(
+				current.File.resolveAlias(dep.Source), pwd)
+			if err != nil {
+				return depChainError(parents, current, dep.Source, fmt.Errorf(
+					"Error loading source: %s", err))
+			}
+
+			vertex := vertexMap[key]
+			if vertex == nil {
+				c.logf("[DEBUG] loading dependency: %s", key)
+
+				// Notify any listeners
+				c.event(&CompileEventDep{
+					Source: key,
+				})
+
+				// Stop if the compilation was canceled
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+
+				// Download the dependency and parse the Appfile
+				depCtx, span := c.startSpan(ctx, SpanDep)
+				span.SetTag(SpanTagSource, key)
+				f, dir, err := c.loadDep(ctx, storage, key)
+				span.Finish(err)
+				if err != nil {
+					return depChainError(parents, current, key, err)
+				}
+
+				// Realize all the imports for this file
+				if f != nil {
+					if err := c.compileImports(depCtx, key, f); err != nil {
+						return depChainError(parents, current, key, err)
+					}
+					if err := c.applyDepProfile(f); err != nil {
+						return depChainError(parents, current, key, err)
+					}
+					if err := c.resolveSecrets(f, key); err != nil {
+						return depChainError(parents, current, key, err)
+					}
+				}
+
+				// Do any additional loading if we have a loader
+				if c.opts.Loader != nil {
+					f, err = c.opts.Loader(f, dir)
+					if err != nil {
+						return depChainError(parents, current, key, fmt.Errorf(
+							"Error loading Appfile in %s: %s", key, err))
+					}
+				}
+
+				// Without an Appfile there's nothing to compile
+				if f == nil {
+					return depChainError(
+						parents, current, key, c.missingAppfileError(key, dir))
+				}
+
+				// Set the source
+				f.Source = key
+
+				// If it doesn't have an otto ID then we can't do anything
+				hasID, err := f.hasID()
+				if err != nil {
+					return depChainError(parents, current, key, fmt.Errorf(
+						"Error checking for ID file for Appfile in %s: %s",
+						key, err))
+				}
+				allowMissing := c.opts.AllowMissingDepID ||
+					(c.opts.AllowMissingLocalDepID && isLocalSource(key))
+				if !hasID && allowMissing {
+					// Use a temporary ID so that we can keep going
+					f.ID = uuid.GenerateUUID()
+					c.logf("[WARN] dependency %s has no ID, using: %s", key, f.ID)
+					c.event(&CompileEventWarning{
+						Source: key,
+						Message: fmt.Sprintf(
+							"Dependency '%s' doesn't have an Otto ID yet. A temporary ID\n"+
+								"is being used, which will change on every compilation.", key),
+					})
+				} else if !hasID {
+					return depChainError(parents, current, key, &MissingIDError{
+						Source: key,
+						IDFile: f.idFile(),
+					})
+				}
+
+				// We merge the root infrastructure choice upwards to
+				// all dependencies.
+				if infra := declaredInfra(f); infra != "" && infra != rootInfra {
+					conflicts = append(conflicts, fmt.Sprintf(
+						"%s (%s): %s", f.Application.Name, key, infra))
+				}
+				f.Infrastructure = root.File.Infrastructure
+				if root.File.Project != nil {
+					if f.Project == nil {
+						f.Project = new(Project)
+					}
+					f.Project.Infrastructure = root.File.Project.Infrastructure
+				}
+
+				// Record the license for auditing
+				licenseDir := dir
+				if f.Path != "" {
+					licenseDir = filepath.Dir(f.Path)
+				}
+				license, err := detectLicense(licenseDir)
+				if err != nil {
+					return depChainError(parents, current, key, fmt.Errorf(
+						"Error detecting license in %s: %s", key, err))
+				}
+
+				// Build the vertex for this
+				vertex = &CompiledGraphVertex{
+					File:      f,
+					Dir:       dir,
+					License:   license,
+					Labels:    f.Labels,
+					NameValue: f.Application.Name,
+				}
+
+				if err := c.vertexHook(vertex); err != nil {
+					return depChainError(parents, current, key, err)
+				}
+
+				// Add the vertex since it is new, store the mapping, and
+				// queue it to be loaded later.
+				graph.Add(vertex)
+				vertexMap[key] = vertex
+				parents[vertex] = current
+				queue = append(queue, vertex)
+			}
+
+			// Verify that the application doesn't depend on itself
+			if err := checkSelfDep(parents, current, vertex); err != nil {
+				return err
+			}
+
+			// Verify that the Otto ID isn't shared by another application
+			if vertex.File != nil && vertex.File.ID != "" {
+				id := vertex.File.ID
+				if other, ok := ids[id]; ok && other != vertex && other.Name() != vertex.Name() {
+					return fmt.Errorf(
+						"Applications '%s' (%s) and '%s' (%s) have the same Otto ID.\n\n"+
+							"This usually means that one was copied from the other. Otto IDs\n"+
+							"must be unique to track applications. To fix this, delete the\n"+
+							"%s file from one of them and compile it with `otto compile`\n"+
+							"to generate a new ID.",
+						other.Name(), vertexSource(other),
+						vertex.Name(), vertexSource(vertex), vertex.File.idFile())
+				}
+				ids[id] = vertex
+			}
+
+			// Verify the name of this dependency is unique
+			if other, ok := names[vertex.Name()]; ok && other != key {
+				return fmt.Errorf(
+					"Dependencies '%s' and '%s' of '%s' both have the application\n"+
+						"name '%s'. Dependencies of an application must have unique names.",
+					other, key, current.Name(), vertex.Name())
+			}
+			names[vertex.Name()] = key
+
+			// Connect the dependencies, checking for cycles through both
+			// imports and dependencies
+			currentKey := current.File.Source
+			if current == root {
+				currentKey = rootKey
+			}
+			err = sourceGraphFrom(ctx).Connect(currentKey, key, CycleEdgeDependency)
+			if err != nil {
+				return depChainError(parents, current, key, err)
+			}
+			graph.Connect(dag.BasicEdge(current, vertex))
+		}
+	}
+
+	if len(conflicts) > 0 {
+		sort.Strings(conflicts)
+		msg := fmt.Sprintf(
+			"The following dependencies declare a different infrastructure\n"+
+				"than '%s', which is used by the root application. The\n"+
+				"root's infrastructure is always used for all dependencies, so\n"+
+				"these declarations are being overridden:\n\n  %s",
+			rootInfra, strings.Join(conflicts, "\n  "))
+
+		// This is only a warning unless validation is strict
+		if c.opts.StrictValidation {
+			return errors.New(msg)
+		}
+
+		c.logf("[WARN] dependencies with overridden infrastructure: %v", conflicts)
+		c.event(&CompileEventWarning{
+			Source:  rootKey,
+			Message: msg,
+		})
 	}
 
-	// Check if we have an ID for this or not. If we don't, then we need
-	// to write the ID file. We only do this if the file has a path.
-	if f.Path != "" {
-		hasID, err := f.hasID()
-		if err != nil {
-			return nil, fmt.Errorf(
-				"Error checking for Appfile UUID: %s", err)
+	return nil
+}
+
+// declaredInfra returns a description of the infrastructure that the
+// Appfile declares for its project, or an empty string if it doesn't
+// declare one.
+func declaredInfra(f *File) string {
+	if f.Project == nil || f.Project.Infrastructure == "" {
+		return ""
+	}
+
+	name := f.Project.Infrastructure
+	for _, i := range f.Infrastructure {
+		if i.Name != name {
+			continue
+		}
+
+		if i.Flavor != "" {
+			return fmt.Sprintf("%s (%s/%s)", name, i.Type, i.Flavor)
+		}
+		if i.Type != "" {
+			return fmt.Sprintf("%s (%s)", name, i.Type)
+		}
+	}
+
+	return name
+}
+
+// vertexHook calls the VertexHook, if there is one, for the vertex.
+func (c *Compiler) vertexHook(v *CompiledGraphVertex) error {
+	if c.opts.VertexHook == nil {
+		return nil
+	}
+
+	if err := c.opts.VertexHook(v); err != nil {
+		return fmt.Errorf(
+			"Error processing application '%s': %s", v.Name(), err)
+	}
+
+	return nil
+}
+
+// vertexSource returns the source of the vertex for messages to the
+// user, which is the path for the root.
+func vertexSource(v *CompiledGraphVertex) string {
+	if v.File.Source != "" {
+		return v.File.Source
+	}
+
+	return v.File.Path
+}
+
+// checkSelfDep returns an error if dep, a dependency of current, is the
+// same application as current or any of the applications that lead to
+// it. Applications are the same if they're the same vertex or have the
+// same Otto ID.
+func checkSelfDep(
+	parents map[*CompiledGraphVertex]*CompiledGraphVertex,
+	current, dep *CompiledGraphVertex) error {
+	chain := []*CompiledGraphVertex{current}
+	for v := parents[current]; v != nil; v = parents[v] {
+		chain = append(chain, v)
+	}
+
+	for _, v := range chain {
+		same := v == dep
+		if !same && v.File != nil && dep.File != nil {
+			same = dep.File.ID != "" && v.File.ID == dep.File.ID
+		}
+		if !same {
+			continue
+		}
+
+		names := append(depChain(parents, current), dep.Name())
+		return fmt.Errorf(
+			"Application '%s' can't depend on itself: %s",
+			v.Name(), strings.Join(names, " -> "))
+	}
+
+	return nil
+}
+
+// depChain returns the names of the applications in the chain of
+// dependencies from the root to current.
+func depChain(
+	parents map[*CompiledGraphVertex]*CompiledGraphVertex,
+	current *CompiledGraphVertex) []string {
+	var names []string
+	for v := current; v != nil; v = parents[v] {
+		names = append([]string{v.Name()}, names...)
+	}
+
+	return names
+}
+
+// depChainError wraps an error loading source, a dependency of current,
+// with the chain of dependencies from the root that led to it.
+func depChainError(
+	parents map[*CompiledGraphVertex]*CompiledGraphVertex,
+	current *CompiledGraphVertex, source string, err error) error {
+	names := append(depChain(parents, current), source)
+	return &DependencyChainError{Chain: names, Err: err}
+}
+
+// activeDeps returns the dependencies that should be compiled: those
+// without tags and those with at least one tag in CompileOpts.ActiveTags.
+func (c *Compiler) activeDeps(deps []*Dependency) []*Dependency {
+	result := make([]*Dependency, 0, len(deps))
+	for _, dep := range deps {
+		if len(dep.Tags) == 0 {
+			result = append(result, dep)
+			continue
 		}
 
-		if !hasID {
-			if err := f.initID(); err != nil {
-				return nil, fmt.Errorf(
-					"Error writing UUID for this Appfile: %s", err)
+		for _, tag := range dep.Tags {
+			if c.tagActive(tag) {
+				result = append(result, dep)
+				break
 			}
 		}
+	}
 
-		if err := f.loadID(); err != nil {
-			return nil, fmt.Errorf(
-				"Error loading Appfile UUID: %s", err)
+	return result
+}
+
+// tagActive returns true if the tag is in CompileOpts.ActiveTags.
+func (c *Compiler) tagActive(tag string) bool {
+	for _, active := range c.opts.ActiveTags {
+		if active == tag {
+			return true
 		}
 	}
 
-	// Do a minimum compile to start
-	compiled, err := c.MinCompile(f)
-	if err != nil {
-		return nil, err
+	return false
+}
+
+// applyDepProfile applies CompileOpts.Profile to a dependency if it
+// defines the profile.
+func (c *Compiler) applyDepProfile(f *File) error {
+	if c.opts.Profile == "" {
+		return nil
 	}
 
-	// Validate the root early
-	if err := compiled.File.Validate(); err != nil {
-		return nil, err
+	for _, p := range f.Profiles {
+		if p.Name == c.opts.Profile {
+			return f.ApplyProfile(p.Name)
+		}
 	}
 
-	// Get our root vertex
-	root, err := compiled.Graph.Root()
+	return nil
+}
+
+// loadDep downloads the dependency with the given key and parses its
+// Appfile. The File is nil if the dependency doesn't have an Appfile.
+func (c *Compiler) loadDep(
+	ctx context.Context, storage getter.Storage, key string) (*File, string, error) {
+	// Hold the lock until we're done reading the dependency so that a
+	// concurrent compilation doesn't replace it while we read it.
+	defer c.lockSource(key)()
+
+	dir, fetched, err := c.get(ctx, storage, key, c.update(ctx))
 	if err != nil {
-		return nil, err
+		return nil, "", &DependencyFetchError{Source: key, Err: err}
+	}
+	if !fetched {
+		c.recordStat(&c.stats.DepsCached, MetricDepsCached)
+	} else {
+		c.recordFetch(key, &c.stats.DepsFetched, MetricDepsFetched)
+		if err := c.addDownloadSize(key, dir); err != nil {
+			return nil, "", err
+		}
 	}
-	vertex := root.(*CompiledGraphVertex)
 
-	// Build the storage we'll use for storing downloaded dependencies,
-	// then use that to trigger the recursive call to download all our
-	// dependencies.
-	if err := c.compileDependencies(vertex, compiled.Graph); err != nil {
-		return nil, err
+	// Parse the Appfile if it exists
+	appfilePath := c.appfilePath(dir)
+	_, err = os.Stat(appfilePath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, "", fmt.Errorf(
+			"Error parsing Appfile in %s: %s", key, err)
+	}
+	if err != nil {
+		return nil, dir, nil
 	}
 
-	// Validate the compiled file tree.
-	if err := compiled.Validate(); err != nil {
-		return nil, err
+	f, err := ParseFile(appfilePath)
+	if err != nil {
+		return nil, "", &DependencyParseError{Source: key, Err: err}
 	}
 
-	// Write the compiled Appfile data
-	if err := compileWrite(c.opts.Dir, compiled); err != nil {
-		return nil, err
+	// Reload the ID if it is stored somewhere else
+	if c.opts.IDFilename != "" {
+		f.IDFilename = c.opts.IDFilename
+		if err := f.loadID(); err != nil {
+			return nil, "", fmt.Errorf(
+				"Error loading ID for Appfile in %s: %s", key, err)
+		}
 	}
 
-	return compiled, nil
+	return f, dir, nil
 }
 
-// MinCompile does a minimal compilation of the given Appfile.
-//
-// This will load and merge any imports. This is used for a very basic
-// Compiled Appfile that can be used with Otto core.
-//
-// This does not fetch dependencies.
-func (c *Compiler) MinCompile(f *File) (*Compiled, error) {
-	// Start building our compiled Appfile
-	compiled := &Compiled{File: f, Graph: new(dag.AcyclicGraph)}
+// missingAppfileError returns the error for a dependency that doesn't
+// have an Appfile in the directory it was stored in. Release archives
+// usually unpack into a single versioned folder, so if that folder has the
+// Appfile, the error suggests selecting it with a "//" subdirectory.
+func (c *Compiler) missingAppfileError(key, dir string) error {
+	msg := fmt.Sprintf("No Appfile found in %s", key)
 
-	// Load the imports for this single Appfile
-	if err := c.compileImports(f); err != nil {
-		return nil, err
+	// Hidden files, such as archive metadata, are ignored
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return errors.New(msg)
+	}
+	var visible []os.FileInfo
+	for _, e := range entries {
+		if !strings.HasPrefix(e.Name(), ".") {
+			visible = append(visible, e)
+		}
+	}
+	if len(visible) != 1 || !visible[0].IsDir() {
+		return errors.New(msg)
 	}
 
-	// Add our root vertex for this Appfile
-	vertex := &CompiledGraphVertex{File: f, NameValue: f.Application.Name}
-	compiled.Graph.Add(vertex)
+	name := visible[0].Name()
+	if _, err := os.Stat(c.appfilePath(filepath.Join(dir, name))); err != nil {
+		return errors.New(msg)
+	}
 
-	return compiled, nil
+	return fmt.Errorf(
+		"%s. The Appfile is in the %q folder, which can be\n"+
+			"selected by adding \"//%s\" to the end of the source, such as\n"+
+			"for a release archive that unpacks into a versioned folder.",
+		msg, name, name)
 }
 
-func (c *Compiler) compileDependencies(root *CompiledGraphVertex, graph *dag.AcyclicGraph) error {
-	// For easier reference below
-	storage := c.depStorage
-
-	// Make a map to keep track of the dep source to vertex mapping
-	vertexMap := make(map[string]*CompiledGraphVertex)
-
-	// Store ourselves in the map
-	key, err := getter.Detect(
-		".", filepath.Dir(root.File.Path),
-		getter.Detectors)
+// get returns the directory where the source is stored in the storage.
+// Unless update is set, a valid copy that is already stored is used
+// as-is. Otherwise the source is downloaded, in which case the boolean
+// result is true.
+//
+// If the source selects a subdirectory with "//", such as
+// "git::https://host/repo//services/api", the root of the source is
+// stored and the returned directory is the subdirectory within it. This
+// lets sources in different subdirectories of the same repository share
+// a single download.
+//
+// Dependencies are looked for in CompileOpts.SharedDepsDir before the
+// storage, but are only ever downloaded into the storage.
+//
+// A source is only downloaded once per compilation, so update is ignored
+// if the source was already downloaded during the compilation in ctx.
+func (c *Compiler) get(
+	ctx context.Context, storage getter.Storage, source string, update bool) (string, bool, error) {
+	source, subDir, err := splitSubdir(source)
 	if err != nil {
-		return err
+		return "", false, err
 	}
-	vertexMap[key] = root
 
-	// Make a queue for the other vertices we need to still get
-	// dependencies for. We arbitrarily make the cap for this slice
-	// 30, since that is a ton of dependencies and we don't expect the
-	// average case to have more than this.
-	queue := make([]*CompiledGraphVertex, 1, 30)
-	queue[0] = root
+	session := downloadSessionFrom(ctx)
+	if update && session.Downloaded(storage, source) {
+		update = false
+	}
 
-	// While we still have dependencies to get, continue loading them.
-	// TODO: parallelize
-	for len(queue) > 0 {
-		var current *CompiledGraphVertex
-		current, queue = queue[len(queue)-1], queue[:len(queue)-1]
+	if !update {
+		// Dependencies are looked for in the shared storage first
+		stores := []getter.Storage{storage}
+		if storage == c.depStorage && c.sharedStorage != nil {
+			stores = []getter.Storage{c.sharedStorage, storage}
+		}
 
-		log.Printf("[DEBUG] compiling dependencies for: %s", current.Name())
-		for _, dep := range current.File.Application.Dependencies {
-			key, err := getter.Detect(
-				dep.Source, filepath.Dir(current.File.Path),
-				getter.Detectors)
+		for _, s := range stores {
+			dir, ok, err := c.stored(s, source)
 			if err != nil {
-				return fmt.Errorf(
-					"Error loading source: %s", err)
+				return "", false, err
+			}
+			if !ok {
+				continue
 			}
 
-			vertex := vertexMap[key]
-			if vertex == nil {
-				log.Printf("[DEBUG] loading dependency: %s", key)
+			c.logf("[DEBUG] using stored copy of: %s", source)
+			dir, err = subdirPath(dir, subDir)
+			return dir, false, err
+		}
+	}
 
-				// Call the callback if we have one
-				if c.opts.Callback != nil {
-					c.opts.Callback(&CompileEventDep{
-						Source: key,
-					})
-				}
+	if err := c.fetch(storage, source); err != nil {
+		return "", false, err
+	}
+	session.Add(storage, source)
+	dir, _, err := storage.Dir(source)
+	if err != nil {
+		return "", false, err
+	}
 
-				// Download the dependency
-				if err := storage.Get(key, key, true); err != nil {
-					return err
-				}
-				dir, _, err := storage.Dir(key)
-				if err != nil {
-					return err
-				}
+	dir, err = subdirPath(dir, subDir)
+	return dir, true, err
+}
 
-				// Parse the Appfile if it exists
-				var f *File
-				appfilePath := filepath.Join(dir, "Appfile")
-				_, err = os.Stat(appfilePath)
-				if err != nil && !os.IsNotExist(err) {
-					return fmt.Errorf(
-						"Error parsing Appfile in %s: %s", key, err)
-				}
-				if err == nil {
-					f, err = ParseFile(appfilePath)
-					if err != nil {
-						return fmt.Errorf(
-							"Error parsing Appfile in %s: %s", key, err)
-					}
+// stored returns the directory of the copy of the source in the storage,
+// if there is a valid one.
+func (c *Compiler) stored(storage getter.Storage, source string) (string, bool, error) {
+	dir, ok, err := storage.Dir(source)
+	if err != nil || !ok {
+		return "", false, err
+	}
 
-					// Realize all the imports for this file
-					if err := c.compileImports(f); err != nil {
-						return err
-					}
-				}
+	// Content addressed storage lets us verify the stored copy
+	if s, isContent := storage.(*ContentStorage); isContent {
+		ok, err = s.verify(dir)
+		if err != nil {
+			return "", false, err
+		}
+		if !ok {
+			c.logf("[WARN] stored copy of %s in %s is invalid", source, s.StorageDir)
+			return "", false, nil
+		}
+	}
 
-				// Do any additional loading if we have a loader
-				if c.opts.Loader != nil {
-					f, err = c.opts.Loader(f, dir)
-					if err != nil {
-						return fmt.Errorf(
-							"Error loading Appfile in %s: %s", key, err)
-					}
-				}
+	return dir, true, nil
+}
 
-				// Set the source
-				f.Source = key
+// splitSubdir splits the "//" subdirectory off of a detected source. An
+// error is returned if the subdirectory would be outside of the source.
+func splitSubdir(source string) (string, string, error) {
+	source, subDir := getter.SourceDirSubdir(source)
+	if subDir == "" {
+		return source, "", nil
+	}
 
-				// If it doesn't have an otto ID then we can't do anything
-				hasID, err := f.hasID()
-				if err != nil {
-					return fmt.Errorf(
-						"Error checking for ID file for Appfile in %s: %s",
-						key, err)
-				}
-				if !hasID {
-					return fmt.Errorf(
-						"Dependency '%s' doesn't have an Otto ID yet!\n\n"+
-							"An Otto ID is generated on the first compilation of the Appfile.\n"+
-							"It is a globally unique ID that is used to track the application\n"+
-							"across multiple deploys. It is required for the application to be\n"+
-							"used as a dependency. To fix this, check out that application and\n"+
-							"compile the Appfile with `otto compile` once. Make sure you commit\n"+
-							"the .ottoid file into version control, and then try this command\n"+
-							"again.",
-						key)
-				}
+	subDir = filepath.Clean(subDir)
+	if filepath.IsAbs(subDir) || subDir == ".." ||
+		strings.HasPrefix(subDir, ".."+string(filepath.Separator)) {
+		return "", "", fmt.Errorf(
+			"subdirectory %q of %s must be within the source", subDir, source)
+	}
 
-				// We merge the root infrastructure choice upwards to
-				// all dependencies.
-				f.Infrastructure = root.File.Infrastructure
-				if root.File.Project != nil {
-					if f.Project == nil {
-						f.Project = new(Project)
-					}
-					f.Project.Infrastructure = root.File.Project.Infrastructure
-				}
+	return source, subDir, nil
+}
 
-				// Build the vertex for this
-				vertex = &CompiledGraphVertex{
-					File:      f,
-					Dir:       dir,
-					NameValue: f.Application.Name,
-				}
+// subdirPath returns the path to the subdirectory of the stored directory
+// dir. The subdirectory may be a glob that matches a single directory.
+func subdirPath(dir, subDir string) (string, error) {
+	if subDir == "" {
+		return dir, nil
+	}
 
-				// Add the vertex since it is new, store the mapping, and
-				// queue it to be loaded later.
-				graph.Add(vertex)
-				vertexMap[key] = vertex
-				queue = append(queue, vertex)
-			}
+	return getter.SubdirGlob(dir, subDir)
+}
 
-			// Connect the dependencies
-			graph.Connect(dag.BasicEdge(current, vertex))
-		}
+// lockSource locks the given source so that only one compilation at a
+// time can download and read it. It returns the function to unlock it.
+// Sources in different subdirectories of the same root share a lock since
+// they're stored together.
+func (c *Compiler) lockSource(source string) func() {
+	source, _ = getter.SourceDirSubdir(source)
+
+	c.fetchLock.Lock()
+	if c.fetchLocks == nil {
+		c.fetchLocks = make(map[string]*sync.Mutex)
+	}
+	l, ok := c.fetchLocks[source]
+	if !ok {
+		l = new(sync.Mutex)
+		c.fetchLocks[source] = l
 	}
+	c.fetchLock.Unlock()
 
-	return nil
+	l.Lock()
+	return l.Unlock
+}
+
+// mergeChanged returns true if merging changed the File from before to
+// after. Only the configuration is compared, not where it came from.
+func mergeChanged(before, after *File) bool {
+	a, b := *before, *after
+	a.Positions, b.Positions = nil, nil
+	return !reflect.DeepEqual(&a, &b)
+}
+
+// importCacheEntry is an import in the Compiler's cache along with the
+// time it was loaded, which is used for ImportCacheTTL.
+type importCacheEntry struct {
+	File *File
+	Time time.Time
+}
+
+// importExpired returns true if the cached import is older than the
+// ImportCacheTTL.
+func (c *Compiler) importExpired(e *importCacheEntry) bool {
+	ttl := c.opts.ImportCacheTTL
+	return ttl > 0 && time.Since(e.Time) >= ttl
 }
 
 type compileImportOpts struct {
@@ -470,8 +2292,9 @@ type compileImportOpts struct {
 }
 
 // compileImports takes a File, loads all the imports, and merges them
-// into the File.
-func (c *Compiler) compileImports(root *File) error {
+// into the File. source is the resolved source of the File, which is used
+// to check for cycles.
+func (c *Compiler) compileImports(ctx context.Context, source string, root *File) error {
 	// If we have no imports, short-circuit the whole thing
 	if len(root.Imports) == 0 {
 		return nil
@@ -482,10 +2305,8 @@ func (c *Compiler) compileImports(root *File) error {
 	cache := c.importCache
 	cacheLock := &c.importLock
 
-	// A graph is used to track for cycles
-	var graphLock sync.Mutex
-	graph := new(dag.AcyclicGraph)
-	graph.Add("root")
+	// The graph of the compilation is used to check for cycles
+	graph := sourceGraphFrom(ctx)
 
 	// Since we run the import in parallel, multiple errors can happen
 	// at the same time. We use multierror and a lock to keep track of errors.
@@ -508,11 +2329,19 @@ func (c *Compiler) compileImports(root *File) error {
 		var mergeLock sync.Mutex
 		merge := make([]*File, len(f.Imports))
 
+		// Relative imports are resolved against the directory of this
+		// file.
+		pwd, err := sourceDir(f, parent)
+		if err != nil {
+			resultErrLock.Lock()
+			defer resultErrLock.Unlock()
+			resultErr = multierror.Append(resultErr, err)
+			return false
+		}
+
 		// Go through the imports and kick off the download
 		for idx, i := range f.Imports {
-			source, err := getter.Detect(
-				i.Source, filepath.Dir(f.Path),
-				getter.Detectors)
+			source, err := c.detect(f.resolveAlias(i.Source), pwd)
 			if err != nil {
 				resultErrLock.Lock()
 				defer resultErrLock.Unlock()
@@ -522,26 +2351,16 @@ func (c *Compiler) compileImports(root *File) error {
 			}
 
 			// Add this to the graph and check now if there are cycles
-			graphLock.Lock()
-			graph.Add(source)
-			graph.Connect(dag.BasicEdge(parent, source))
-			cycles := graph.Cycles()
-			graphLock.Unlock()
-			if len(cycles) > 0 {
-				for _, cycle := range cycles {
-					names := make([]string, len(cycle))
-					for i, v := range cycle {
-						names[i] = dag.VertexName(v)
-					}
-
-					resultErrLock.Lock()
-					defer resultErrLock.Unlock()
-					resultErr = multierror.Append(resultErr, fmt.Errorf(
-						"Cycle found: %s", strings.Join(names, ", ")))
-					return false
-				}
+			if err := graph.Connect(parent, source, CycleEdgeImport); err != nil {
+				resultErrLock.Lock()
+				defer resultErrLock.Unlock()
+				resultErr = multierror.Append(resultErr, err)
+				return false
 			}
 
+			// Wait for a free slot before starting the download so that
+			// the number of goroutines is bounded as well.
+			c.importSem <- struct{}{}
 			wg.Add(1)
 			go downloadSingle(source, &wg, &mergeLock, merge, idx)
 		}
@@ -559,14 +2378,33 @@ func (c *Compiler) compileImports(root *File) error {
 		}
 
 		for _, importF := range merge {
-			// We need to copy importF here so that we don't poison
-			// the cache by modifying the same pointer.
-			importFCopy := *importF
-			importF = &importFCopy
+			// We need to deep copy importF here so that we don't poison
+			// the cache by modifying the same pointers. The cached File
+			// can be shared with other compilations running concurrently
+			// with the same Compiler, so a shallow copy isn't enough.
+			importFRaw, err := copystructure.Copy(importF)
+			if err != nil {
+				resultErrLock.Lock()
+				defer resultErrLock.Unlock()
+				resultErr = multierror.Append(resultErr, fmt.Errorf(
+					"Error copying import %s: %s", importF.ID, err))
+				return false
+			}
+			importF = importFRaw.(*File)
 			source := importF.ID
 			importF.ID = ""
 			importF.Path = ""
 
+			// Keep a copy to check whether the import changed anything
+			before, err := copystructure.Copy(f)
+			if err != nil {
+				resultErrLock.Lock()
+				defer resultErrLock.Unlock()
+				resultErr = multierror.Append(resultErr, fmt.Errorf(
+					"Error copying Appfile to merge import %s: %s", source, err))
+				return false
+			}
+
 			// Merge it into our file!
 			if err := f.Merge(importF); err != nil {
 				resultErrLock.Lock()
@@ -575,6 +2413,18 @@ func (c *Compiler) compileImports(root *File) error {
 					"Error merging import %s: %s", source, err))
 				return false
 			}
+
+			// An import that changes nothing is likely a mistake
+			if !mergeChanged(before.(*File), f) {
+				c.logf("[WARN] import %s in %s changed nothing", source, parent)
+				c.event(&CompileEventWarning{
+					Source: parent,
+					Message: fmt.Sprintf(
+						"Import '%s' didn't change anything when it was merged. It is\n"+
+							"either empty or everything in it is already set the same\n"+
+							"way, so it can likely be removed.", source),
+				})
+			}
 		}
 
 		return true
@@ -583,53 +2433,81 @@ func (c *Compiler) compileImports(root *File) error {
 	// downloadSingle is used to download a single import and parse the
 	// Appfile. This is a separate function because it is generally run
 	// in a goroutine so we can parallelize grabbing the imports.
+	//
+	// It is started holding a slot of the import semaphore, which it
+	// releases before loading nested imports so that they can't
+	// deadlock waiting on their parents.
 	downloadSingle = func(source string, wg *sync.WaitGroup, l *sync.Mutex, result []*File, idx int) {
 		defer wg.Done()
 
-		// Read from the cache if we have it
+		held := true
+		release := func() {
+			if held {
+				held = false
+				<-c.importSem
+			}
+		}
+		defer release()
+
+		// Read from the cache if we have it. Expired entries are
+		// fetched again rather than reusing the stored copy.
 		cacheLock.Lock()
-		cached, ok := cache[source]
+		cached, ok := cache.Get(source)
 		cacheLock.Unlock()
-		if ok {
-			log.Printf("[DEBUG] cache hit on import: %s", source)
+		expired := ok && c.importExpired(cached)
+		if ok && !expired {
+			c.logf("[DEBUG] cache hit on import: %s", source)
+			c.recordStat(&c.stats.ImportsCached, MetricImportsCached)
 			l.Lock()
 			defer l.Unlock()
-			result[idx] = cached
+			result[idx] = cached.File
 			return
 		}
-
-		// Call the callback if we have one
-		log.Printf("[DEBUG] loading import: %s", source)
-		if c.opts.Callback != nil {
-			c.opts.Callback(&CompileEventImport{
-				Source: source,
-			})
+		if expired {
+			c.logf("[DEBUG] cached import expired: %s", source)
 		}
 
-		// Download the dependency
-		if err := storage.Get(source, source, true); err != nil {
-			resultErrLock.Lock()
-			defer resultErrLock.Unlock()
-			resultErr = multierror.Append(resultErr, fmt.Errorf(
-				"Error loading import source: %s", err))
-			return
-		}
-		dir, _, err := storage.Dir(source)
-		if err != nil {
-			resultErrLock.Lock()
-			defer resultErrLock.Unlock()
-			resultErr = multierror.Append(resultErr, fmt.Errorf(
-				"Error loading import source: %s", err))
-			return
-		}
+		// Notify any listeners
+		c.logf("[DEBUG] loading import: %s", source)
+		c.event(&CompileEventImport{
+			Source: source,
+		})
+
+		// Download the import and parse the Appfile. We hold the lock on
+		// the source until it is parsed so that a concurrent compilation
+		// doesn't replace it while we read it.
+		_, span := c.startSpan(ctx, SpanImport)
+		span.SetTag(SpanTagSource, source)
+		importF, err := func() (*File, error) {
+			defer c.lockSource(source)()
+
+			dir, fetched, err := c.get(ctx, storage, source, c.update(ctx) || expired)
+			if err != nil {
+				return nil, fmt.Errorf(
+					"Error loading import source: %s", err)
+			}
+			if !fetched {
+				c.recordStat(&c.stats.ImportsCached, MetricImportsCached)
+			} else {
+				c.recordFetch(source, &c.stats.ImportsFetched, MetricImportsFetched)
+				if err := c.addDownloadSize(source, dir); err != nil {
+					return nil, err
+				}
+			}
+
+			importF, err := ParseFile(c.appfilePath(dir))
+			if err != nil {
+				return nil, fmt.Errorf(
+					"Error parsing Appfile in %s: %s", source, err)
+			}
 
-		// Parse the Appfile
-		importF, err := ParseFile(filepath.Join(dir, "Appfile"))
+			return importF, nil
+		}()
+		span.Finish(err)
 		if err != nil {
 			resultErrLock.Lock()
 			defer resultErrLock.Unlock()
-			resultErr = multierror.Append(resultErr, fmt.Errorf(
-				"Error parsing Appfile in %s: %s", source, err))
+			resultErr = multierror.Append(resultErr, err)
 			return
 		}
 
@@ -638,6 +2516,7 @@ func (c *Compiler) compileImports(root *File) error {
 		importF.ID = source
 
 		// Import the imports in this
+		release()
 		if !importSingle(source, importF) {
 			return
 		}
@@ -649,15 +2528,97 @@ func (c *Compiler) compileImports(root *File) error {
 
 		// Write this into the cache.
 		cacheLock.Lock()
-		cache[source] = importF
+		cache.Add(source, &importCacheEntry{File: importF, Time: time.Now()})
 		cacheLock.Unlock()
 	}
 
-	importSingle("root", root)
+	importSingle(source, root)
 	return resultErr
 }
 
+// appfilePath returns the path to the Appfile within the fetched
+// directory dir. If the configured Appfile doesn't exist, this falls back
+// to "Appfile" in dir, which may also not exist.
+func (c *Compiler) appfilePath(dir string) string {
+	fallback := filepath.Join(dir, "Appfile")
+	if c.opts.AppfileFilename == "" && c.opts.AppfileDir == "" {
+		return fallback
+	}
+
+	name := c.opts.AppfileFilename
+	if name == "" {
+		name = "Appfile"
+	}
+
+	path := filepath.Join(dir, c.opts.AppfileDir, name)
+	if _, err := os.Stat(path); err == nil {
+		return path
+	}
+
+	return fallback
+}
+
+// addDownloadSize adds the size of the fetched directory dir to the
+// total for this compilation and the downloaded bytes metric, and returns
+// an error if that exceeds MaxTotalBytes.
+func (c *Compiler) addDownloadSize(source, dir string) error {
+	if c.opts.MaxTotalBytes <= 0 && c.opts.Metrics == nil {
+		return nil
+	}
+
+	// Some getters (such as local files) symlink the directory, so
+	// resolve it so that we walk the real contents.
+	root, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return err
+	}
+
+	size, err := diskUsage(root)
+	if err != nil {
+		return fmt.Errorf(
+			"Error calculating size of %s: %s", source, err)
+	}
+	c.incCounter(MetricBytesDownloaded, size)
+
+	c.totalLock.Lock()
+	defer c.totalLock.Unlock()
+	c.totalBytes += size
+	c.logf("[DEBUG] fetched %d bytes for %s, %d bytes total",
+		size, source, c.totalBytes)
+	if c.opts.MaxTotalBytes > 0 && c.totalBytes > c.opts.MaxTotalBytes {
+		return fmt.Errorf(
+			"Downloaded dependencies and imports exceed the maximum total\n"+
+				"size of %d bytes (%d bytes so far) while loading %s.",
+			c.opts.MaxTotalBytes, c.totalBytes, source)
+	}
+
+	return nil
+}
+
+// diskUsage returns the total size of the regular files within the
+// given path. Symlinks are not followed.
+func diskUsage(path string) (int64, error) {
+	var size int64
+	err := filepath.Walk(path, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			size += info.Size()
+		}
+
+		return nil
+	})
+
+	return size, err
+}
+
 func compileVersion(dir string) error {
+	// The directory may have been removed by Clean
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
 	f, err := os.Create(filepath.Join(dir, CompileVersionFilename))
 	if err != nil {
 		return err
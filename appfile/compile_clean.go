@@ -0,0 +1,84 @@
+package appfile
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// CleanPolicy is what Compiler.Clean removes from the compilation
+// directory.
+type CleanPolicy string
+
+const (
+	// CleanCachesOnly removes the downloaded dependencies and imports but
+	// keeps the compiled Appfile and its version, so that anything that
+	// loads the compiled Appfile, such as a dev environment, keeps working.
+	// The dependencies and imports are downloaded again on the next
+	// compilation.
+	CleanCachesOnly CleanPolicy = "caches-only"
+
+	// CleanAll removes everything that the Compiler writes: the downloaded
+	// dependencies and imports, the compiled Appfile and its version. Any
+	// other files in the compilation directory are kept.
+	CleanAll CleanPolicy = "all"
+
+	// CleanEverything removes the compilation directory itself.
+	CleanEverything CleanPolicy = "everything"
+)
+
+// errCleanRunning is returned by Clean if a compilation is running.
+var errCleanRunning = errors.New(
+	"can't clean the compilation directory while a compilation is running")
+
+// Clean removes files from the compilation directory according to the
+// given policy and clears the in-memory caches of the Compiler. Files
+// that don't exist are ignored.
+//
+// Clean returns an error if a compilation is running. Compilations that
+// start while Clean is running wait for it to finish.
+func (c *Compiler) Clean(policy CleanPolicy) error {
+	var paths []string
+	switch policy {
+	case CleanCachesOnly:
+		paths = c.cachePaths()
+	case CleanAll:
+		paths = append(c.cachePaths(),
+			filepath.Join(c.opts.Dir, CompileFilename),
+			filepath.Join(c.opts.Dir, CompileVersionFilename))
+	case CleanEverything:
+		paths = []string{c.opts.Dir}
+	default:
+		return fmt.Errorf("unknown clean policy: %q", policy)
+	}
+
+	// Hold the run lock so that no compilation starts while we clean
+	c.runLock.Lock()
+	defer c.runLock.Unlock()
+	if c.running > 0 {
+		return errCleanRunning
+	}
+
+	c.resetCaches()
+	for _, path := range paths {
+		c.logf("[DEBUG] clean %s: removing %s", policy, path)
+		if err := os.RemoveAll(path); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// cachePaths returns the folders that the dependencies and imports are
+// stored in. The folders may be the same, so each is only returned once.
+func (c *Compiler) cachePaths() []string {
+	deps := filepath.Join(c.opts.Dir, CompileDepsFolder)
+	imports := filepath.Join(c.opts.Dir, CompileImportsFolder)
+	if deps == imports {
+		return []string{deps}
+	}
+
+	return []string{deps, imports}
+}
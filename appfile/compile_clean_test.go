@@ -0,0 +1,95 @@
+package appfile
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCompilerClean(t *testing.T) {
+	cases := []struct {
+		Policy  CleanPolicy
+		Kept    []string
+		Removed []string
+	}{
+		{
+			CleanCachesOnly,
+			[]string{CompileFilename, CompileVersionFilename, "other"},
+			[]string{CompileDepsFolder},
+		},
+		{
+			CleanAll,
+			[]string{"other"},
+			[]string{CompileFilename, CompileVersionFilename, CompileDepsFolder},
+		},
+		{
+			CleanEverything,
+			nil,
+			[]string{""},
+		},
+	}
+
+	for _, tc := range cases {
+		opts := testCompileOpts(t)
+		defer os.RemoveAll(opts.Dir)
+
+		f := testFile(t, "compile-deps")
+		compiler := testCompiler(t, opts)
+		_, err := compiler.Compile(f)
+		f.resetID()
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		other := filepath.Join(opts.Dir, "other")
+		if err := ioutil.WriteFile(other, []byte("hello"), 0644); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		if err := compiler.Clean(tc.Policy); err != nil {
+			t.Fatalf("%s: err: %s", tc.Policy, err)
+		}
+
+		for _, name := range tc.Kept {
+			if _, err := os.Stat(filepath.Join(opts.Dir, name)); err != nil {
+				t.Fatalf("%s: should keep %s: %s", tc.Policy, name, err)
+			}
+		}
+		for _, name := range tc.Removed {
+			_, err := os.Stat(filepath.Join(opts.Dir, name))
+			if !os.IsNotExist(err) {
+				t.Fatalf("%s: should remove %s: %s", tc.Policy, name, err)
+			}
+		}
+
+		// Compiling again restores everything
+		f = testFile(t, "compile-deps")
+		_, err = compiler.Compile(f)
+		f.resetID()
+		if err != nil {
+			t.Fatalf("%s: err: %s", tc.Policy, err)
+		}
+	}
+}
+
+func TestCompilerClean_unknown(t *testing.T) {
+	opts := testCompileOpts(t)
+	defer os.RemoveAll(opts.Dir)
+
+	if err := testCompiler(t, opts).Clean("bad"); err == nil {
+		t.Fatal("should error")
+	}
+}
+
+func TestCompilerClean_running(t *testing.T) {
+	opts := testCompileOpts(t)
+	defer os.RemoveAll(opts.Dir)
+
+	compiler := testCompiler(t, opts)
+	compiler.begin()
+	defer compiler.end()
+	if err := compiler.Clean(CleanCachesOnly); err != errCleanRunning {
+		t.Fatalf("bad: %v", err)
+	}
+}
@@ -0,0 +1,142 @@
+package appfile
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// The kinds of the edges in a CycleError.
+const (
+	CycleEdgeImport     = "imports"
+	CycleEdgeDependency = "depends on"
+)
+
+// CycleError is the error when the imports and dependencies of an Appfile
+// form a cycle. A cycle can be made of only imports, only dependencies,
+// or a mix of both, such as a dependency that imports the Appfile that
+// depends on it.
+type CycleError struct {
+	// Edges are the edges of the cycle in order. The To of the last edge
+	// is the From of the first.
+	Edges []*CycleEdge
+}
+
+// CycleEdge is a single import or dependency in a CycleError.
+type CycleEdge struct {
+	// From and To are the resolved sources of the Appfiles.
+	From string
+	To   string
+
+	// Kind is CycleEdgeImport or CycleEdgeDependency.
+	Kind string
+}
+
+func (e *CycleError) Error() string {
+	var buf bytes.Buffer
+	buf.WriteString("Cycle found:")
+	for i, edge := range e.Edges {
+		if i == 0 {
+			buf.WriteString("\n\n  " + edge.From)
+		}
+		buf.WriteString(fmt.Sprintf("\n    %s %s", edge.Kind, edge.To))
+	}
+
+	return buf.String()
+}
+
+// sourceGraph is the graph of the imports and dependencies between the
+// Appfiles in a single compilation, keyed by their resolved sources. It
+// is used to detect cycles across both kinds of edges.
+type sourceGraph struct {
+	lock  sync.Mutex
+	edges map[string]map[string]string
+}
+
+func newSourceGraph() *sourceGraph {
+	return &sourceGraph{edges: make(map[string]map[string]string)}
+}
+
+type sourceGraphKey struct{}
+
+// withSourceGraph returns a context with a new sourceGraph.
+func withSourceGraph(ctx context.Context) context.Context {
+	return context.WithValue(ctx, sourceGraphKey{}, newSourceGraph())
+}
+
+// sourceGraphFrom returns the sourceGraph in ctx. If there isn't one, a
+// new graph is returned, which only covers what it is given.
+func sourceGraphFrom(ctx context.Context) *sourceGraph {
+	if g, ok := ctx.Value(sourceGraphKey{}).(*sourceGraph); ok {
+		return g
+	}
+
+	return newSourceGraph()
+}
+
+// Connect adds an edge of the given kind from one source to another. If
+// the edge completes a cycle, the edge isn't added and a *CycleError is
+// returned.
+func (g *sourceGraph) Connect(from, to, kind string) error {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	if path := g.path(to, from); path != nil || from == to {
+		edges := append(
+			[]*CycleEdge{{From: from, To: to, Kind: kind}}, path...)
+		return &CycleError{Edges: edges}
+	}
+
+	if g.edges[from] == nil {
+		g.edges[from] = make(map[string]string)
+	}
+	if _, ok := g.edges[from][to]; !ok {
+		g.edges[from][to] = kind
+	}
+
+	return nil
+}
+
+// path returns the edges of the shortest path from one source to another,
+// or nil if there isn't a path. The lock must be held.
+func (g *sourceGraph) path(from, to string) []*CycleEdge {
+	prev := map[string]*CycleEdge{from: nil}
+	queue := []string{from}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		if current == to && current != from {
+			break
+		}
+
+		// Visit in order so the path is the same every time
+		targets := make([]string, 0, len(g.edges[current]))
+		for target := range g.edges[current] {
+			targets = append(targets, target)
+		}
+		sort.Strings(targets)
+
+		for _, target := range targets {
+			if _, ok := prev[target]; ok {
+				continue
+			}
+
+			prev[target] = &CycleEdge{
+				From: current, To: target, Kind: g.edges[current][target]}
+			queue = append(queue, target)
+		}
+	}
+
+	if prev[to] == nil {
+		return nil
+	}
+
+	var result []*CycleEdge
+	for e := prev[to]; e != nil; e = prev[e.From] {
+		result = append([]*CycleEdge{e}, result...)
+	}
+
+	return result
+}
@@ -0,0 +1,64 @@
+package appfile
+
+import (
+	"context"
+	"sync"
+
+	"github.com/hashicorp/go-getter"
+)
+
+// downloadSession tracks the sources that were downloaded during a single
+// compilation, so that each source is downloaded at most once per
+// compilation even when CompileOpts.Update is set. This matters when many
+// dependencies and imports are in subdirectories of the same repository,
+// since they're all stored in a single download of it.
+type downloadSession struct {
+	lock       sync.Mutex
+	downloaded map[downloadKey]struct{}
+}
+
+// downloadKey is a source that was downloaded into a storage.
+type downloadKey struct {
+	Storage getter.Storage
+	Source  string
+}
+
+type downloadSessionKey struct{}
+
+// withDownloadSession returns a context with a new downloadSession.
+func withDownloadSession(ctx context.Context) context.Context {
+	return context.WithValue(ctx, downloadSessionKey{}, &downloadSession{
+		downloaded: make(map[downloadKey]struct{}),
+	})
+}
+
+// downloadSessionFrom returns the downloadSession in ctx. If there isn't
+// one, this returns nil, which never reports a source as downloaded.
+func downloadSessionFrom(ctx context.Context) *downloadSession {
+	s, _ := ctx.Value(downloadSessionKey{}).(*downloadSession)
+	return s
+}
+
+// Downloaded returns true if the source was already downloaded into the
+// storage during this session.
+func (s *downloadSession) Downloaded(storage getter.Storage, source string) bool {
+	if s == nil {
+		return false
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	_, ok := s.downloaded[downloadKey{Storage: storage, Source: source}]
+	return ok
+}
+
+// Add records that the source was downloaded into the storage.
+func (s *downloadSession) Add(storage getter.Storage, source string) {
+	if s == nil {
+		return
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.downloaded[downloadKey{Storage: storage, Source: source}] = struct{}{}
+}
@@ -0,0 +1,379 @@
+package appfile
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/go-getter"
+)
+
+func TestCompile_downloadOnce(t *testing.T) {
+	opts := testCompileOpts(t)
+	defer os.RemoveAll(opts.Dir)
+
+	g := &testGetter{FileGetter: new(getter.FileGetter)}
+	opts.Getters = DefaultGetters()
+	opts.Getters["test"] = g
+	opts.Update = true
+
+	f := testFile(t, "compile-deps-subdir-shared")
+	defer f.resetID()
+	c := testCompiler(t, opts)
+
+	// Both dependencies are in the same repository, which is only
+	// downloaded once per compilation even though we're updating.
+	for i := 1; i <= 2; i++ {
+		if _, err := c.Compile(f); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if len(g.Gets) != i {
+			t.Fatalf("%d bad: %#v", i, g.Gets)
+		}
+	}
+
+	stats, err := c.Stats()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if stats.DepsFetched != 1 || stats.DepsCached != 1 {
+		t.Fatalf("bad: %#v", stats)
+	}
+}
+
+func TestCompile_sharedDeps(t *testing.T) {
+	// Warm the shared cache with a separate compilation
+	shared := testCompileOpts(t)
+	defer os.RemoveAll(shared.Dir)
+	shared.Getters = DefaultGetters()
+	shared.Getters["test"] = &testGetter{FileGetter: new(getter.FileGetter)}
+
+	f := testFile(t, "compile-deps-getter")
+	defer f.resetID()
+	if _, err := testCompiler(t, shared).Compile(f); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	for _, update := range []bool{false, true} {
+		opts := testCompileOpts(t)
+		defer os.RemoveAll(opts.Dir)
+
+		g := &testGetter{FileGetter: new(getter.FileGetter)}
+		opts.Getters = DefaultGetters()
+		opts.Getters["test"] = g
+		opts.SharedDepsDir = filepath.Join(shared.Dir, CompileDepsFolder)
+		opts.Update = update
+
+		c := testCompiler(t, opts)
+		if _, err := c.Compile(f); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		// The shared copy is used unless we're updating, in which case
+		// the dependency is downloaded into our own storage.
+		expected := 0
+		if update {
+			expected = 1
+		}
+		if len(g.Gets) != expected {
+			t.Fatalf("%v bad: %#v", update, g.Gets)
+		}
+
+		stats, err := c.Stats()
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if stats.DepsFetched != expected {
+			t.Fatalf("%v bad: %#v", update, stats)
+		}
+	}
+}
+
+func BenchmarkCompile_gitDeps(b *testing.B) {
+	if !testHasGit {
+		b.Skip("git not found")
+	}
+
+	dir, err := ioutil.TempDir("", "otto-")
+	if err != nil {
+		b.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// 50 dependencies in their own repositories, and 50 dependencies in
+	// subdirectories of a single repository.
+	files := map[string]*File{
+		"repos":    testGitDeps(b, filepath.Join(dir, "repos"), 50, false),
+		"monorepo": testGitDeps(b, filepath.Join(dir, "monorepo"), 50, true),
+	}
+
+	for _, name := range []string{"repos", "monorepo"} {
+		b.Run(name, func(b *testing.B) {
+			opts := &CompileOpts{
+				Dir:    filepath.Join(dir, "compile-"+name),
+				Logger: log.New(ioutil.Discard, "", 0),
+				Update: true,
+			}
+			c, err := NewCompiler(opts)
+			if err != nil {
+				b.Fatalf("err: %s", err)
+			}
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := c.Compile(files[name]); err != nil {
+					b.Fatalf("err: %s", err)
+				}
+			}
+		})
+	}
+}
+
+// testGitDeps creates n dependencies with an Appfile each in dir and
+// returns an Appfile that depends on all of them. Each dependency is a
+// Git repository, or a subdirectory of a single repository if mono is set.
+func testGitDeps(tb testing.TB, dir string, n int, mono bool) *File {
+	var buf bytes.Buffer
+	buf.WriteString("application {\n  name = \"root\"\n  type = \"bar\"\n")
+	for i := 0; i < n; i++ {
+		name := fmt.Sprintf("dep%d", i)
+		repo, sub := filepath.Join(dir, name), ""
+		if mono {
+			repo, sub = filepath.Join(dir, "repo"), "//"+name
+		}
+
+		path := filepath.Join(dir, name)
+		if mono {
+			path = filepath.Join(repo, name)
+		}
+		if err := os.MkdirAll(path, 0755); err != nil {
+			tb.Fatalf("err: %s", err)
+		}
+
+		files := map[string]string{
+			"Appfile": fmt.Sprintf(testGitDepAppfile, name),
+			IDFile:    fmt.Sprintf("00000000-0000-0000-0000-%012d\n", i),
+		}
+		for name, data := range files {
+			err := ioutil.WriteFile(filepath.Join(path, name), []byte(data), 0644)
+			if err != nil {
+				tb.Fatalf("err: %s", err)
+			}
+		}
+
+		if !mono {
+			testGitCommit(tb, repo)
+		}
+		fmt.Fprintf(&buf, "  dependency { source = \"git::file://%s%s\" }\n",
+			filepath.ToSlash(repo), sub)
+	}
+	buf.WriteString("}\n" + testGitDepProject)
+	if mono {
+		testGitCommit(tb, filepath.Join(dir, "repo"))
+	}
+
+	path := filepath.Join(dir, "Appfile")
+	if err := ioutil.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		tb.Fatalf("err: %s", err)
+	}
+	f, err := ParseFile(path)
+	if err != nil {
+		tb.Fatalf("err: %s", err)
+	}
+
+	return f
+}
+
+// testGitCommit creates a Git repository in dir with all of its contents
+// committed.
+func testGitCommit(tb testing.TB, dir string) {
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"add", "."},
+		{"-c", "user.name=otto", "-c", "user.email=otto@example.com",
+			"commit", "-q", "-m", "init"},
+	} {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			tb.Fatalf("err: %s\n\n%s", err, out)
+		}
+	}
+}
+
+const testGitDepAppfile = `
+application {
+  name = "%s"
+  type = "bar"
+}
+` + testGitDepProject
+
+const testGitDepProject = `
+project {
+  name = "foo"
+  infrastructure = "aws"
+}
+
+infrastructure "aws" {}
+`
+
+func TestCompile_archiveDep(t *testing.T) {
+	dir, err := ioutil.TempDir("", "otto")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// A release archive with the Appfile under a versioned folder
+	testZip(t, filepath.Join(dir, "child-1.2.0.zip"), map[string]string{
+		"child-1.2.0/Appfile":   fmt.Sprintf(testGitDepAppfile, "child"),
+		"child-1.2.0/" + IDFile: "00000000-0000-0000-0000-000000000001\n",
+	})
+	ts := httptest.NewServer(http.FileServer(http.Dir(dir)))
+	defer ts.Close()
+
+	cases := []struct {
+		Subdir string
+		Err    string
+	}{
+		{"//child-1.2.0", ""},
+		{"//child-*", ""},
+
+		// Without the subdirectory, the error points at it
+		{"", `adding "//child-1.2.0" to the end of the source`},
+	}
+
+	for _, tc := range cases {
+		path := filepath.Join(dir, "Appfile")
+		data := fmt.Sprintf(
+			"application {\n  name = \"root\"\n  type = \"bar\"\n"+
+				"  dependency { source = \"%s/child-1.2.0.zip%s\" }\n}\n%s",
+			ts.URL, tc.Subdir, testGitDepProject)
+		if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		f, err := ParseFile(path)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		opts := testCompileOpts(t)
+		defer os.RemoveAll(opts.Dir)
+		c, err := testCompiler(t, opts).Compile(f)
+		if tc.Err != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.Err) {
+				t.Fatalf("%q: err: %v", tc.Subdir, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%q: err: %s", tc.Subdir, err)
+		}
+
+		var names []string
+		for _, raw := range c.Graph.Vertices() {
+			names = append(names, raw.(*CompiledGraphVertex).File.Application.Name)
+		}
+		sort.Strings(names)
+		if !reflect.DeepEqual(names, []string{"child", "root"}) {
+			t.Fatalf("%q: bad: %#v", tc.Subdir, names)
+		}
+	}
+}
+
+func TestCompile_networkUsed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "otto")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	testZip(t, filepath.Join(dir, "child.zip"), map[string]string{
+		"Appfile": fmt.Sprintf(testGitDepAppfile, "child"),
+		IDFile:    "00000000-0000-0000-0000-000000000001\n",
+	})
+	ts := httptest.NewServer(http.FileServer(http.Dir(dir)))
+	defer ts.Close()
+
+	path := filepath.Join(dir, "Appfile")
+	data := fmt.Sprintf(
+		"application {\n  name = \"root\"\n  type = \"bar\"\n"+
+			"  dependency { source = \"%s/child.zip\" }\n}\n%s",
+		ts.URL, testGitDepProject)
+	if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	remote, err := ParseFile(path)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	opts := testCompileOpts(t)
+	defer os.RemoveAll(opts.Dir)
+	c := testCompiler(t, opts)
+
+	local := testFile(t, "compile-deps")
+	defer local.resetID()
+
+	cases := []struct {
+		File        *File
+		Fetched     int
+		NetworkUsed bool
+	}{
+		// Local dependencies don't need the network
+		{local, 1, false},
+
+		// The first compilation downloads the archive, and the
+		// second uses the stored copy.
+		{remote, 1, true},
+		{remote, 0, false},
+	}
+
+	for i, tc := range cases {
+		if _, err := c.Compile(tc.File); err != nil {
+			t.Fatalf("%d: err: %s", i, err)
+		}
+
+		stats, err := c.Stats()
+		if err != nil {
+			t.Fatalf("%d: err: %s", i, err)
+		}
+		if stats.DepsFetched != tc.Fetched || stats.NetworkUsed != tc.NetworkUsed {
+			t.Fatalf("%d: bad: %#v", i, stats)
+		}
+	}
+}
+
+// testZip writes a zip archive to path with the given files, keyed by
+// their slash-separated path within the archive.
+func testZip(tb testing.TB, path string, files map[string]string) {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for name, data := range files {
+		fw, err := w.Create(name)
+		if err != nil {
+			tb.Fatalf("err: %s", err)
+		}
+		if _, err := fw.Write([]byte(data)); err != nil {
+			tb.Fatalf("err: %s", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		tb.Fatalf("err: %s", err)
+	}
+
+	if err := ioutil.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		tb.Fatalf("err: %s", err)
+	}
+}
@@ -0,0 +1,94 @@
+package appfile
+
+import (
+	"fmt"
+	"strings"
+)
+
+// The errors below are returned when a dependency can't be loaded, so
+// that callers can tell why, for example to retry only network failures.
+// They are wrapped in a DependencyChainError and a CompileError, so use
+// errors.As to find them:
+//
+//	var perr *DependencyParseError
+//	if errors.As(err, &perr) {
+//		// perr.Source is the dependency that failed to parse
+//	}
+
+// DependencyFetchError is the error when a dependency can't be downloaded.
+type DependencyFetchError struct {
+	// Source is the detected source of the dependency.
+	Source string
+	Err    error
+}
+
+func (e *DependencyFetchError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *DependencyFetchError) Unwrap() error {
+	return e.Err
+}
+
+// DependencyParseError is the error when the Appfile of a dependency was
+// downloaded but can't be parsed.
+type DependencyParseError struct {
+	// Source is the detected source of the dependency.
+	Source string
+	Err    error
+}
+
+func (e *DependencyParseError) Error() string {
+	return fmt.Sprintf("Error parsing Appfile in %s: %s", e.Source, e.Err)
+}
+
+func (e *DependencyParseError) Unwrap() error {
+	return e.Err
+}
+
+// MissingIDError is the error when a dependency doesn't have an Otto ID,
+// unless that is allowed with CompileOpts.AllowMissingDepID.
+type MissingIDError struct {
+	// Source is the detected source of the dependency.
+	Source string
+
+	// IDFile is the path relative to the Appfile of the dependency where
+	// its Otto ID should be stored. If this is empty, IDFile is used.
+	IDFile string
+}
+
+func (e *MissingIDError) Error() string {
+	idFile := e.IDFile
+	if idFile == "" {
+		idFile = IDFile
+	}
+
+	return fmt.Sprintf(
+		"Dependency '%s' doesn't have an Otto ID yet!\n\n"+
+			"An Otto ID is generated on the first compilation of the Appfile.\n"+
+			"It is a globally unique ID that is used to track the application\n"+
+			"across multiple deploys. It is required for the application to be\n"+
+			"used as a dependency. To fix this, check out that application and\n"+
+			"compile the Appfile with `otto compile` once. Make sure you commit\n"+
+			"the %s file into version control, and then try this command\n"+
+			"again.",
+		e.Source, idFile)
+}
+
+// DependencyChainError wraps an error loading a dependency with the chain
+// of dependencies from the root Appfile that led to it.
+type DependencyChainError struct {
+	// Chain is the names of the applications from the root to the
+	// dependency, which is the source if it wasn't loaded.
+	Chain []string
+	Err   error
+}
+
+func (e *DependencyChainError) Error() string {
+	return fmt.Sprintf(
+		"%s\n\nDependency chain: %s", e.Err, strings.Join(e.Chain, " -> "))
+}
+
+func (e *DependencyChainError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,87 @@
+package appfile
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCompile_dependencyErrors(t *testing.T) {
+	cases := []struct {
+		Dir    string
+		Type   string
+		Prefix string
+	}{
+		{"compile-deps-no-getter", "fetch", "no getter for"},
+		{"compile-deps-parse", "parse", "Error parsing Appfile in "},
+		{"compile-deps-missing-id", "id", "Dependency '"},
+	}
+
+	for _, tc := range cases {
+		opts := testCompileOpts(t)
+		defer os.RemoveAll(opts.Dir)
+
+		f := testFile(t, tc.Dir)
+		defer f.resetID()
+		_, err := testCompiler(t, opts).Compile(f)
+		if err == nil {
+			t.Fatalf("%s: should error", tc.Dir)
+		}
+
+		var fetchErr *DependencyFetchError
+		var parseErr *DependencyParseError
+		var idErr *MissingIDError
+		source := ""
+		switch {
+		case errors.As(err, &fetchErr) && tc.Type == "fetch":
+			source = fetchErr.Source
+		case errors.As(err, &parseErr) && tc.Type == "parse":
+			source = parseErr.Source
+		case errors.As(err, &idErr) && tc.Type == "id":
+			source = idErr.Source
+		default:
+			t.Fatalf("%s: bad error type: %#v", tc.Dir, err)
+		}
+		if source == "" {
+			t.Fatalf("%s: no source", tc.Dir)
+		}
+
+		// The message is unchanged, followed by the chain
+		if !strings.HasPrefix(err.Error(), tc.Prefix) ||
+			!strings.Contains(err.Error(), "\n\nDependency chain: foo -> ") {
+			t.Fatalf("%s: bad: %s", tc.Dir, err)
+		}
+
+		var chain *DependencyChainError
+		if !errors.As(err, &chain) || len(chain.Chain) != 2 {
+			t.Fatalf("%s: bad chain: %#v", tc.Dir, chain)
+		}
+	}
+}
+
+func TestCompile_missingIDFilename(t *testing.T) {
+	opts := testCompileOpts(t)
+	opts.IDFilename = filepath.Join(".otto", "id")
+	defer os.RemoveAll(opts.Dir)
+
+	f := testFile(t, "compile-deps-missing-id")
+	defer os.RemoveAll(filepath.Join(filepath.Dir(f.Path), ".otto"))
+	_, err := testCompiler(t, opts).Compile(f)
+
+	var idErr *MissingIDError
+	if !errors.As(err, &idErr) {
+		t.Fatalf("bad: %#v", err)
+	}
+	if idErr.IDFile != opts.IDFilename {
+		t.Fatalf("bad: %s", idErr.IDFile)
+	}
+
+	// The message names the configured ID file
+	expected := fmt.Sprintf("the %s file into version control", opts.IDFilename)
+	if !strings.Contains(err.Error(), expected) {
+		t.Fatalf("bad: %s", err)
+	}
+}
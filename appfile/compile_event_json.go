@@ -0,0 +1,100 @@
+package appfile
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// CompileEventJSON is the JSON encoding of a CompileEvent written to
+// CompileOpts.EventWriter. Each event is written as a single line.
+//
+// Type is one of "start", "dep", "import", "plan", "progress", "warning",
+// "finish" or "error".
+// Fields that don't apply to an event type, or that are zero, are omitted.
+type CompileEventJSON struct {
+	Type   string `json:"type"`
+	Source string `json:"source,omitempty"`
+
+	// Name is set for "start" and "finish" events, and Fresh is set for
+	// "start" events.
+	Name  string `json:"name,omitempty"`
+	Fresh bool   `json:"fresh,omitempty"`
+
+	// Message is set for "warning" and "error" events.
+	Message string `json:"message,omitempty"`
+
+	// Bytes, Total and ETA are set for "progress" events. ETA is the
+	// estimated number of seconds remaining.
+	Bytes int64   `json:"bytes,omitempty"`
+	Total int64   `json:"total,omitempty"`
+	ETA   float64 `json:"eta,omitempty"`
+
+	// Duration is set for "finish" events. It is the number of seconds
+	// that the compilation took.
+	Duration float64 `json:"duration,omitempty"`
+
+	// DirectDeps, Imports and TotalDeps are set for "plan" events.
+	DirectDeps int `json:"direct_deps,omitempty"`
+	Imports    int `json:"imports,omitempty"`
+	TotalDeps  int `json:"total_deps,omitempty"`
+}
+
+// writeEventJSON writes the event to the writer as a line of JSON.
+func writeEventJSON(w io.Writer, raw CompileEvent) error {
+	e, err := encodeEventJSON(raw)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// encodeEventJSON converts the event to its JSON encoding.
+func encodeEventJSON(raw CompileEvent) (*CompileEventJSON, error) {
+	var e CompileEventJSON
+	switch v := raw.(type) {
+	case *CompileEventStart:
+		e.Type = "start"
+		e.Name = v.Name
+		e.Fresh = v.Fresh
+	case *CompileEventDep:
+		e.Type = "dep"
+		e.Source = v.Source
+	case *CompileEventImport:
+		e.Type = "import"
+		e.Source = v.Source
+	case *CompileEventPlan:
+		e.Type = "plan"
+		e.DirectDeps = v.DirectDeps
+		e.Imports = v.Imports
+		e.TotalDeps = v.TotalDeps
+	case *CompileEventProgress:
+		e.Type = "progress"
+		e.Source = v.Source
+		e.Bytes = v.Bytes
+		e.Total = v.Total
+		e.ETA = v.ETA.Seconds()
+	case *CompileEventWarning:
+		e.Type = "warning"
+		e.Source = v.Source
+		e.Message = v.Message
+	case *CompileEventFinish:
+		e.Type = "finish"
+		e.Name = v.Name
+		e.Duration = v.Duration.Seconds()
+	case *CompileEventError:
+		e.Type = "error"
+		e.Message = v.Err.Error()
+	default:
+		return nil, fmt.Errorf("unknown compile event type: %T", raw)
+	}
+
+	return &e, nil
+}
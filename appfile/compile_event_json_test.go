@@ -0,0 +1,125 @@
+package appfile
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteEventJSON(t *testing.T) {
+	cases := []struct {
+		Event  CompileEvent
+		Output string
+		Err    bool
+	}{
+		{
+			&CompileEventStart{Name: "foo", Fresh: true},
+			`{"type":"start","name":"foo","fresh":true}`,
+			false,
+		},
+
+		{
+			&CompileEventDep{Source: "foo"},
+			`{"type":"dep","source":"foo"}`,
+			false,
+		},
+
+		{
+			&CompileEventImport{Source: "foo"},
+			`{"type":"import","source":"foo"}`,
+			false,
+		},
+
+		{
+			&CompileEventPlan{DirectDeps: 2, Imports: 1, TotalDeps: 3},
+			`{"type":"plan","direct_deps":2,"imports":1,"total_deps":3}`,
+			false,
+		},
+
+		{
+			&CompileEventProgress{
+				Source: "foo",
+				Bytes:  5,
+				Total:  10,
+				ETA:    1500 * time.Millisecond,
+			},
+			`{"type":"progress","source":"foo","bytes":5,"total":10,"eta":1.5}`,
+			false,
+		},
+
+		{
+			&CompileEventWarning{Source: "foo", Message: "bar"},
+			`{"type":"warning","source":"foo","message":"bar"}`,
+			false,
+		},
+
+		{
+			&CompileEventFinish{Name: "foo", Duration: 1500 * time.Millisecond},
+			`{"type":"finish","name":"foo","duration":1.5}`,
+			false,
+		},
+
+		{
+			&CompileEventError{Err: errors.New("bar")},
+			`{"type":"error","message":"bar"}`,
+			false,
+		},
+
+		{
+			"nope",
+			"",
+			true,
+		},
+	}
+
+	for _, tc := range cases {
+		var buf bytes.Buffer
+		err := writeEventJSON(&buf, tc.Event)
+		if (err != nil) != tc.Err {
+			t.Fatalf("%#v err: %s", tc.Event, err)
+		}
+
+		expected := tc.Output
+		if expected != "" {
+			expected += "\n"
+		}
+		if buf.String() != expected {
+			t.Fatalf("%#v bad: %s", tc.Event, buf.String())
+		}
+	}
+}
+
+func TestCompile_eventWriter(t *testing.T) {
+	var buf bytes.Buffer
+	opts := testCompileOpts(t)
+	opts.EventWriter = &buf
+	defer os.RemoveAll(opts.Dir)
+
+	f := testFile(t, "compile-multi-dep")
+	defer f.resetID()
+	if _, err := testCompiler(t, opts).Compile(f); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 5 {
+		t.Fatalf("bad: %s", buf.String())
+	}
+	if lines[0] != `{"type":"start","name":"foo","fresh":true}` {
+		t.Fatalf("bad: %s", lines[0])
+	}
+	if lines[1] != `{"type":"plan","direct_deps":2,"total_deps":2}` {
+		t.Fatalf("bad: %s", lines[1])
+	}
+	if !strings.HasPrefix(lines[4], `{"type":"finish","name":"foo","duration":`) {
+		t.Fatalf("bad: %s", lines[4])
+	}
+	for _, line := range lines[2:4] {
+		if !strings.HasPrefix(line, `{"type":"dep","source":"file://`) {
+			t.Fatalf("bad: %s", line)
+		}
+	}
+}
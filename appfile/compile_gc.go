@@ -0,0 +1,142 @@
+package appfile
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/hashicorp/go-getter"
+)
+
+// GC removes the cached dependencies and imports in the compilation
+// directory that aren't used by the given compiled Appfile, returning
+// the number of bytes freed.
+//
+// The imports that are in use are tracked during compilation, so this
+// must be called with the Compiler that compiled the given Appfile.
+func (c *Compiler) GC(compiled *Compiled) (int64, error) {
+	_, freed, err := c.gc(compiled, false)
+	return freed, err
+}
+
+// GCDryRun is like GC, but only returns the paths that would be removed
+// and the number of bytes that would be freed, without removing anything.
+func (c *Compiler) GCDryRun(compiled *Compiled) ([]string, int64, error) {
+	return c.gc(compiled, true)
+}
+
+func (c *Compiler) gc(compiled *Compiled, dryRun bool) ([]string, int64, error) {
+	// Determine all the paths that are in use
+	live := make(map[string]struct{})
+	for _, raw := range compiled.Graph.Vertices() {
+		v := raw.(*CompiledGraphVertex)
+		if v.File == nil || v.File.Source == "" {
+			continue
+		}
+
+		if err := gcLive(live, c.depStorage, v.File.Source); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	c.importLock.Lock()
+	for _, key := range c.importCache.Keys() {
+		if err := gcLive(live, c.importStorage, key); err != nil {
+			c.importLock.Unlock()
+			return nil, 0, err
+		}
+	}
+	c.importLock.Unlock()
+
+	// Find everything that is stored. The dependency and import storage
+	// may share the same directory, so we dedup the candidates.
+	candidates := make(map[string]struct{})
+	for _, s := range []getter.Storage{c.depStorage, c.importStorage} {
+		paths, err := gcCandidates(s)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		for _, p := range paths {
+			candidates[p] = struct{}{}
+		}
+	}
+
+	var removed []string
+	var freed int64
+	for p := range candidates {
+		if _, ok := live[p]; ok {
+			continue
+		}
+
+		size, err := diskUsage(p)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		if !dryRun {
+			c.logf("[DEBUG] gc: removing %s (%d bytes)", p, size)
+			if err := os.RemoveAll(p); err != nil {
+				return nil, 0, err
+			}
+		}
+
+		removed = append(removed, p)
+		freed += size
+	}
+
+	sort.Strings(removed)
+	return removed, freed, nil
+}
+
+// gcLive marks the paths used by the given key in the storage as live.
+func gcLive(live map[string]struct{}, s getter.Storage, key string) error {
+	dir, ok, err := s.Dir(key)
+	if err != nil {
+		return err
+	}
+	if ok {
+		live[filepath.Clean(dir)] = struct{}{}
+	}
+
+	// Content storage also stores the mapping from key to contents
+	if cs, ok := s.(*ContentStorage); ok {
+		live[filepath.Clean(cs.keyPath(key))] = struct{}{}
+	}
+
+	return nil
+}
+
+// gcCandidates returns all the paths stored by the given storage that
+// can be removed if they aren't live.
+func gcCandidates(s getter.Storage) ([]string, error) {
+	var dirs []string
+	switch s := s.(type) {
+	case *getter.FolderStorage:
+		dirs = []string{s.StorageDir}
+	case *ContentStorage:
+		dirs = []string{
+			filepath.Join(s.StorageDir, "content"),
+			filepath.Join(s.StorageDir, "keys"),
+		}
+	}
+
+	var result []string
+	for _, dir := range dirs {
+		infos, err := ioutil.ReadDir(dir)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+
+			return nil, err
+		}
+
+		for _, info := range infos {
+			result = append(result, filepath.Clean(filepath.Join(dir, info.Name())))
+		}
+	}
+
+	return result, nil
+}
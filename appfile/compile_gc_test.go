@@ -0,0 +1,79 @@
+package appfile
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/hashicorp/terraform/dag"
+)
+
+func TestCompilerGC(t *testing.T) {
+	opts := testCompileOpts(t)
+	defer os.RemoveAll(opts.Dir)
+
+	f := testFile(t, "import-dep")
+	defer f.resetID()
+	compiler := testCompiler(t, opts)
+	c, err := compiler.Compile(f)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Create a cached directory that isn't used
+	stale := filepath.Join(opts.Dir, CompileDepsFolder, "stale")
+	if err := os.MkdirAll(stale, 0755); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	data := []byte("hello")
+	if err := ioutil.WriteFile(filepath.Join(stale, "Appfile"), data, 0644); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// A dry run should only list it
+	removed, freed, err := compiler.GCDryRun(c)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !reflect.DeepEqual(removed, []string{stale}) {
+		t.Fatalf("bad: %#v", removed)
+	}
+	if freed != int64(len(data)) {
+		t.Fatalf("bad: %d", freed)
+	}
+	if _, err := os.Stat(stale); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// A real run should remove it
+	freed, err = compiler.GC(c)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if freed != int64(len(data)) {
+		t.Fatalf("bad: %d", freed)
+	}
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Fatalf("should be removed: %s", err)
+	}
+
+	// Everything in use should still exist and another run is a no-op
+	for _, raw := range c.Graph.Vertices() {
+		v := raw.(*CompiledGraphVertex)
+		if v.Dir == "" {
+			continue
+		}
+		if _, err := os.Stat(v.Dir); err != nil {
+			t.Fatalf("%s: %s", dag.VertexName(v), err)
+		}
+	}
+	removed, _, err = compiler.GCDryRun(c)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(removed) > 0 {
+		t.Fatalf("bad: %#v", removed)
+	}
+}
@@ -0,0 +1,95 @@
+package appfile
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+
+	"github.com/hashicorp/go-getter"
+)
+
+// DefaultGetters returns the getters that are used to download imports
+// and dependencies if CompileOpts.Getters is nil. These are the getters
+// that go-getter ships, keyed by the scheme or forced getter that selects
+// them: local files, Git ("git::"), Mercurial ("hg::") and HTTP.
+//
+// go-getter doesn't ship getters for S3 ("s3::") or Google Cloud Storage
+// ("gcs::"). To use those sources, add getters for them to this map and
+// set it as CompileOpts.Getters, along with detectors for their URLs in
+// CompileOpts.Detectors if needed.
+//
+// A new map is returned each time, so it is safe to modify.
+func DefaultGetters() map[string]getter.Getter {
+	httpGetter := &getter.HttpGetter{Netrc: true}
+	return map[string]getter.Getter{
+		"file":  new(getter.FileGetter),
+		"git":   new(getter.GitGetter),
+		"hg":    new(getter.HgGetter),
+		"http":  httpGetter,
+		"https": httpGetter,
+	}
+}
+
+// forcedGetterRegexp matches the "scheme::" prefix that forces a getter,
+// the same as go-getter.
+var forcedGetterRegexp = regexp.MustCompile(`^([A-Za-z0-9]+)::(.+)$`)
+
+// isNetworkSource returns true if downloading the detected source may
+// use the network. Every source is, except those on the local filesystem
+// such as "file:///app" or "git::file:///repo".
+func isNetworkSource(source string) bool {
+	if ms := forcedGetterRegexp.FindStringSubmatch(source); ms != nil {
+		source = ms[2]
+	}
+
+	u, err := url.Parse(source)
+	return err != nil || u.Scheme != "file"
+}
+
+// acquireGetters returns the getters to download with and a function to
+// release them once the download is done.
+//
+// go-getter stores the client that is downloading in each getter, so a
+// set of default getters can't be shared by concurrent downloads. Sets are
+// pooled instead, so that they're reused by later downloads and
+// compilations rather than created for each download.
+func (c *Compiler) acquireGetters() (map[string]getter.Getter, func()) {
+	if c.opts.Getters != nil {
+		return c.opts.Getters, func() {}
+	}
+
+	gs := c.getterPool.Get().(map[string]getter.Getter)
+	return gs, func() { c.getterPool.Put(gs) }
+}
+
+// withGetters is the getter.ClientOption that downloads with the given
+// getters.
+func withGetters(gs map[string]getter.Getter) getter.ClientOption {
+	return func(client *getter.Client) error {
+		client.Getters = gs
+		return nil
+	}
+}
+
+// checkGetter returns an error if there is no getter for the detected
+// source. go-getter would fail too, but this error says how to add one.
+func checkGetter(gs map[string]getter.Getter, source string) error {
+	scheme := ""
+	if ms := forcedGetterRegexp.FindStringSubmatch(source); ms != nil {
+		scheme = ms[1]
+	} else if u, err := url.Parse(source); err == nil {
+		scheme = u.Scheme
+	}
+	if scheme == "" {
+		// Let go-getter report that the source is invalid
+		return nil
+	}
+
+	if _, ok := gs[scheme]; !ok {
+		return fmt.Errorf(
+			"no getter for %q sources such as %s. A getter for it must "+
+				"be added to the compile options.", scheme, source)
+	}
+
+	return nil
+}
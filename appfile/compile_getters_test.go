@@ -0,0 +1,96 @@
+package appfile
+
+import (
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/hashicorp/go-getter"
+)
+
+func TestDefaultGetters(t *testing.T) {
+	gs := DefaultGetters()
+	for _, scheme := range []string{"file", "git", "hg", "http", "https"} {
+		if gs[scheme] == nil {
+			t.Fatalf("missing: %s", scheme)
+		}
+	}
+
+	// A new map is returned each time
+	delete(gs, "hg")
+	if DefaultGetters()["hg"] == nil {
+		t.Fatal("shared map")
+	}
+}
+
+func TestIsNetworkSource(t *testing.T) {
+	cases := []struct {
+		Source string
+		Result bool
+	}{
+		{"file:///app", false},
+		{"git::file:///repo?ref=v1", false},
+		{"https://example.com/app.zip", true},
+		{"git::https://github.com/foo/bar.git", true},
+		{"s3::https://s3.amazonaws.com/bucket/foo", true},
+	}
+
+	for _, tc := range cases {
+		if actual := isNetworkSource(tc.Source); actual != tc.Result {
+			t.Fatalf("%s: bad: %v", tc.Source, actual)
+		}
+	}
+}
+
+func TestCompile_getters(t *testing.T) {
+	opts := testCompileOpts(t)
+	defer os.RemoveAll(opts.Dir)
+
+	g := &testGetter{FileGetter: new(getter.FileGetter)}
+	opts.Getters = DefaultGetters()
+	opts.Getters["test"] = g
+
+	f := testFile(t, "compile-deps-getter")
+	defer f.resetID()
+	if _, err := testCompiler(t, opts).Compile(f); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if len(g.Gets) != 1 || !strings.HasSuffix(g.Gets[0], "/compile-deps-getter/child") {
+		t.Fatalf("bad: %#v", g.Gets)
+	}
+}
+
+func TestCompile_noGetter(t *testing.T) {
+	opts := testCompileOpts(t)
+	defer os.RemoveAll(opts.Dir)
+
+	f := testFile(t, "compile-deps-no-getter")
+	defer f.resetID()
+	_, err := testCompiler(t, opts).Compile(f)
+	if err == nil {
+		t.Fatal("should error")
+	}
+	if !strings.Contains(err.Error(), `no getter for "s3"`) {
+		t.Fatalf("bad: %s", err)
+	}
+}
+
+// testGetter is a getter.Getter that records the URLs that it gets and
+// gets them as local files.
+type testGetter struct {
+	*getter.FileGetter
+
+	Gets []string
+	lock sync.Mutex
+}
+
+func (g *testGetter) Get(dst string, u *url.URL) error {
+	g.lock.Lock()
+	g.Gets = append(g.Gets, u.Path)
+	g.lock.Unlock()
+
+	return g.FileGetter.Get(dst, u)
+}
@@ -0,0 +1,90 @@
+package appfile
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+// recoverIDRef is the temporary ref that recoverID fetches the default
+// branch of the remote into.
+const recoverIDRef = "refs/otto/recover-id"
+
+// recoverID restores the ID file of the Appfile from the default branch
+// of the "origin" remote of the Git repository that the Appfile is in,
+// for when the ID file was committed there but is missing from the
+// working copy. It returns false if the Appfile isn't in a Git
+// repository or the remote doesn't have the ID file.
+//
+// This fetches the default branch from the remote, so it requires
+// network access if the remote isn't local. The branch is fetched into
+// a temporary ref that is deleted afterwards, so FETCH_HEAD and the
+// remote-tracking branches of the repository aren't changed.
+func (c *Compiler) recoverID(f *File) (bool, error) {
+	path, err := filepath.Abs(f.idPath())
+	if err != nil {
+		return false, err
+	}
+	dir := filepath.Dir(path)
+
+	// If this isn't a Git repository with a remote, there's nothing to
+	// recover from.
+	top, err := gitOutput(dir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		c.logf("[DEBUG] not recovering ID, not a Git repository: %s", dir)
+		return false, nil
+	}
+	if _, err := gitOutput(dir, "config", "--get", "remote.origin.url"); err != nil {
+		c.logf("[DEBUG] not recovering ID, no origin remote: %s", top)
+		return false, nil
+	}
+
+	// Find the path of the ID file within the repository. The top level
+	// has symlinks resolved, so do the same for our path.
+	realDir, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return false, err
+	}
+	rel, err := filepath.Rel(top, filepath.Join(realDir, filepath.Base(path)))
+	if err != nil {
+		return false, err
+	}
+
+	// Find the default branch of the remote and fetch it
+	out, err := gitOutput(dir, "ls-remote", "--symref", "origin", "HEAD")
+	if err != nil {
+		return false, err
+	}
+	branch := ""
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 3 && fields[0] == "ref:" && fields[2] == "HEAD" {
+			branch = fields[1]
+		}
+	}
+	if branch == "" {
+		return false, fmt.Errorf("default branch of origin not found")
+	}
+	_, err = gitOutput(dir, "fetch", "--quiet", "--no-write-fetch-head",
+		"origin", "+"+branch+":"+recoverIDRef)
+	if err != nil {
+		return false, err
+	}
+	defer func() {
+		if _, err := gitOutput(dir, "update-ref", "-d", recoverIDRef); err != nil {
+			c.logf("[WARN] error deleting %s: %s", recoverIDRef, err)
+		}
+	}()
+
+	// Read the ID file from the branch, which may not have it either
+	data, err := gitOutput(
+		dir, "show", recoverIDRef+":"+filepath.ToSlash(rel))
+	if err != nil {
+		c.logf("[DEBUG] ID file %s not found in %s of origin", rel, branch)
+		return false, nil
+	}
+
+	c.logf("[INFO] recovered ID file %s from %s of origin", rel, branch)
+	return true, ioutil.WriteFile(path, []byte(data+"\n"), 0644)
+}
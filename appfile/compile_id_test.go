@@ -0,0 +1,137 @@
+package appfile
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestCompile_idFromGitRemote(t *testing.T) {
+	if !testHasGit {
+		t.Skip("git not found")
+	}
+
+	dir, err := ioutil.TempDir("", "otto-")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Commit the Appfile and its ID to the default branch of a remote
+	const id = "00000000-0000-0000-0000-000000000001"
+	remote := filepath.Join(dir, "remote")
+	work := filepath.Join(dir, "work")
+	if err := os.MkdirAll(work, 0755); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	files := map[string]string{
+		"Appfile": testGitDepAppfile,
+		IDFile:    id + "\n",
+	}
+	for name, data := range files {
+		err := ioutil.WriteFile(filepath.Join(work, name), []byte(data), 0644)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+	testGitCommit(t, work)
+	for _, args := range [][]string{
+		{"init", "-q", "--bare", remote},
+		{"-C", remote, "symbolic-ref", "HEAD", "refs/heads/main"},
+		{"-C", work, "remote", "add", "origin", remote},
+		{"-C", work, "push", "-q", "origin", "HEAD:refs/heads/main"},
+	} {
+		if out, err := exec.Command("git", args...).CombinedOutput(); err != nil {
+			t.Fatalf("err: %s\n\n%s", err, out)
+		}
+	}
+
+	// The ID file is missing from the working copy
+	if err := os.Remove(filepath.Join(work, IDFile)); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// FETCH_HEAD of the working copy must not be changed
+	fetchHead := filepath.Join(work, ".git", "FETCH_HEAD")
+	if err := ioutil.WriteFile(fetchHead, []byte("keep\n"), 0644); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	var warnings []*CompileEventWarning
+	opts := testCompileOpts(t)
+	opts.IDFromGitRemote = true
+	opts.Callback = func(raw CompileEvent) {
+		if e, ok := raw.(*CompileEventWarning); ok {
+			warnings = append(warnings, e)
+		}
+	}
+	defer os.RemoveAll(opts.Dir)
+
+	f, err := ParseFile(filepath.Join(work, "Appfile"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if _, err := testCompiler(t, opts).Compile(f); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if f.ID != id {
+		t.Fatalf("bad: %s", f.ID)
+	}
+	if len(warnings) != 1 {
+		t.Fatalf("bad: %#v", warnings)
+	}
+
+	// The ID file is restored
+	f, err = ParseFile(filepath.Join(work, "Appfile"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if f.ID != id {
+		t.Fatalf("bad: %s", f.ID)
+	}
+
+	data, err := ioutil.ReadFile(fetchHead)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if string(data) != "keep\n" {
+		t.Fatalf("bad: %s", data)
+	}
+
+	// The temporary ref is deleted
+	cmd := exec.Command("git", "-C", work, "rev-parse", "--verify", "--quiet", recoverIDRef)
+	if err := cmd.Run(); err == nil {
+		t.Fatalf("%s should be deleted", recoverIDRef)
+	}
+}
+
+func TestCompile_idFromGitRemoteNoRepo(t *testing.T) {
+	dir, err := ioutil.TempDir("", "otto-")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "Appfile")
+	if err := ioutil.WriteFile(path, []byte(testGitDepAppfile), 0644); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Outside of a Git repository, a new ID is generated
+	opts := testCompileOpts(t)
+	opts.IDFromGitRemote = true
+	defer os.RemoveAll(opts.Dir)
+
+	f, err := ParseFile(path)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if _, err := testCompiler(t, opts).Compile(f); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if f.ID == "" {
+		t.Fatal("should have ID")
+	}
+}
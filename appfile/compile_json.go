@@ -2,6 +2,7 @@ package appfile
 
 import (
 	"encoding/json"
+	"sort"
 	"strconv"
 
 	"github.com/hashicorp/terraform/dag"
@@ -12,25 +13,46 @@ import (
 // in a separate file since it requires a bunch of auxilliary structs that
 // we didn't want to confuse compile.go with.
 
+// MarshalJSON encodes the Compiled. The graph is stored in a set, so the
+// vertices and edges are sorted first so that identical compilations are
+// encoded identically.
 func (c *Compiled) MarshalJSON() ([]byte, error) {
 	raw := &compiledJSON{
-		File:  c.File,
-		Edges: make([]map[string]string, 0, len(c.Graph.Edges())),
+		File:     c.File,
+		Edges:    make([]map[string]string, 0, len(c.Graph.Edges())),
+		Declared: c.Declared,
+		Profile:  c.Profile,
 	}
 
-	// Compile the list of vertices, keeping track of their position
-	set := make(map[dag.Vertex]string)
-	for i, rawV := range c.Graph.Vertices() {
+	// Compile the sorted list of vertices
+	for _, rawV := range c.Graph.Vertices() {
 		v := rawV.(*CompiledGraphVertex)
+
+		// Make sure lazily loaded files are loaded so they're encoded
+		if _, err := v.LoadFile(); err != nil {
+			return nil, err
+		}
+
 		raw.Vertices = append(raw.Vertices, v)
-		set[v] = strconv.FormatInt(int64(i), 10)
+	}
+	sort.Sort(vertexByKey(raw.Vertices))
+
+	// Keep track of the position of each vertex
+	set := make(map[dag.Vertex]int)
+	for i, v := range raw.Vertices {
+		set[v] = i
 	}
 
-	// Map the edges by position
+	// Map the edges by position, in order
+	edges := make([][2]int, 0, len(c.Graph.Edges()))
 	for _, e := range c.Graph.Edges() {
+		edges = append(edges, [2]int{set[e.Source()], set[e.Target()]})
+	}
+	sort.Sort(edgeByPosition(edges))
+	for _, e := range edges {
 		raw.Edges = append(raw.Edges,
 			map[string]string{
-				set[e.Source()]: set[e.Target()],
+				strconv.FormatInt(int64(e[0]), 10): strconv.FormatInt(int64(e[1]), 10),
 			})
 	}
 
@@ -43,32 +65,110 @@ func (c *Compiled) UnmarshalJSON(data []byte) error {
 		return err
 	}
 
+	graph, err := compiledGraph(raw.Vertices, raw.Edges)
+	if err != nil {
+		return err
+	}
+
 	c.File = raw.File
-	c.Graph = new(dag.AcyclicGraph)
-	for _, v := range raw.Vertices {
-		c.Graph.Add(v)
+	c.Graph = graph
+	c.Declared = raw.Declared
+	c.Profile = raw.Profile
+	return nil
+}
+
+// compiledGraph builds the graph from the encoded vertices and edges,
+// where the edges refer to vertices by position.
+func compiledGraph(
+	vertices []*CompiledGraphVertex,
+	edges []map[string]string) (*dag.AcyclicGraph, error) {
+	graph := new(dag.AcyclicGraph)
+	for _, v := range vertices {
+		graph.Add(v)
 	}
-	for _, e := range raw.Edges {
+	for _, e := range edges {
 		for a, b := range e {
 			ai, err := strconv.ParseInt(a, 0, 0)
 			if err != nil {
-				return err
+				return nil, err
 			}
 
 			bi, err := strconv.ParseInt(b, 0, 0)
 			if err != nil {
-				return err
+				return nil, err
 			}
 
-			c.Graph.Connect(dag.BasicEdge(raw.Vertices[ai], raw.Vertices[bi]))
+			graph.Connect(dag.BasicEdge(vertices[ai], vertices[bi]))
 		}
 	}
 
-	return nil
+	return graph, nil
+}
+
+// vertexByKey implements sort.Interface to sort vertices by name, and
+// vertices with the same name by their source, ID and directory, so that
+// the order is always the same.
+type vertexByKey []*CompiledGraphVertex
+
+func (v vertexByKey) Len() int      { return len(v) }
+func (v vertexByKey) Swap(i, j int) { v[i], v[j] = v[j], v[i] }
+func (v vertexByKey) Less(i, j int) bool {
+	a, b := v[i].vertexKey(), v[j].vertexKey()
+	for k := range a {
+		if a[k] != b[k] {
+			return a[k] < b[k]
+		}
+	}
+
+	return false
+}
+
+// edgeByPosition implements sort.Interface to sort edges, given as the
+// positions of their source and target vertices.
+type edgeByPosition [][2]int
+
+func (e edgeByPosition) Len() int      { return len(e) }
+func (e edgeByPosition) Swap(i, j int) { e[i], e[j] = e[j], e[i] }
+func (e edgeByPosition) Less(i, j int) bool {
+	if e[i][0] != e[j][0] {
+		return e[i][0] < e[j][0]
+	}
+
+	return e[i][1] < e[j][1]
+}
+
+// vertexKey returns the fields that vertexByKey sorts by.
+func (v *CompiledGraphVertex) vertexKey() [4]string {
+	var source, id string
+	if v.File != nil {
+		source, id = v.File.Source, v.File.ID
+	}
+
+	return [4]string{v.Name(), source, id, v.Dir}
 }
 
 type compiledJSON struct {
 	File     *File
 	Vertices []*CompiledGraphVertex
 	Edges    []map[string]string
+	Declared []string
+	Profile  string
+}
+
+// compiledLazyJSON is like compiledJSON, but keeps the raw JSON of the
+// File of each vertex for LoadCompiledLazy.
+type compiledLazyJSON struct {
+	File     *File
+	Vertices []*compiledGraphVertexLazyJSON
+	Edges    []map[string]string
+	Declared []string
+	Profile  string
+}
+
+type compiledGraphVertexLazyJSON struct {
+	File      json.RawMessage
+	Dir       string
+	License   string
+	Labels    map[string]string
+	NameValue string
 }
@@ -0,0 +1,81 @@
+package appfile
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCompiledMarshalJSON_stable(t *testing.T) {
+	foo := testDiffVertex("1", "foo", "")
+	bar1 := testDiffVertex("2", "bar", "file:///tmp/bar1")
+	bar2 := testDiffVertex("3", "bar", "file:///tmp/bar2")
+	baz := testDiffVertex("4", "baz", "file:///tmp/baz")
+	vs := []*CompiledGraphVertex{foo, bar1, bar2, baz}
+	edges := [][2]int{{0, 1}, {0, 2}, {0, 3}, {1, 3}, {2, 3}}
+
+	expected, err := json.Marshal(testDiffCompiled(vs, edges))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// The graph is a set, so try a few times with the vertices added in
+	// a different order.
+	for i := 0; i < 20; i++ {
+		vs[1], vs[2] = vs[2], vs[1]
+		for _, e := range edges {
+			for k, idx := range e {
+				if idx == 1 || idx == 2 {
+					e[k] = 3 - idx
+				}
+			}
+		}
+
+		actual, err := json.Marshal(testDiffCompiled(vs, edges))
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if !bytes.Equal(actual, expected) {
+			t.Fatalf("bad:\n\n%s\n\n%s", actual, expected)
+		}
+	}
+
+	// It still decodes to the same graph
+	var c Compiled
+	if err := json.Unmarshal(expected, &c); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if c.String() != testDiffCompiled(vs, edges).String() {
+		t.Fatalf("bad: %s", c.String())
+	}
+}
+
+func TestCompile_reproducible(t *testing.T) {
+	opts := testCompileOpts(t)
+	defer os.RemoveAll(opts.Dir)
+
+	f := testFile(t, "compile-multi-dep")
+	defer f.resetID()
+
+	var expected []byte
+	for i := 0; i < 5; i++ {
+		if _, err := testCompiler(t, opts).Compile(f); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		actual, err := ioutil.ReadFile(filepath.Join(opts.Dir, CompileFilename))
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if expected == nil {
+			expected = actual
+			continue
+		}
+		if !bytes.Equal(actual, expected) {
+			t.Fatalf("bad:\n\n%s\n\n%s", actual, expected)
+		}
+	}
+}
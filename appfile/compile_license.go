@@ -0,0 +1,133 @@
+package appfile
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// LicenseUnknown is the license recorded for a dependency when no
+// license file is found or the license in it isn't recognized.
+const LicenseUnknown = "unknown"
+
+// licenseFilenames are the names of the files that are checked for a
+// license, in order. The names are matched case-insensitively.
+var licenseFilenames = []string{
+	"LICENSE",
+	"LICENSE.txt",
+	"LICENSE.md",
+	"LICENCE",
+	"COPYING",
+}
+
+// licenseMatchers are used to detect the type of a license from the
+// contents of a license file. They're checked in order and the first
+// matching license is used, so more specific licenses must come before
+// the licenses they contain the text of (LGPL before GPL, for example).
+// The contents are normalized to lowercase with single spaces first.
+var licenseMatchers = []struct {
+	ID       string
+	Patterns []*regexp.Regexp
+}{
+	{"Apache-2.0", licensePatterns(`apache license`, `version 2\.0`)},
+	{"MPL-2.0", licensePatterns(`mozilla public license,? version 2\.0`)},
+	{"AGPL-3.0", licensePatterns(`gnu affero general public license`, `version 3`)},
+	{"LGPL-3.0", licensePatterns(`gnu lesser general public license`, `version 3`)},
+	{"LGPL-2.1", licensePatterns(`gnu lesser general public license`, `version 2\.1`)},
+	{"GPL-3.0", licensePatterns(`gnu general public license`, `version 3`)},
+	{"GPL-2.0", licensePatterns(`gnu general public license`, `version 2`)},
+	{"BSD-3-Clause", licensePatterns(
+		`redistribution and use in source and binary forms`,
+		`neither the name`)},
+	{"BSD-2-Clause", licensePatterns(
+		`redistribution and use in source and binary forms`)},
+	{"MIT", licensePatterns(`permission is hereby granted, free of charge`)},
+	{"ISC", licensePatterns(`permission to use, copy, modify, and(/or)? distribute`)},
+	{"Unlicense", licensePatterns(`this is free and unencumbered software`)},
+}
+
+// Licenses returns a mapping of application name to the license that was
+// detected for it when it was fetched. This only includes dependencies:
+// the root application isn't fetched, so no license is detected for it.
+//
+// The licenses are SPDX identifiers such as "MIT" or "Apache-2.0", or
+// LicenseUnknown if no license was found.
+func (c *Compiled) Licenses() map[string]string {
+	result := make(map[string]string)
+	for _, raw := range c.Graph.Vertices() {
+		v := raw.(*CompiledGraphVertex)
+		if v.License != "" {
+			result[v.Name()] = v.License
+		}
+	}
+
+	return result
+}
+
+// detectLicense looks for a license file in dir and returns the SPDX
+// identifier of the license in it. If there is no license file or the
+// license isn't recognized, LicenseUnknown is returned.
+func detectLicense(dir string) (string, error) {
+	path, err := licensePath(dir)
+	if err != nil || path == "" {
+		return LicenseUnknown, err
+	}
+
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return LicenseUnknown, err
+	}
+
+	// Normalize the whitespace and case since license files are
+	// commonly reflowed.
+	text := strings.ToLower(strings.Join(strings.Fields(string(raw)), " "))
+	for _, m := range licenseMatchers {
+		match := true
+		for _, p := range m.Patterns {
+			if !p.MatchString(text) {
+				match = false
+				break
+			}
+		}
+
+		if match {
+			return m.ID, nil
+		}
+	}
+
+	return LicenseUnknown, nil
+}
+
+// licensePath returns the path to the license file in dir, or an empty
+// string if there isn't one.
+func licensePath(dir string) (string, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+		}
+
+		return "", err
+	}
+
+	for _, name := range licenseFilenames {
+		for _, fi := range entries {
+			if !fi.IsDir() && strings.EqualFold(fi.Name(), name) {
+				return filepath.Join(dir, fi.Name()), nil
+			}
+		}
+	}
+
+	return "", nil
+}
+
+func licensePatterns(patterns ...string) []*regexp.Regexp {
+	result := make([]*regexp.Regexp, len(patterns))
+	for i, p := range patterns {
+		result[i] = regexp.MustCompile(p)
+	}
+
+	return result
+}
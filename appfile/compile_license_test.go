@@ -0,0 +1,64 @@
+package appfile
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCompile_licenses(t *testing.T) {
+	opts := testCompileOpts(t)
+	defer os.RemoveAll(opts.Dir)
+
+	f := testFile(t, "compile-deps-license")
+	defer f.resetID()
+	c, err := testCompiler(t, opts).Compile(f)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := map[string]string{
+		"a": "MIT",
+		"b": LicenseUnknown,
+	}
+	if actual := c.Licenses(); !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("bad: %#v", actual)
+	}
+
+	// The licenses are kept when loading the compiled Appfile
+	for _, load := range []func(string) (*Compiled, error){LoadCompiled, LoadCompiledLazy} {
+		loaded, err := load(opts.Dir)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if actual := loaded.Licenses(); !reflect.DeepEqual(actual, expected) {
+			t.Fatalf("bad: %#v", actual)
+		}
+	}
+}
+
+func TestDetectLicense(t *testing.T) {
+	cases := []struct {
+		Dir     string
+		License string
+	}{
+		{"mit", "MIT"},
+		{"apache", "Apache-2.0"},
+		{"gpl3", "GPL-3.0"},
+		{"lgpl", "LGPL-3.0"},
+		{"none", LicenseUnknown},
+		{"unrecognized", LicenseUnknown},
+		{"missing", LicenseUnknown},
+	}
+
+	for _, tc := range cases {
+		actual, err := detectLicense(filepath.Join("./test-fixtures", "license", tc.Dir))
+		if err != nil {
+			t.Fatalf("%s: err: %s", tc.Dir, err)
+		}
+		if actual != tc.License {
+			t.Fatalf("%s: bad: %s", tc.Dir, actual)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package appfile
+
+import (
+	"container/list"
+)
+
+// importLRU is the cache of loaded imports of a Compiler. It holds at
+// most a fixed number of imports, evicting the least recently used import
+// when it is full. An evicted import is simply loaded again the next time
+// it is used.
+//
+// This isn't safe for concurrent use. The Compiler guards it with
+// importLock.
+type importLRU struct {
+	size  int
+	list  *list.List
+	items map[string]*list.Element
+}
+
+// importLRUItem is the value of each element in the list of an importLRU.
+type importLRUItem struct {
+	key   string
+	entry *importCacheEntry
+}
+
+func newImportLRU(size int) *importLRU {
+	return &importLRU{
+		size:  size,
+		list:  list.New(),
+		items: make(map[string]*list.Element),
+	}
+}
+
+// Get returns the cached import for the given source and marks it as
+// recently used.
+func (c *importLRU) Get(key string) (*importCacheEntry, bool) {
+	elem, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+
+	c.list.MoveToFront(elem)
+	return elem.Value.(*importLRUItem).entry, true
+}
+
+// Add caches the import for the given source, replacing any existing
+// entry. If the cache is over its size afterwards, the least recently
+// used import is evicted.
+func (c *importLRU) Add(key string, e *importCacheEntry) {
+	if elem, ok := c.items[key]; ok {
+		elem.Value.(*importLRUItem).entry = e
+		c.list.MoveToFront(elem)
+		return
+	}
+
+	c.items[key] = c.list.PushFront(&importLRUItem{key: key, entry: e})
+	for c.list.Len() > c.size {
+		oldest := c.list.Back()
+		c.list.Remove(oldest)
+		delete(c.items, oldest.Value.(*importLRUItem).key)
+	}
+}
+
+// Len returns the number of cached imports.
+func (c *importLRU) Len() int {
+	return c.list.Len()
+}
+
+// Keys returns the sources of the cached imports, from the most to the
+// least recently used.
+func (c *importLRU) Keys() []string {
+	result := make([]string, 0, c.list.Len())
+	for elem := c.list.Front(); elem != nil; elem = elem.Next() {
+		result = append(result, elem.Value.(*importLRUItem).key)
+	}
+
+	return result
+}
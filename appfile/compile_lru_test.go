@@ -0,0 +1,123 @@
+package appfile
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+func TestImportLRU(t *testing.T) {
+	c := newImportLRU(2)
+	c.Add("a", &importCacheEntry{})
+	c.Add("b", &importCacheEntry{})
+
+	// Using "a" makes "b" the least recently used
+	if _, ok := c.Get("a"); !ok {
+		t.Fatal("a should be cached")
+	}
+	c.Add("c", &importCacheEntry{})
+
+	if _, ok := c.Get("b"); ok {
+		t.Fatal("b should be evicted")
+	}
+	if actual := c.Keys(); !reflect.DeepEqual(actual, []string{"c", "a"}) {
+		t.Fatalf("bad: %#v", actual)
+	}
+
+	// Replacing an entry doesn't evict anything
+	e := &importCacheEntry{}
+	c.Add("a", e)
+	if c.Len() != 2 {
+		t.Fatalf("bad: %d", c.Len())
+	}
+	if actual, _ := c.Get("a"); actual != e {
+		t.Fatalf("bad: %#v", actual)
+	}
+}
+
+func TestCompile_importCacheSize(t *testing.T) {
+	opts := testCompileOpts(t)
+	opts.ImportCacheSize = 1
+	defer os.RemoveAll(opts.Dir)
+
+	compiler := testCompiler(t, opts)
+	for _, dir := range []string{"import-basic", "import-nested"} {
+		f := testFile(t, dir)
+		defer f.resetID()
+		if _, err := compiler.Compile(f); err != nil {
+			t.Fatalf("%s err: %s", dir, err)
+		}
+	}
+
+	if compiler.importCache.Len() != 1 {
+		t.Fatalf("bad: %#v", compiler.importCache.Keys())
+	}
+}
+
+// BenchmarkCompile_importCacheChurn compiles a new Appfile with a new
+// import on every iteration, like a long-lived Compiler would. The heap
+// in use afterwards should stay about the same as b.N grows, since the
+// import cache is bounded.
+func BenchmarkCompile_importCacheChurn(b *testing.B) {
+	td, err := ioutil.TempDir("", "otto-")
+	if err != nil {
+		b.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+
+	opts := &CompileOpts{
+		Dir:             filepath.Join(td, "compiled"),
+		ImportCacheSize: 16,
+	}
+	compiler, err := NewCompiler(opts)
+	if err != nil {
+		b.Fatalf("err: %s", err)
+	}
+
+	child, err := ioutil.ReadFile(
+		filepath.Join("./test-fixtures", "import-basic", "child", "Appfile"))
+	if err != nil {
+		b.Fatalf("err: %s", err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		dir := filepath.Join(td, fmt.Sprintf("app-%d", i))
+		if err := os.MkdirAll(filepath.Join(dir, "child"), 0755); err != nil {
+			b.Fatalf("err: %s", err)
+		}
+		if err := ioutil.WriteFile(
+			filepath.Join(dir, "child", "Appfile"), child, 0644); err != nil {
+			b.Fatalf("err: %s", err)
+		}
+		if err := ioutil.WriteFile(
+			filepath.Join(dir, "Appfile"), []byte(`import "./child" {}`), 0644); err != nil {
+			b.Fatalf("err: %s", err)
+		}
+		f, err := ParseFile(filepath.Join(dir, "Appfile"))
+		if err != nil {
+			b.Fatalf("err: %s", err)
+		}
+		b.StartTimer()
+
+		if _, err := compiler.Compile(f); err != nil {
+			b.Fatalf("err: %s", err)
+		}
+	}
+	b.StopTimer()
+
+	if n := compiler.importCache.Len(); n > opts.ImportCacheSize {
+		b.Fatalf("import cache not bounded: %d", n)
+	}
+
+	var stats runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&stats)
+	b.ReportMetric(float64(stats.HeapInuse), "heap-bytes")
+}
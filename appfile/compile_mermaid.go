@@ -0,0 +1,67 @@
+package appfile
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// mermaidEscaper escapes the characters in a label that have special
+// meaning to Mermaid, using Mermaid's entity codes.
+var mermaidEscaper = strings.NewReplacer(
+	`"`, "#quot;",
+	"#", "#35;",
+	"<", "#lt;",
+	">", "#gt;",
+	"&", "#amp;",
+)
+
+// Mermaid returns the dependency graph in the Mermaid diagram syntax.
+// Each application is a node labeled with its name and the edges point
+// from an application to its dependencies. The root application is
+// marked with the "root" class.
+//
+// The output is sorted by name so that it is the same for the same
+// graph.
+func (c *Compiled) Mermaid() string {
+	vertices := make([]*CompiledGraphVertex, 0, len(c.Graph.Vertices()))
+	for _, raw := range c.Graph.Vertices() {
+		vertices = append(vertices, raw.(*CompiledGraphVertex))
+	}
+	sort.Sort(vertexByName(vertices))
+
+	// Names may not be valid node IDs, so number the nodes instead
+	ids := make(map[*CompiledGraphVertex]string)
+	for i, v := range vertices {
+		ids[v] = fmt.Sprintf("n%d", i)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("graph TD\n")
+	for _, v := range vertices {
+		fmt.Fprintf(&buf, "    %s[\"%s\"]\n",
+			ids[v], mermaidEscaper.Replace(v.Name()))
+	}
+
+	edges := make([]string, 0, len(c.Graph.Edges()))
+	for _, e := range c.Graph.Edges() {
+		source := e.Source().(*CompiledGraphVertex)
+		target := e.Target().(*CompiledGraphVertex)
+		edges = append(edges, fmt.Sprintf(
+			"    %s --> %s\n", ids[source], ids[target]))
+	}
+	sort.Strings(edges)
+	for _, e := range edges {
+		buf.WriteString(e)
+	}
+
+	if c.File != nil && c.File.Application != nil {
+		if root := c.vertex(c.File.Application.Name); root != nil {
+			buf.WriteString("    classDef root stroke-width:3px\n")
+			fmt.Fprintf(&buf, "    class %s root\n", ids[root])
+		}
+	}
+
+	return buf.String()
+}
@@ -0,0 +1,33 @@
+package appfile
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCompiledMermaid(t *testing.T) {
+	foo := testDiffVertex("1", "foo", "")
+	foo.File.Application = &Application{Name: "foo"}
+	bar := testDiffVertex("2", `bar "<&>"`, "./bar")
+	baz := testDiffVertex("3", "baz#1", "./baz")
+	c := testDiffCompiled(
+		[]*CompiledGraphVertex{foo, bar, baz}, [][2]int{{0, 1}, {0, 2}, {1, 2}})
+
+	actual := strings.TrimSpace(c.Mermaid())
+	expected := strings.TrimSpace(testCompiledMermaidStr)
+	if actual != expected {
+		t.Fatalf("bad:\n\n%s\n\n%s", actual, expected)
+	}
+}
+
+const testCompiledMermaidStr = `
+graph TD
+    n0["bar #quot;#lt;#amp;#gt;#quot;"]
+    n1["baz#35;1"]
+    n2["foo"]
+    n0 --> n1
+    n2 --> n0
+    n2 --> n1
+    classDef root stroke-width:3px
+    class n2 root
+`
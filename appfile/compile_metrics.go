@@ -0,0 +1,62 @@
+package appfile
+
+import (
+	"time"
+)
+
+// The names of the metrics that are sent to CompileOpts.Metrics. The
+// names follow the Prometheus naming conventions.
+const (
+	// Counters of the dependencies and imports that were downloaded or
+	// reused from the cache, as in CompileStats.
+	MetricDepsFetched    = "otto_compile_deps_fetched_total"
+	MetricDepsCached     = "otto_compile_deps_cached_total"
+	MetricImportsFetched = "otto_compile_imports_fetched_total"
+	MetricImportsCached  = "otto_compile_imports_cached_total"
+
+	// MetricBytesDownloaded counts the bytes of dependencies and imports
+	// that were downloaded.
+	MetricBytesDownloaded = "otto_compile_downloaded_bytes_total"
+
+	// The durations of the phases of a compilation. Imports is loading
+	// the imports of the root Appfile, and deps is loading all the
+	// dependencies, including their imports. Compile is the duration of
+	// the whole compilation.
+	MetricImportsDuration  = "otto_compile_imports_duration_seconds"
+	MetricDepsDuration     = "otto_compile_deps_duration_seconds"
+	MetricValidateDuration = "otto_compile_validate_duration_seconds"
+	MetricWriteDuration    = "otto_compile_write_duration_seconds"
+	MetricCompileDuration  = "otto_compile_duration_seconds"
+)
+
+// CompileMetrics receives metrics from the Compiler, so that they can be
+// exposed by an embedder with a metrics library such as Prometheus.
+// Counters map to Prometheus counters and durations to histograms.
+//
+// The methods are called concurrently when multiple compilations run or
+// dependencies are loaded in parallel, so they must be safe for
+// concurrent use.
+type CompileMetrics interface {
+	// IncCounter adds delta to the counter with the given name.
+	IncCounter(name string, delta int64)
+
+	// ObserveDuration records a single duration for the histogram with
+	// the given name.
+	ObserveDuration(name string, d time.Duration)
+}
+
+// incCounter adds to the counter with the given name, if metrics are
+// enabled.
+func (c *Compiler) incCounter(name string, delta int64) {
+	if c.opts.Metrics != nil {
+		c.opts.Metrics.IncCounter(name, delta)
+	}
+}
+
+// observeSince records the duration since start with the given name, if
+// metrics are enabled.
+func (c *Compiler) observeSince(name string, start time.Time) {
+	if c.opts.Metrics != nil {
+		c.opts.Metrics.ObserveDuration(name, time.Since(start))
+	}
+}
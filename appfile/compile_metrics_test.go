@@ -0,0 +1,81 @@
+package appfile
+
+import (
+	"os"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCompile_metrics(t *testing.T) {
+	metrics := new(testCompileMetrics)
+	opts := testCompileOpts(t)
+	opts.Metrics = metrics
+	defer os.RemoveAll(opts.Dir)
+
+	f := testFile(t, "import-dep")
+	defer f.resetID()
+	compiler := testCompiler(t, opts)
+	for i := 0; i < 2; i++ {
+		if _, err := compiler.Compile(f); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+
+	if metrics.Counters[MetricBytesDownloaded] <= 0 {
+		t.Fatalf("bad: %#v", metrics.Counters)
+	}
+	delete(metrics.Counters, MetricBytesDownloaded)
+
+	// The second compile reuses everything from the first
+	expected := map[string]int64{
+		MetricDepsFetched:    1,
+		MetricDepsCached:     1,
+		MetricImportsFetched: 1,
+		MetricImportsCached:  1,
+	}
+	if !reflect.DeepEqual(metrics.Counters, expected) {
+		t.Fatalf("bad: %#v", metrics.Counters)
+	}
+
+	for _, name := range []string{
+		MetricImportsDuration,
+		MetricDepsDuration,
+		MetricValidateDuration,
+		MetricWriteDuration,
+		MetricCompileDuration,
+	} {
+		if n := len(metrics.Durations[name]); n != 2 {
+			t.Fatalf("bad: %s: %d", name, n)
+		}
+	}
+}
+
+// testCompileMetrics is a CompileMetrics that records everything.
+type testCompileMetrics struct {
+	sync.Mutex
+
+	Counters  map[string]int64
+	Durations map[string][]time.Duration
+}
+
+func (m *testCompileMetrics) IncCounter(name string, delta int64) {
+	m.Lock()
+	defer m.Unlock()
+	if m.Counters == nil {
+		m.Counters = make(map[string]int64)
+	}
+
+	m.Counters[name] += delta
+}
+
+func (m *testCompileMetrics) ObserveDuration(name string, d time.Duration) {
+	m.Lock()
+	defer m.Unlock()
+	if m.Durations == nil {
+		m.Durations = make(map[string][]time.Duration)
+	}
+
+	m.Durations[name] = append(m.Durations[name], d)
+}
@@ -0,0 +1,94 @@
+package appfile
+
+import (
+	"log"
+
+	"github.com/hashicorp/go-getter"
+)
+
+// CompilerOption is an option for NewCompilerWithOptions. Each option
+// sets the matching field of CompileOpts.
+type CompilerOption func(*Compiler)
+
+// DefaultCompileOpts returns the options for a Compiler that stores its
+// data in dir, with the options that have defaults set to them. The
+// result can be changed before it is given to NewCompiler.
+//
+// Getters and Detectors are left nil, which uses DefaultGetters and the
+// go-getter detectors. Setting Getters, even to DefaultGetters, means
+// that concurrent downloads share one set of getters rather than each
+// using their own, so only set it to add or replace getters.
+func DefaultCompileOpts(dir string) *CompileOpts {
+	return &CompileOpts{
+		Dir:                dir,
+		MaxParallelImports: DefaultMaxParallelImports,
+		ImportCacheSize:    DefaultImportCacheSize,
+		TraversalOrder:     TraversalDFS,
+	}
+}
+
+// withCompileOpts uses the given CompileOpts as-is. This is used by
+// NewCompiler, so that changes the caller makes to the CompileOpts are
+// still seen by the Compiler.
+func withCompileOpts(opts *CompileOpts) CompilerOption {
+	return func(c *Compiler) {
+		c.opts = opts
+	}
+}
+
+// WithLoader sets CompileOpts.Loader.
+func WithLoader(f func(f *File, dir string) (*File, error)) CompilerOption {
+	return func(c *Compiler) {
+		c.opts.Loader = f
+	}
+}
+
+// WithCallback sets CompileOpts.Callback.
+func WithCallback(f func(CompileEvent)) CompilerOption {
+	return func(c *Compiler) {
+		c.opts.Callback = f
+	}
+}
+
+// WithConcurrency sets the maximum number of imports that are downloaded
+// and parsed at the same time. See CompileOpts.MaxParallelImports.
+func WithConcurrency(n int) CompilerOption {
+	return func(c *Compiler) {
+		c.opts.MaxParallelImports = n
+	}
+}
+
+// WithDetectors sets CompileOpts.Detectors.
+func WithDetectors(ds ...getter.Detector) CompilerOption {
+	return func(c *Compiler) {
+		c.opts.Detectors = ds
+	}
+}
+
+// WithGetters sets CompileOpts.Getters.
+func WithGetters(gs map[string]getter.Getter) CompilerOption {
+	return func(c *Compiler) {
+		c.opts.Getters = gs
+	}
+}
+
+// WithLogger sets CompileOpts.Logger.
+func WithLogger(l *log.Logger) CompilerOption {
+	return func(c *Compiler) {
+		c.opts.Logger = l
+	}
+}
+
+// WithRemoveOnClose sets CompileOpts.RemoveOnClose.
+func WithRemoveOnClose() CompilerOption {
+	return func(c *Compiler) {
+		c.opts.RemoveOnClose = true
+	}
+}
+
+// WithVertexHook sets CompileOpts.VertexHook.
+func WithVertexHook(f func(v *CompiledGraphVertex) error) CompilerOption {
+	return func(c *Compiler) {
+		c.opts.VertexHook = f
+	}
+}
@@ -0,0 +1,91 @@
+package appfile
+
+import (
+	"bytes"
+	"io/ioutil"
+	"log"
+	"os"
+	"testing"
+)
+
+func TestNewCompilerWithOptions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "otto-")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	var buf bytes.Buffer
+	logger := log.New(&buf, "", 0)
+	c, err := NewCompilerWithOptions(dir,
+		WithConcurrency(3),
+		WithLogger(logger),
+		WithDetectors(new(testDetector)))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if c.opts.Dir != dir {
+		t.Fatalf("bad: %s", c.opts.Dir)
+	}
+	if c.opts.Logger != logger {
+		t.Fatal("bad logger")
+	}
+	if cap(c.importSem) != 3 {
+		t.Fatalf("bad: %d", cap(c.importSem))
+	}
+
+	actual, err := c.detect("foo", dir)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if actual != "test::foo" {
+		t.Fatalf("bad: %s", actual)
+	}
+}
+
+func TestDefaultCompileOpts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "otto-")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	opts := DefaultCompileOpts(dir)
+	if opts.Dir != dir {
+		t.Fatalf("bad: %s", opts.Dir)
+	}
+	if opts.MaxParallelImports != DefaultMaxParallelImports {
+		t.Fatalf("bad: %d", opts.MaxParallelImports)
+	}
+	if opts.ImportCacheSize != DefaultImportCacheSize {
+		t.Fatalf("bad: %d", opts.ImportCacheSize)
+	}
+	if opts.Getters != nil || opts.Detectors != nil {
+		t.Fatalf("bad: %#v", opts)
+	}
+
+	// Each call returns new options
+	opts.MaxParallelImports = 1
+	if DefaultCompileOpts(dir).MaxParallelImports != DefaultMaxParallelImports {
+		t.Fatal("defaults should not be shared")
+	}
+
+	c, err := NewCompiler(opts)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if cap(c.importSem) != 1 {
+		t.Fatalf("bad: %d", cap(c.importSem))
+	}
+	if c.importCache.size != DefaultImportCacheSize {
+		t.Fatalf("bad: %d", c.importCache.size)
+	}
+}
+
+// testDetector is a getter.Detector that detects every source.
+type testDetector struct{}
+
+func (d *testDetector) Detect(src, pwd string) (string, bool, error) {
+	return "test::" + src, true, nil
+}
@@ -0,0 +1,133 @@
+package appfile
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"io"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-getter"
+)
+
+// progressInterval is the minimum time between CompileEventProgress
+// events for a single download.
+const progressInterval = 500 * time.Millisecond
+
+// CompileEventProgress is the event that is called periodically while a
+// dependency or import is being downloaded. This is only sent if the
+// getter for the source is able to report progress.
+type CompileEventProgress struct {
+	Source string
+
+	// Bytes is the number of bytes downloaded so far.
+	Bytes int64
+
+	// Total is the total number of bytes to download and ETA is the
+	// estimated time remaining. These are zero if the size of the
+	// download isn't known.
+	Total int64
+	ETA   time.Duration
+}
+
+// fetch downloads the given source into the storage with the configured
+// getters, sending progress events if possible.
+func (c *Compiler) fetch(s getter.Storage, source string) error {
+	gs, release := c.acquireGetters()
+	defer release()
+	if err := checkGetter(gs, source); err != nil {
+		return err
+	}
+
+	tracker := &progressTracker{compiler: c, source: source}
+	switch s := s.(type) {
+	case *getter.FolderStorage:
+		// FolderStorage has no way to pass through getter options, so
+		// download into the same directory that it uses.
+		sum := md5.Sum([]byte(source))
+		dir := filepath.Join(s.StorageDir, hex.EncodeToString(sum[:]))
+		return getter.Get(dir, source, withGetters(gs), getter.WithProgress(tracker))
+	case *ContentStorage:
+		return s.get(source, source, true, withGetters(gs), getter.WithProgress(tracker))
+	default:
+		return s.Get(source, source, true)
+	}
+}
+
+// progressTracker is a getter.ProgressTracker that sends the progress
+// of a download as CompileEventProgress events.
+type progressTracker struct {
+	compiler *Compiler
+	source   string
+}
+
+// TrackProgress implements getter.ProgressTracker
+func (t *progressTracker) TrackProgress(
+	src string, current, total int64, stream io.ReadCloser) io.ReadCloser {
+	return &progressReader{
+		ReadCloser: stream,
+		tracker:    t,
+		start:      time.Now(),
+		initial:    current,
+		current:    current,
+		total:      total,
+	}
+}
+
+// progressReader counts the bytes read from a download and sends
+// progress events at most every progressInterval.
+type progressReader struct {
+	io.ReadCloser
+
+	tracker *progressTracker
+	start   time.Time
+	initial int64
+	current int64
+	total   int64
+	last    time.Time
+	lock    sync.Mutex
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.current += int64(n)
+	if now := time.Now(); now.Sub(r.last) >= progressInterval {
+		r.last = now
+		r.send(now)
+	}
+
+	return n, err
+}
+
+func (r *progressReader) Close() error {
+	r.lock.Lock()
+	r.send(time.Now())
+	r.lock.Unlock()
+
+	return r.ReadCloser.Close()
+}
+
+// send sends the current progress. The lock must be held.
+func (r *progressReader) send(now time.Time) {
+	e := &CompileEventProgress{
+		Source: r.tracker.source,
+		Bytes:  r.current,
+	}
+
+	// If we know the size, estimate the time remaining based on the
+	// rate of this download so far.
+	if r.total > 0 {
+		e.Total = r.total
+		if done := r.current - r.initial; done > 0 && r.current < r.total {
+			elapsed := now.Sub(r.start)
+			e.ETA = time.Duration(
+				float64(elapsed) * float64(r.total-r.current) / float64(done))
+		}
+	}
+
+	r.tracker.compiler.event(e)
+}
@@ -0,0 +1,55 @@
+package appfile
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/hashicorp/go-getter"
+)
+
+func TestProgressTracker_impl(t *testing.T) {
+	var _ getter.ProgressTracker = new(progressTracker)
+}
+
+func TestProgressTracker(t *testing.T) {
+	cases := []struct {
+		Total int64
+	}{
+		{5},
+		{0},
+	}
+
+	for _, tc := range cases {
+		events := make(chan CompileEvent, 10)
+		opts := testCompileOpts(t)
+		opts.Events = events
+		defer os.RemoveAll(opts.Dir)
+		c := testCompiler(t, opts)
+
+		tracker := &progressTracker{compiler: c, source: "foo"}
+		stream := ioutil.NopCloser(bytes.NewReader([]byte("hello")))
+		r := tracker.TrackProgress("foo", 0, tc.Total, stream)
+		if _, err := ioutil.ReadAll(r); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if err := r.Close(); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		// The last event must be the completed download
+		var last *CompileEventProgress
+		for len(events) > 0 {
+			last = (<-events).(*CompileEventProgress)
+		}
+		if last == nil {
+			t.Fatalf("total %d: no events", tc.Total)
+		}
+
+		expected := &CompileEventProgress{Source: "foo", Bytes: 5, Total: tc.Total}
+		if *last != *expected {
+			t.Fatalf("total %d bad: %#v", tc.Total, last)
+		}
+	}
+}
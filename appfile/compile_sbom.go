@@ -0,0 +1,147 @@
+package appfile
+
+import (
+	"encoding/json"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// sbomSpecVersion is the version of the CycloneDX specification that
+// Compiled.SBOM generates.
+const sbomSpecVersion = "1.4"
+
+// SBOM returns a software bill of materials for the compiled Appfile in
+// the CycloneDX JSON format. The root application is the subject of the
+// SBOM and every dependency is a component, referenced by its Otto ID.
+//
+// The source of each dependency is included as a VCS reference. If the
+// source pins a ref (such as "?ref=v1.0" for Git), that is used as the
+// version of the component.
+func (c *Compiled) SBOM() ([]byte, error) {
+	vertices := make([]*CompiledGraphVertex, 0, len(c.Graph.Vertices()))
+	for _, raw := range c.Graph.Vertices() {
+		v := raw.(*CompiledGraphVertex)
+		if _, err := v.LoadFile(); err != nil {
+			return nil, err
+		}
+
+		vertices = append(vertices, v)
+	}
+	sort.Sort(vertexByName(vertices))
+
+	var root *CompiledGraphVertex
+	if c.File != nil && c.File.Application != nil {
+		root = c.vertex(c.File.Application.Name)
+	}
+
+	bom := &sbomJSON{
+		BOMFormat:    "CycloneDX",
+		SpecVersion:  sbomSpecVersion,
+		Version:      1,
+		Components:   make([]*sbomComponentJSON, 0, len(vertices)),
+		Dependencies: make([]*sbomDependencyJSON, 0, len(vertices)),
+	}
+	for _, v := range vertices {
+		component := sbomComponent(v)
+		if v == root {
+			bom.Metadata = &sbomMetadataJSON{Component: component}
+		} else {
+			bom.Components = append(bom.Components, component)
+		}
+
+		dep := &sbomDependencyJSON{Ref: component.BOMRef}
+		for _, raw := range c.Graph.DownEdges(v).List() {
+			dep.DependsOn = append(dep.DependsOn, diffID(raw))
+		}
+		sort.Strings(dep.DependsOn)
+		bom.Dependencies = append(bom.Dependencies, dep)
+	}
+
+	return json.MarshalIndent(bom, "", "  ")
+}
+
+// sbomComponent returns the CycloneDX component for a single vertex.
+func sbomComponent(v *CompiledGraphVertex) *sbomComponentJSON {
+	result := &sbomComponentJSON{
+		Type:   "application",
+		BOMRef: diffID(v),
+		Name:   v.Name(),
+	}
+	if v.File == nil {
+		return result
+	}
+
+	if v.File.ID != "" {
+		result.Properties = append(result.Properties, &sbomPropertyJSON{
+			Name:  "otto:id",
+			Value: v.File.ID,
+		})
+	}
+
+	if v.File.Source != "" {
+		source, ref := sbomSource(v.File.Source)
+		result.Version = ref
+		result.ExternalReferences = append(result.ExternalReferences,
+			&sbomReferenceJSON{Type: "vcs", URL: source})
+	}
+
+	return result
+}
+
+// sbomSource splits a resolved dependency source into its URL, without
+// any forced getter prefix such as "git::", and the ref it is pinned to,
+// if any.
+func sbomSource(source string) (string, string) {
+	if idx := strings.Index(source, "::"); idx >= 0 {
+		source = source[idx+2:]
+	}
+
+	u, err := url.Parse(source)
+	if err != nil {
+		return source, ""
+	}
+
+	q := u.Query()
+	ref := q.Get("ref")
+	q.Del("ref")
+	u.RawQuery = q.Encode()
+	return u.String(), ref
+}
+
+type sbomJSON struct {
+	BOMFormat    string                `json:"bomFormat"`
+	SpecVersion  string                `json:"specVersion"`
+	Version      int                   `json:"version"`
+	Metadata     *sbomMetadataJSON     `json:"metadata,omitempty"`
+	Components   []*sbomComponentJSON  `json:"components"`
+	Dependencies []*sbomDependencyJSON `json:"dependencies"`
+}
+
+type sbomMetadataJSON struct {
+	Component *sbomComponentJSON `json:"component"`
+}
+
+type sbomComponentJSON struct {
+	Type               string               `json:"type"`
+	BOMRef             string               `json:"bom-ref"`
+	Name               string               `json:"name"`
+	Version            string               `json:"version,omitempty"`
+	ExternalReferences []*sbomReferenceJSON `json:"externalReferences,omitempty"`
+	Properties         []*sbomPropertyJSON  `json:"properties,omitempty"`
+}
+
+type sbomReferenceJSON struct {
+	Type string `json:"type"`
+	URL  string `json:"url"`
+}
+
+type sbomPropertyJSON struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type sbomDependencyJSON struct {
+	Ref       string   `json:"ref"`
+	DependsOn []string `json:"dependsOn,omitempty"`
+}
@@ -0,0 +1,132 @@
+package appfile
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCompiledSBOM(t *testing.T) {
+	foo := testDiffVertex("1", "foo", "")
+	foo.File.Application = &Application{Name: "foo"}
+	bar := testDiffVertex("2", "bar", "git::https://example.com/bar.git?ref=v1")
+	baz := testDiffVertex("3", "baz", "file:///tmp/baz")
+	c := testDiffCompiled(
+		[]*CompiledGraphVertex{foo, bar, baz}, [][2]int{{0, 1}, {0, 2}, {1, 2}})
+
+	actual, err := c.SBOM()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := strings.TrimSpace(testCompiledSBOMStr)
+	if string(actual) != expected {
+		t.Fatalf("bad:\n\n%s\n\n%s", actual, expected)
+	}
+}
+
+func TestSBOMSource(t *testing.T) {
+	cases := []struct {
+		Input  string
+		Source string
+		Ref    string
+	}{
+		{
+			"file:///tmp/foo",
+			"file:///tmp/foo",
+			"",
+		},
+		{
+			"git::https://example.com/foo.git?ref=abc123",
+			"https://example.com/foo.git",
+			"abc123",
+		},
+		{
+			"https://example.com/foo.zip?archive=zip&ref=v1",
+			"https://example.com/foo.zip?archive=zip",
+			"v1",
+		},
+	}
+
+	for _, tc := range cases {
+		source, ref := sbomSource(tc.Input)
+		if source != tc.Source || ref != tc.Ref {
+			t.Fatalf("%s bad: %s %s", tc.Input, source, ref)
+		}
+	}
+}
+
+const testCompiledSBOMStr = `
+{
+  "bomFormat": "CycloneDX",
+  "specVersion": "1.4",
+  "version": 1,
+  "metadata": {
+    "component": {
+      "type": "application",
+      "bom-ref": "1",
+      "name": "foo",
+      "properties": [
+        {
+          "name": "otto:id",
+          "value": "1"
+        }
+      ]
+    }
+  },
+  "components": [
+    {
+      "type": "application",
+      "bom-ref": "2",
+      "name": "bar",
+      "version": "v1",
+      "externalReferences": [
+        {
+          "type": "vcs",
+          "url": "https://example.com/bar.git"
+        }
+      ],
+      "properties": [
+        {
+          "name": "otto:id",
+          "value": "2"
+        }
+      ]
+    },
+    {
+      "type": "application",
+      "bom-ref": "3",
+      "name": "baz",
+      "externalReferences": [
+        {
+          "type": "vcs",
+          "url": "file:///tmp/baz"
+        }
+      ],
+      "properties": [
+        {
+          "name": "otto:id",
+          "value": "3"
+        }
+      ]
+    }
+  ],
+  "dependencies": [
+    {
+      "ref": "2",
+      "dependsOn": [
+        "3"
+      ]
+    },
+    {
+      "ref": "3"
+    },
+    {
+      "ref": "1",
+      "dependsOn": [
+        "2",
+        "3"
+      ]
+    }
+  ]
+}
+`
@@ -0,0 +1,118 @@
+package appfile
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/go-multierror"
+)
+
+// SecretRefPrefix is the prefix of a string value in an Appfile that
+// references a secret in Vault rather than being the value itself. The
+// full syntax is "vault:PATH#KEY", such as "vault:secret/api#token",
+// which references the "token" key of the secret at "secret/api".
+const SecretRefPrefix = "vault:"
+
+// SecretResolver resolves the secrets referenced in Appfiles. See
+// CompileOpts.SecretResolver.
+type SecretResolver interface {
+	// ResolveSecret returns the value of the key of the secret at the
+	// given path.
+	ResolveSecret(path, key string) (string, error)
+}
+
+// SecretResolverFunc is a function that implements SecretResolver.
+type SecretResolverFunc func(path, key string) (string, error)
+
+func (f SecretResolverFunc) ResolveSecret(path, key string) (string, error) {
+	return f(path, key)
+}
+
+// parseSecretRef parses a "vault:PATH#KEY" reference. The boolean is
+// false if the value isn't a reference at all.
+func parseSecretRef(v string) (string, string, bool, error) {
+	if !strings.HasPrefix(v, SecretRefPrefix) {
+		return "", "", false, nil
+	}
+
+	ref := strings.TrimPrefix(v, SecretRefPrefix)
+	idx := strings.LastIndex(ref, "#")
+	if idx <= 0 || idx == len(ref)-1 {
+		return "", "", true, fmt.Errorf(
+			"secret reference '%s' must be in the form %sPATH#KEY",
+			v, SecretRefPrefix)
+	}
+
+	return ref[:idx], ref[idx+1:], true, nil
+}
+
+// resolveSecrets replaces the secret references in the configuration of
+// the customizations and foundations of the File with their values.
+//
+// If there is no SecretResolver, the references are left as-is and a
+// CompileEventWarning is sent, or an error is returned if validation is
+// strict.
+func (c *Compiler) resolveSecrets(f *File, source string) error {
+	var result error
+	unresolved := make(map[string]struct{})
+	replace := func(v string) string {
+		path, key, ok, err := parseSecretRef(v)
+		if !ok {
+			return v
+		}
+		if err != nil {
+			result = multierror.Append(result, err)
+			return v
+		}
+		if c.opts.SecretResolver == nil {
+			unresolved[v] = struct{}{}
+			return v
+		}
+
+		secret, err := c.opts.SecretResolver.ResolveSecret(path, key)
+		if err != nil {
+			result = multierror.Append(result, fmt.Errorf(
+				"Error resolving secret '%s': %s", v, err))
+			return v
+		}
+
+		return secret
+	}
+
+	if f.Customization != nil {
+		for _, cust := range f.Customization.Raw {
+			cust.Config = interpolateValue(cust.Config, replace).(map[string]interface{})
+		}
+	}
+	for _, infra := range f.Infrastructure {
+		for _, fd := range infra.Foundations {
+			fd.Config = interpolateValue(fd.Config, replace).(map[string]interface{})
+		}
+	}
+	if result != nil || len(unresolved) == 0 {
+		return result
+	}
+
+	refs := make([]string, 0, len(unresolved))
+	for ref := range unresolved {
+		refs = append(refs, ref)
+	}
+	sort.Strings(refs)
+	msg := fmt.Sprintf(
+		"The Appfile references secrets, but no secret resolver is configured\n"+
+			"so they weren't resolved: %s", strings.Join(refs, ", "))
+
+	// This is only a warning unless validation is strict
+	if c.opts.StrictValidation {
+		return errors.New(msg)
+	}
+
+	c.logf("[WARN] unresolved secret references in %s: %v", source, refs)
+	c.event(&CompileEventWarning{
+		Source:  source,
+		Message: msg,
+	})
+	return nil
+}
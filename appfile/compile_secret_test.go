@@ -0,0 +1,116 @@
+package appfile
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestParseSecretRef(t *testing.T) {
+	cases := []struct {
+		Input     string
+		Path, Key string
+		Ref, Err  bool
+	}{
+		{"foo", "", "", false, false},
+		{"vault:secret/api#token", "secret/api", "token", true, false},
+		{"vault:secret/a#b#token", "secret/a#b", "token", true, false},
+		{"vault:secret/api", "", "", true, true},
+		{"vault:secret/api#", "", "", true, true},
+		{"vault:#token", "", "", true, true},
+	}
+
+	for _, tc := range cases {
+		path, key, ref, err := parseSecretRef(tc.Input)
+		if (err != nil) != tc.Err {
+			t.Fatalf("%s: err: %s", tc.Input, err)
+		}
+		if path != tc.Path || key != tc.Key || ref != tc.Ref {
+			t.Fatalf("%s: bad: %s %s %v", tc.Input, path, key, ref)
+		}
+	}
+}
+
+func TestCompile_secrets(t *testing.T) {
+	opts := testCompileOpts(t)
+	defer os.RemoveAll(opts.Dir)
+
+	var resolved []string
+	opts.SecretResolver = SecretResolverFunc(func(path, key string) (string, error) {
+		resolved = append(resolved, path+"#"+key)
+		return "secret-" + key, nil
+	})
+
+	f := testFile(t, "compile-secret")
+	defer f.resetID()
+	c, err := testCompiler(t, opts).Compile(f)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	config := c.File.Customization.Filter("bar")[0].Config
+	if config["api_token"] != "secret-token" || config["name"] != "foo" {
+		t.Fatalf("bad: %#v", config)
+	}
+	config = c.File.Infrastructure[0].Foundations[0].Config
+	if config["token"] != "secret-token" {
+		t.Fatalf("bad: %#v", config)
+	}
+	if len(resolved) != 2 {
+		t.Fatalf("bad: %#v", resolved)
+	}
+}
+
+func TestCompile_secretsError(t *testing.T) {
+	opts := testCompileOpts(t)
+	defer os.RemoveAll(opts.Dir)
+	opts.SecretResolver = SecretResolverFunc(func(path, key string) (string, error) {
+		return "", fmt.Errorf("permission denied")
+	})
+
+	f := testFile(t, "compile-secret")
+	defer f.resetID()
+	_, err := testCompiler(t, opts).Compile(f)
+	if err == nil {
+		t.Fatal("should error")
+	}
+	if !strings.Contains(err.Error(), "vault:secret/api#token': permission denied") {
+		t.Fatalf("bad: %s", err)
+	}
+}
+
+func TestCompile_secretsNoResolver(t *testing.T) {
+	var warnings []*CompileEventWarning
+	opts := testCompileOpts(t)
+	opts.Callback = func(raw CompileEvent) {
+		if e, ok := raw.(*CompileEventWarning); ok {
+			warnings = append(warnings, e)
+		}
+	}
+	defer os.RemoveAll(opts.Dir)
+
+	f := testFile(t, "compile-secret")
+	defer f.resetID()
+	c, err := testCompiler(t, opts).Compile(f)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// The references are left as-is with a warning
+	config := c.File.Customization.Filter("bar")[0].Config
+	if config["api_token"] != "vault:secret/api#token" {
+		t.Fatalf("bad: %#v", config)
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0].Message,
+		"vault:secret/api#token, vault:secret/consul#token") {
+		t.Fatalf("bad: %#v", warnings)
+	}
+
+	// Strict validation makes it an error
+	opts.StrictValidation = true
+	f = testFile(t, "compile-secret")
+	if _, err := testCompiler(t, opts).Compile(f); err == nil {
+		t.Fatal("should error")
+	}
+}
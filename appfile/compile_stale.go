@@ -0,0 +1,131 @@
+package appfile
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/mitchellh/copystructure"
+)
+
+// RecompileNeededError is returned by LoadCompiledFor when the root
+// Appfile declares different dependencies or imports than the ones it was
+// compiled with, so it has to be compiled again.
+type RecompileNeededError struct {
+	// Added and Removed are the declarations, such as `dependency "./api"`,
+	// that were added to or removed from the Appfile since it was compiled.
+	Added   []string
+	Removed []string
+}
+
+func (e *RecompileNeededError) Error() string {
+	var changes []string
+	for _, d := range e.Added {
+		changes = append(changes, "  added:   "+d)
+	}
+	for _, d := range e.Removed {
+		changes = append(changes, "  removed: "+d)
+	}
+
+	return fmt.Sprintf(
+		"The dependencies or imports of the Appfile changed since it was\n"+
+			"compiled, so it must be compiled again with `otto compile`.\n\n%s",
+		strings.Join(changes, "\n"))
+}
+
+// LoadCompiledFor is like LoadCompiled, but also checks that the root
+// Appfile current declares the same dependencies and imports as the
+// Appfile that was compiled. If they differ, such as when a dependency was
+// added to the Appfile but it wasn't compiled again, a
+// *RecompileNeededError is returned. If current is nil, this is the same
+// as LoadCompiled.
+//
+// current must be the Appfile as it is parsed, before its imports are
+// merged or it is passed to a Loader. The profile that the Appfile was
+// compiled with is applied to a copy of current before comparing, so
+// changes to the dependencies of the profile are found too. Appfiles
+// compiled before the declarations were recorded can't be checked and
+// are always loaded.
+func LoadCompiledFor(dir string, current *File) (*Compiled, error) {
+	c, err := LoadCompiled(dir)
+	if err != nil || current == nil || c.Declared == nil {
+		return c, err
+	}
+
+	declared, err := declaredProfileSources(current, c.Profile)
+	if err != nil {
+		return nil, fmt.Errorf(
+			"Error applying profile '%s' to the Appfile: %s", c.Profile, err)
+	}
+
+	added, removed := diffDeclared(c.Declared, declared)
+	if len(added) > 0 || len(removed) > 0 {
+		return nil, &RecompileNeededError{Added: added, Removed: removed}
+	}
+
+	return c, nil
+}
+
+// declaredSources returns the dependencies and imports that the Appfile
+// declares itself, before its imports are merged, such as
+// `dependency "./api"` and `import "./common"`, sorted.
+func declaredSources(f *File) []string {
+	result := make([]string, 0)
+	for _, i := range f.Imports {
+		result = append(result, fmt.Sprintf("import %q", i.Source))
+	}
+	if f.Application != nil {
+		for _, dep := range f.Application.Dependencies {
+			result = append(result, fmt.Sprintf("dependency %q", dep.Source))
+		}
+	}
+
+	sort.Strings(result)
+	return result
+}
+
+// declaredProfileSources is like declaredSources, but applies the
+// profile to a copy of the Appfile first if it is set.
+func declaredProfileSources(f *File, profile string) ([]string, error) {
+	if profile == "" {
+		return declaredSources(f), nil
+	}
+
+	raw, err := copystructure.Copy(f)
+	if err != nil {
+		return nil, err
+	}
+	f = raw.(*File)
+	if err := f.ApplyProfile(profile); err != nil {
+		return nil, err
+	}
+
+	return declaredSources(f), nil
+}
+
+// diffDeclared returns the declarations in new that aren't in old, and
+// the ones in old that aren't in new.
+func diffDeclared(old, new []string) ([]string, []string) {
+	oldSet := make(map[string]struct{}, len(old))
+	for _, d := range old {
+		oldSet[d] = struct{}{}
+	}
+	newSet := make(map[string]struct{}, len(new))
+	for _, d := range new {
+		newSet[d] = struct{}{}
+	}
+
+	var added, removed []string
+	for _, d := range new {
+		if _, ok := oldSet[d]; !ok {
+			added = append(added, d)
+		}
+	}
+	for _, d := range old {
+		if _, ok := newSet[d]; !ok {
+			removed = append(removed, d)
+		}
+	}
+
+	return added, removed
+}
@@ -0,0 +1,132 @@
+package appfile
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestLoadCompiledFor(t *testing.T) {
+	opts := testCompileOpts(t)
+	defer os.RemoveAll(opts.Dir)
+
+	f := testFile(t, "compile-deps")
+	defer f.resetID()
+	if _, err := testCompiler(t, opts).Compile(f); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	cases := []struct {
+		Name    string
+		Modify  func(f *File)
+		Added   []string
+		Removed []string
+	}{
+		{
+			"unchanged",
+			func(f *File) {},
+			nil,
+			nil,
+		},
+
+		{
+			"added dependency",
+			func(f *File) {
+				f.Application.Dependencies = append(
+					f.Application.Dependencies, &Dependency{Source: "./other"})
+			},
+			[]string{`dependency "./other"`},
+			nil,
+		},
+
+		{
+			"replaced with an import",
+			func(f *File) {
+				f.Application.Dependencies = nil
+				f.Imports = []*Import{&Import{Source: "./common"}}
+			},
+			[]string{`import "./common"`},
+			[]string{`dependency "./child"`},
+		},
+	}
+
+	for _, tc := range cases {
+		current := testFile(t, "compile-deps")
+		tc.Modify(current)
+
+		c, err := LoadCompiledFor(opts.Dir, current)
+		if tc.Added == nil && tc.Removed == nil {
+			if err != nil || c == nil {
+				t.Fatalf("%s: err: %s", tc.Name, err)
+			}
+			continue
+		}
+
+		var rerr *RecompileNeededError
+		if !errors.As(err, &rerr) {
+			t.Fatalf("%s: bad: %#v", tc.Name, err)
+		}
+		if !reflect.DeepEqual(rerr.Added, tc.Added) ||
+			!reflect.DeepEqual(rerr.Removed, tc.Removed) {
+			t.Fatalf("%s: bad: %#v", tc.Name, rerr)
+		}
+	}
+
+	// Without a current Appfile, nothing is checked
+	if _, err := LoadCompiledFor(opts.Dir, nil); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
+
+func TestLoadCompiledFor_imports(t *testing.T) {
+	opts := testCompileOpts(t)
+	defer os.RemoveAll(opts.Dir)
+
+	// Merging the imports doesn't change what the root declares
+	f := testFile(t, "import-basic")
+	defer f.resetID()
+	if _, err := testCompiler(t, opts).Compile(f); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if _, err := LoadCompiledFor(opts.Dir, testFile(t, "import-basic")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
+
+func TestLoadCompiledFor_profile(t *testing.T) {
+	opts := testCompileOpts(t)
+	opts.Profile = "production"
+	defer os.RemoveAll(opts.Dir)
+
+	f := testFile(t, "compile-profile")
+	defer f.resetID()
+	if _, err := testCompiler(t, opts).Compile(f); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// The Appfile as it is parsed isn't stale
+	current := testFile(t, "compile-profile")
+	c, err := LoadCompiledFor(opts.Dir, current)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if c.Profile != opts.Profile {
+		t.Fatalf("bad: %s", c.Profile)
+	}
+
+	// Changing the dependencies of the profile makes it stale
+	current = testFile(t, "compile-profile")
+	current.Profiles[0].File.Application = &Application{
+		Dependencies: []*Dependency{&Dependency{Source: "./child"}},
+	}
+	_, err = LoadCompiledFor(opts.Dir, current)
+	var rerr *RecompileNeededError
+	if !errors.As(err, &rerr) {
+		t.Fatalf("bad: %#v", err)
+	}
+	if rerr.Added != nil || !reflect.DeepEqual(rerr.Removed, []string{`dependency "./other"`}) {
+		t.Fatalf("bad: %#v", rerr)
+	}
+}
@@ -1,16 +1,23 @@
 package appfile
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"log"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"reflect"
+	"sort"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/hashicorp/go-getter"
 	"github.com/hashicorp/terraform/dag"
 )
 
@@ -45,12 +52,48 @@ func TestCompile(t *testing.T) {
 			false,
 		},
 
+		{
+			"compile-deps-json",
+			testCompileDepsStr,
+			false,
+		},
+
+		{
+			"compile-deps-alias",
+			testCompileDepsStr,
+			false,
+		},
+
+		{
+			"compile-deps-subdir",
+			testCompileDepsStr,
+			false,
+		},
+
+		{
+			"compile-deps-subdir-escape",
+			"",
+			true,
+		},
+
 		{
 			"compile-multi-dep",
 			testCompileMultiDepStr,
 			false,
 		},
 
+		{
+			"compile-deps-dup-name",
+			"",
+			true,
+		},
+
+		{
+			"compile-deps-self",
+			"",
+			true,
+		},
+
 		{
 			"compile-invalid",
 			"",
@@ -165,6 +208,35 @@ func TestCompile_structure(t *testing.T) {
 			false,
 		},
 
+		{
+			"import-alias",
+			"",
+			&File{
+				Application: &Application{
+					Name:   "foo",
+					Type:   "bar",
+					Detect: true,
+				},
+				Project: &Project{
+					Name:           "foo",
+					Infrastructure: "aws",
+				},
+				Infrastructure: []*Infrastructure{
+					&Infrastructure{
+						Name: "aws",
+						Type: "aws",
+					},
+				},
+				Aliases: []*Alias{
+					&Alias{
+						Name:   "shared",
+						Source: "./child",
+					},
+				},
+			},
+			false,
+		},
+
 		{
 			"import-nested",
 			"",
@@ -303,6 +375,9 @@ func TestCompile_structure(t *testing.T) {
 				tc.File.Source = actual.Source
 			}
 
+			// Positions are tested with parsing
+			actual.Positions = nil
+
 			if !reflect.DeepEqual(actual, tc.File) {
 				t.Fatalf("err: %s\n\n%#v\n\n%#v", tc.Dir, actual, tc.File)
 			}
@@ -310,118 +385,1722 @@ func TestCompile_structure(t *testing.T) {
 	}
 }
 
-func TestCompileID(t *testing.T) {
+func TestCompile_loadRoot(t *testing.T) {
+	root, err := filepath.Abs(filepath.Join("./test-fixtures", "compile-deps"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	cases := []struct {
+		LoadRoot bool
+		Names    []string
+	}{
+		{false, []string{"bar"}},
+		{true, []string{"bar", "foo"}},
+	}
+
+	for _, tc := range cases {
+		opts := testCompileOpts(t)
+		opts.LoadRoot = tc.LoadRoot
+		defer os.RemoveAll(opts.Dir)
+
+		var names []string
+		opts.Loader = func(f *File, dir string) (*File, error) {
+			names = append(names, f.Application.Name)
+			if f.Application.Name == "foo" && dir != root {
+				t.Fatalf("bad dir: %s", dir)
+			}
+
+			f.Application.Type = "loaded"
+			return f, nil
+		}
+
+		f := testFile(t, "compile-deps")
+		defer f.resetID()
+		c, err := testCompiler(t, opts).Compile(f)
+		if err != nil {
+			t.Fatalf("%v err: %s", tc.LoadRoot, err)
+		}
+
+		sort.Strings(names)
+		if !reflect.DeepEqual(names, tc.Names) {
+			t.Fatalf("%v bad: %#v", tc.LoadRoot, names)
+		}
+
+		// Only the loaded root has the changes of the Loader
+		loaded := c.File.Application.Type == "loaded"
+		if loaded != tc.LoadRoot {
+			t.Fatalf("%v bad: %#v", tc.LoadRoot, c.File.Application)
+		}
+	}
+}
+
+func TestCompile_events(t *testing.T) {
+	cases := []struct {
+		Buffer int
+		Count  int
+	}{
+		{10, 5},
+		{1, 1},
+	}
+
+	for _, tc := range cases {
+		events := make(chan CompileEvent, tc.Buffer)
+		opts := testCompileOpts(t)
+		opts.Events = events
+		defer os.RemoveAll(opts.Dir)
+
+		var called int
+		opts.Callback = func(CompileEvent) { called++ }
+
+		f := testFile(t, "compile-multi-dep")
+		defer f.resetID()
+		if _, err := testCompiler(t, opts).Compile(f); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		if called != 5 {
+			t.Fatalf("bad callback count for buffer %d: %d", tc.Buffer, called)
+		}
+		if len(events) != tc.Count {
+			t.Fatalf("bad event count for buffer %d: %d", tc.Buffer, len(events))
+		}
+		for len(events) > 0 {
+			switch e := (<-events).(type) {
+			case *CompileEventStart:
+			case *CompileEventDep:
+			case *CompileEventPlan:
+			case *CompileEventFinish:
+			default:
+				t.Fatalf("bad event type for buffer %d: %#v", tc.Buffer, e)
+			}
+		}
+	}
+}
+
+func TestCompile_traversalOrder(t *testing.T) {
+	cases := []struct {
+		Order  TraversalOrder
+		Result []string
+	}{
+		{TraversalDFS, []string{"b", "a", "c", "d"}},
+		{TraversalBFS, []string{"a", "b", "c", "d"}},
+	}
+
+	for _, tc := range cases {
+		opts := testCompileOpts(t)
+		opts.TraversalOrder = tc.Order
+		defer os.RemoveAll(opts.Dir)
+
+		var actual []string
+		opts.Callback = func(raw CompileEvent) {
+			if e, ok := raw.(*CompileEventDep); ok {
+				actual = append(actual, filepath.Base(e.Source))
+			}
+		}
+
+		f := testFile(t, "compile-deps-order")
+		defer f.resetID()
+		if _, err := testCompiler(t, opts).Compile(f); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		if !reflect.DeepEqual(actual, tc.Result) {
+			t.Fatalf("bad order for %d: %#v", tc.Order, actual)
+		}
+	}
+}
+
+func TestCompileAndValidate(t *testing.T) {
+	cases := []struct {
+		Dir string
+		Err bool
+	}{
+		{"compile-basic", false},
+		{"compile-deps", false},
+		{"compile-invalid", true},
+		{"compile-deps-no-id", true},
+	}
+
+	for _, tc := range cases {
+		opts := testCompileOpts(t)
+		defer os.RemoveAll(opts.Dir)
+
+		f := testFile(t, tc.Dir)
+		err := testCompiler(t, opts).CompileAndValidate(f)
+		if (err != nil) != tc.Err {
+			t.Fatalf("%s err: %s", tc.Dir, err)
+		}
+
+		// Nothing should be written
+		for _, name := range []string{CompileFilename, CompileVersionFilename} {
+			if _, err := os.Stat(filepath.Join(opts.Dir, name)); !os.IsNotExist(err) {
+				t.Fatalf("%s: %s shouldn't exist: %s", tc.Dir, name, err)
+			}
+		}
+		if ok, err := f.hasID(); err != nil || ok {
+			t.Fatalf("%s: ID shouldn't be written: %s", tc.Dir, err)
+		}
+	}
+}
+
+func TestCompile_start(t *testing.T) {
 	opts := testCompileOpts(t)
 	defer os.RemoveAll(opts.Dir)
-	f := testFile(t, "compile-id")
+
+	var actual []CompileEventStart
+	opts.Callback = func(raw CompileEvent) {
+		if e, ok := raw.(*CompileEventStart); ok {
+			actual = append(actual, *e)
+		}
+	}
+
+	f := testFile(t, "compile-deps")
 	defer f.resetID()
+	compiler := testCompiler(t, opts)
+	for i := 0; i < 2; i++ {
+		if _, err := compiler.Compile(f); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
 
-	c, err := testCompiler(t, opts).Compile(f)
-	if err != nil {
+	// Update always fetches everything again
+	opts.Update = true
+	if _, err := testCompiler(t, opts).Compile(f); err != nil {
 		t.Fatalf("err: %s", err)
 	}
 
-	if f.ID == "" {
-		t.Fatalf("ID should not be blank")
+	expected := []CompileEventStart{
+		CompileEventStart{Name: "foo", Fresh: true},
+		CompileEventStart{Name: "foo", Fresh: false},
+		CompileEventStart{Name: "foo", Fresh: true},
 	}
-	if f.ID != c.File.ID {
-		t.Fatalf("%s != %s", f.ID, c.File.ID)
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("bad: %#v", actual)
 	}
 }
 
-func TestCompileID_existing(t *testing.T) {
+func TestCompile_plan(t *testing.T) {
 	opts := testCompileOpts(t)
 	defer os.RemoveAll(opts.Dir)
-	f := testFile(t, "compile-id-exists")
-	if f.ID == "" {
-		t.Fatalf("ID should not be blank")
+
+	var actual []CompileEventPlan
+	opts.Callback = func(raw CompileEvent) {
+		if e, ok := raw.(*CompileEventPlan); ok {
+			actual = append(actual, *e)
+		}
 	}
 
-	copyId := f.ID
-	c, err := testCompiler(t, opts).Compile(f)
-	if err != nil {
+	f := testFile(t, "compile-deps-order")
+	defer f.resetID()
+	if _, err := testCompiler(t, opts).Compile(f); err != nil {
 		t.Fatalf("err: %s", err)
 	}
 
-	if copyId != c.File.ID {
-		t.Fatalf("%s != %s", f.ID, c.File.ID)
+	expected := []CompileEventPlan{
+		CompileEventPlan{DirectDeps: 2, TotalDeps: 2},
+		CompileEventPlan{DirectDeps: 2, TotalDeps: 3},
+		CompileEventPlan{DirectDeps: 2, TotalDeps: 4},
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("bad: %#v", actual)
 	}
 }
 
-func TestLoadCompile_new(t *testing.T) {
-	path := filepath.Join("./test-fixtures", "load-new")
-	_, err := LoadCompiled(path)
-	if err == nil {
-		t.Fatal("should error")
+func TestCompile_vertexHook(t *testing.T) {
+	cases := []struct {
+		Fail string
+		Err  string
+	}{
+		{"", ""},
+		{"foo", "application 'foo': nope"},
+		{"bar", "application 'bar': nope\n\nDependency chain: foo -> "},
+	}
+
+	for _, tc := range cases {
+		opts := testCompileOpts(t)
+		defer os.RemoveAll(opts.Dir)
+
+		var names []string
+		opts.VertexHook = func(v *CompiledGraphVertex) error {
+			names = append(names, v.Name())
+			if v.Name() == tc.Fail {
+				return fmt.Errorf("nope")
+			}
+
+			return nil
+		}
+
+		f := testFile(t, "compile-deps")
+		defer f.resetID()
+		_, err := testCompiler(t, opts).Compile(f)
+		if tc.Err == "" {
+			if err != nil {
+				t.Fatalf("err: %s", err)
+			}
+			if !reflect.DeepEqual(names, []string{"foo", "bar"}) {
+				t.Fatalf("bad: %#v", names)
+			}
+
+			continue
+		}
+
+		if err == nil || !strings.Contains(err.Error(), tc.Err) {
+			t.Fatalf("%s bad: %s", tc.Fail, err)
+		}
 	}
 }
 
-func testCompileCompare(t *testing.T, c *Compiled, expected string) {
-	actual := strings.TrimSpace(c.String())
-	expected = strings.TrimSpace(fmt.Sprintf(expected, c.File.Path))
-	if actual != expected {
-		t.Fatalf("bad:\n\n%s\n\n%s", actual, expected)
+func TestCompile_logger(t *testing.T) {
+	var buf bytes.Buffer
+	opts := testCompileOpts(t)
+	opts.Logger = log.New(&buf, "", 0)
+	defer os.RemoveAll(opts.Dir)
+
+	f := testFile(t, "compile-deps")
+	defer f.resetID()
+	if _, err := testCompiler(t, opts).Compile(f); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if !strings.Contains(buf.String(), "loading dependency") {
+		t.Fatalf("bad: %s", buf.String())
 	}
 }
 
-func testCompileMarshal(t *testing.T, original *Compiled, dir string) {
-	c, err := LoadCompiled(dir)
-	if err != nil {
-		t.Fatalf("err loading compiled: %s", err)
+func TestCompile_maxTotalBytes(t *testing.T) {
+	cases := []struct {
+		Max int64
+		Err bool
+	}{
+		{0, false},
+		{1024 * 1024, false},
+		{1, true},
 	}
 
-	if c.String() != original.String() {
-		t.Fatalf("bad:\n\n%s\n\n%s", c, original)
+	for _, tc := range cases {
+		opts := testCompileOpts(t)
+		opts.MaxTotalBytes = tc.Max
+		defer os.RemoveAll(opts.Dir)
+
+		f := testFile(t, "compile-multi-dep")
+		defer f.resetID()
+		_, err := testCompiler(t, opts).Compile(f)
+		if (err != nil) != tc.Err {
+			t.Fatalf("max %d err: %s", tc.Max, err)
+		}
+		if err != nil && !strings.Contains(err.Error(), "maximum total") {
+			t.Fatalf("max %d bad err: %s", tc.Max, err)
+		}
 	}
 }
 
-func testCompileOpts(t *testing.T) *CompileOpts {
-	dir, err := ioutil.TempDir("", "otto-")
+func TestCompile_maxParallelImports(t *testing.T) {
+	td, err := ioutil.TempDir("", "otto")
 	if err != nil {
 		t.Fatalf("err: %s", err)
 	}
+	defer os.RemoveAll(td)
 
-	return &CompileOpts{
-		Dir:    dir,
-		Loader: nil,
+	// Build a tree of imports that is 3 deep with 4 imports per Appfile,
+	// for 84 imports in total.
+	testImportTree(t, td, 4, 3)
+	root := `
+application {
+    name = "foo"
+    type = "foo"
+}
+
+project {
+    name = "foo"
+    infrastructure = "aws"
+}
+
+infrastructure "aws" {}
+`
+	path := filepath.Join(td, "Appfile")
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := ioutil.WriteFile(path, append(data, root...), 0644); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	f, err := ParseFile(path)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	opts := testCompileOpts(t)
+	opts.MaxParallelImports = 3
+	defer os.RemoveAll(opts.Dir)
+
+	compiler := testCompiler(t, opts)
+	storage := &testConcurrentStorage{Storage: compiler.importStorage}
+	compiler.importStorage = storage
+	if _, err := compiler.Compile(f); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	stats, err := compiler.Stats()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if stats.ImportsFetched != 84 {
+		t.Fatalf("bad: %#v", stats)
+	}
+	if storage.peak > opts.MaxParallelImports {
+		t.Fatalf("bad: %d", storage.peak)
 	}
 }
 
-func testCompiler(t *testing.T, opts *CompileOpts) *Compiler {
-	c, err := NewCompiler(opts)
+func TestCompile_appfileFilename(t *testing.T) {
+	opts := testCompileOpts(t)
+	opts.AppfileFilename = "Appfile.hcl"
+	opts.AppfileDir = "otto"
+	defer os.RemoveAll(opts.Dir)
+
+	f := testFile(t, "compile-deps-appfile-name")
+	defer f.resetID()
+	c, err := testCompiler(t, opts).Compile(f)
 	if err != nil {
 		t.Fatalf("err: %s", err)
 	}
 
-	return c
+	testCompileCompare(t, c, testCompileMultiDepStr)
 }
 
-func testFile(t *testing.T, dir string) *File {
-	path := filepath.Join("./test-fixtures", dir, "Appfile")
-	f, err := ParseFile(path)
+func TestCompilerStats(t *testing.T) {
+	opts := testCompileOpts(t)
+	defer os.RemoveAll(opts.Dir)
+
+	f := testFile(t, "import-dep")
+	defer f.resetID()
+	compiler := testCompiler(t, opts)
+
+	// The second compile reuses the imports from the first
+	expected := []CompileStats{
+		CompileStats{DepsFetched: 1, ImportsFetched: 1},
+		CompileStats{DepsCached: 1, ImportsCached: 1},
+	}
+	for i, e := range expected {
+		if _, err := compiler.Compile(f); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		stats, err := compiler.Stats()
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if !reflect.DeepEqual(*stats, e) {
+			t.Fatalf("%d bad: %#v", i, stats)
+		}
+	}
+
+	// Disk usage counts the stored files
+	data := []byte("hello")
+	path := filepath.Join(opts.Dir, CompileDepsFolder, "file")
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	stats, err := compiler.Stats()
 	if err != nil {
-		t.Fatalf("err: %s\n\n%s", path, err)
+		t.Fatalf("err: %s", err)
 	}
+	if stats.DiskUsage != int64(len(data)) {
+		t.Fatalf("bad: %d", stats.DiskUsage)
+	}
+}
 
-	return f
+func TestCompilerStats_diamond(t *testing.T) {
+	opts := testCompileOpts(t)
+	defer os.RemoveAll(opts.Dir)
+
+	f := testFile(t, "compile-deps-diamond")
+	defer f.resetID()
+	compiler := testCompiler(t, opts)
+	if _, err := compiler.Compile(f); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Dependencies reached through more than one path are only counted
+	// once, and aren't cached since they weren't stored before.
+	stats, err := compiler.Stats()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	expected := CompileStats{DepsFetched: 4}
+	if !reflect.DeepEqual(*stats, expected) {
+		t.Fatalf("bad: %#v", stats)
+	}
 }
 
-const testCompileBasicStr = `
-Compiled Appfile: %s
+func TestCompile_importCacheTTL(t *testing.T) {
+	cases := []struct {
+		TTL    time.Duration
+		Result CompileStats
+	}{
+		{0, CompileStats{DepsCached: 1, ImportsCached: 1}},
+		{time.Hour, CompileStats{DepsCached: 1, ImportsCached: 1}},
+		{time.Nanosecond, CompileStats{DepsCached: 1, ImportsFetched: 1}},
+	}
 
-Dep Graph:
-foo
-`
+	for _, tc := range cases {
+		opts := testCompileOpts(t)
+		opts.ImportCacheTTL = tc.TTL
+		defer os.RemoveAll(opts.Dir)
 
-const testCompileDepsStr = `
-Compiled Appfile: %s
+		f := testFile(t, "import-dep")
+		defer f.resetID()
+		compiler := testCompiler(t, opts)
+		for i := 0; i < 2; i++ {
+			if _, err := compiler.Compile(f); err != nil {
+				t.Fatalf("%s err: %s", tc.TTL, err)
+			}
+		}
 
-Dep Graph:
-bar
+		stats, err := compiler.Stats()
+		if err != nil {
+			t.Fatalf("%s err: %s", tc.TTL, err)
+		}
+		stats.DiskUsage = 0
+		if !reflect.DeepEqual(*stats, tc.Result) {
+			t.Fatalf("%s bad: %#v", tc.TTL, stats)
+		}
+	}
+}
+
+func TestCompilerClose(t *testing.T) {
+	for _, remove := range []bool{false, true} {
+		opts := testCompileOpts(t)
+		opts.RemoveOnClose = remove
+		defer os.RemoveAll(opts.Dir)
+
+		f := testFile(t, "import-dep")
+		defer f.resetID()
+		compiler := testCompiler(t, opts)
+		if _, err := compiler.Compile(f); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if err := compiler.Close(); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		if compiler.importCache.Len() != 0 {
+			t.Fatalf("%v: imports should be cleared", remove)
+		}
+
+		_, err := os.Stat(filepath.Join(opts.Dir, CompileDepsFolder))
+		if remove != os.IsNotExist(err) {
+			t.Fatalf("%v bad: %s", remove, err)
+		}
+
+		// The compiled Appfile should be kept
+		if _, err := os.Stat(filepath.Join(opts.Dir, CompileFilename)); err != nil {
+			t.Fatalf("%v err: %s", remove, err)
+		}
+	}
+}
+
+func TestCompile_update(t *testing.T) {
+	cases := []struct {
+		Update bool
+		Result CompileStats
+	}{
+		{false, CompileStats{DepsCached: 1, ImportsCached: 1}},
+		{true, CompileStats{DepsFetched: 1, ImportsFetched: 1}},
+	}
+
+	for _, tc := range cases {
+		opts := testCompileOpts(t)
+		defer os.RemoveAll(opts.Dir)
+
+		f := testFile(t, "import-dep")
+		defer f.resetID()
+		if _, err := testCompiler(t, opts).Compile(f); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		// Compile again with a new compiler so only the stored copies
+		// in the compilation directory can be reused.
+		opts.Update = tc.Update
+		compiler := testCompiler(t, opts)
+		if _, err := compiler.Compile(f); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		stats, err := compiler.Stats()
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		stats.DiskUsage = 0
+		if !reflect.DeepEqual(*stats, tc.Result) {
+			t.Fatalf("update %v bad: %#v", tc.Update, stats)
+		}
+	}
+}
+
+func TestCompiledValidate_unreachable(t *testing.T) {
+	opts := testCompileOpts(t)
+	defer os.RemoveAll(opts.Dir)
+
+	f := testFile(t, "compile-deps")
+	defer f.resetID()
+	c, err := testCompiler(t, opts).Compile(f)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := c.Validate(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Add a vertex that isn't reachable from the root
+	orphan := &CompiledGraphVertex{
+		File:      &File{Application: &Application{Name: "orphan"}},
+		NameValue: "orphan",
+	}
+	c.Graph.Add(orphan)
+
+	err = c.Validate()
+	if err == nil {
+		t.Fatal("should error")
+	}
+	if !strings.Contains(err.Error(), "'orphan' isn't reachable") {
+		t.Fatalf("bad: %s", err)
+	}
+}
+
+func TestCompiledValidateWithOpts_failFast(t *testing.T) {
+	opts := testCompileOpts(t)
+	defer os.RemoveAll(opts.Dir)
+
+	f := testFile(t, "compile-multi-dep")
+	defer f.resetID()
+	c, err := testCompiler(t, opts).Compile(f)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Make all the dependencies invalid
+	var sources []string
+	for _, raw := range c.Graph.Vertices() {
+		v := raw.(*CompiledGraphVertex)
+		if v.File.Source != "" {
+			v.File.Application = nil
+			sources = append(sources, v.File.Source)
+		}
+	}
+
+	cases := []struct {
+		FailFast bool
+		Count    int
+	}{
+		{false, 2},
+		{true, 1},
+	}
+
+	for _, tc := range cases {
+		err := c.ValidateWithOpts(&ValidateOpts{FailFast: tc.FailFast})
+		if err == nil {
+			t.Fatalf("%v: should error", tc.FailFast)
+		}
+
+		var count int
+		for _, s := range sources {
+			if strings.Contains(err.Error(), s) {
+				count++
+			}
+		}
+		if count != tc.Count {
+			t.Fatalf("%v bad: %s", tc.FailFast, err)
+		}
+	}
+}
+
+func BenchmarkCompiledValidate(b *testing.B) {
+	benchmarkCompiledValidate(b, 0)
+}
+
+func BenchmarkCompiledValidate_serial(b *testing.B) {
+	benchmarkCompiledValidate(b, 1)
+}
+
+func benchmarkCompiledValidate(b *testing.B, parallel int) {
+	f, err := ParseFile(filepath.Join("./test-fixtures", "compile-basic", "Appfile"))
+	if err != nil {
+		b.Fatalf("err: %s", err)
+	}
+
+	// Build a tree of 500 applications
+	vertices := make([]*CompiledGraphVertex, 500)
+	graph := new(dag.AcyclicGraph)
+	for i := range vertices {
+		vertices[i] = &CompiledGraphVertex{
+			File:      f,
+			NameValue: fmt.Sprintf("app-%d", i),
+		}
+		graph.Add(vertices[i])
+		if i > 0 {
+			graph.Connect(dag.BasicEdge(vertices[(i-1)/2], vertices[i]))
+		}
+	}
+
+	c := &Compiled{File: f, Graph: graph}
+	opts := &ValidateOpts{Parallelism: parallel}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := c.ValidateWithOpts(opts); err != nil {
+			b.Fatalf("err: %s", err)
+		}
+	}
+}
+
+func TestCompiledSubgraph(t *testing.T) {
+	opts := testCompileOpts(t)
+	defer os.RemoveAll(opts.Dir)
+
+	f := testFile(t, "compile-multi-dep")
+	defer f.resetID()
+	c, err := testCompiler(t, opts).Compile(f)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	cases := []struct {
+		Name  string
+		Graph string
+		Err   bool
+	}{
+		{"foo", "bar\nbaz\nfoo\n  bar\n  baz", false},
+		{"bar", "bar", false},
+		{"nope", "", true},
+	}
+
+	for _, tc := range cases {
+		sub, err := c.Subgraph(tc.Name)
+		if (err != nil) != tc.Err {
+			t.Fatalf("%s err: %s", tc.Name, err)
+		}
+		if err != nil {
+			continue
+		}
+
+		if sub.File.Application.Name != tc.Name {
+			t.Fatalf("%s bad file: %#v", tc.Name, sub.File.Application)
+		}
+
+		actual := strings.TrimSpace(sub.Graph.String())
+		if actual != tc.Graph {
+			t.Fatalf("%s bad graph:\n\n%s", tc.Name, actual)
+		}
+	}
+}
+
+func TestCompiledIDs(t *testing.T) {
+	opts := testCompileOpts(t)
+	defer os.RemoveAll(opts.Dir)
+
+	f := testFile(t, "compile-multi-dep")
+	defer f.resetID()
+	c, err := testCompiler(t, opts).Compile(f)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := map[string]string{
+		"foo": f.ID,
+		"bar": "foo",
+		"baz": "bar",
+	}
+	if actual := c.IDs(); !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("bad: %#v", actual)
+	}
+}
+
+func TestCompiledDependents(t *testing.T) {
+	opts := testCompileOpts(t)
+	defer os.RemoveAll(opts.Dir)
+
+	f := testFile(t, "compile-deps-transitive")
+	defer f.resetID()
+	c, err := testCompiler(t, opts).Compile(f)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	cases := []struct {
+		Name       string
+		Transitive bool
+		Result     []string
+	}{
+		{"baz", false, []string{"bar"}},
+		{"baz", true, []string{"bar", "foo"}},
+		{"bar", false, []string{"foo"}},
+		{"foo", true, []string{}},
+		{"nope", true, nil},
+	}
+
+	for _, tc := range cases {
+		vs := c.Dependents(tc.Name, tc.Transitive)
+
+		var actual []string
+		if vs != nil {
+			actual = make([]string, len(vs))
+			for i, v := range vs {
+				actual[i] = v.Name()
+			}
+		}
+
+		if !reflect.DeepEqual(actual, tc.Result) {
+			t.Fatalf("%s (%v) bad: %#v", tc.Name, tc.Transitive, actual)
+		}
+	}
+}
+
+func TestCompiledWhyDepended(t *testing.T) {
+	opts := testCompileOpts(t)
+	defer os.RemoveAll(opts.Dir)
+
+	f := testFile(t, "compile-deps-diamond")
+	defer f.resetID()
+	c, err := testCompiler(t, opts).Compile(f)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	cases := []struct {
+		Name   string
+		Result []string
+	}{
+		{"logging", []string{
+			"foo -> api -> auth -> logging",
+			"foo -> web -> auth -> logging",
+		}},
+		{"web", []string{"foo -> web"}},
+		{"foo", []string{"foo"}},
+		{"nope", nil},
+	}
+
+	for _, tc := range cases {
+		var actual []string
+		for _, path := range c.WhyDepended(tc.Name) {
+			names := make([]string, len(path))
+			for i, v := range path {
+				names[i] = v.Name()
+			}
+			actual = append(actual, strings.Join(names, " -> "))
+		}
+
+		if !reflect.DeepEqual(actual, tc.Result) {
+			t.Fatalf("%s bad: %#v", tc.Name, actual)
+		}
+	}
+}
+
+func TestCompiledUnused(t *testing.T) {
+	cases := []struct {
+		Dir    string
+		Result []string
+	}{
+		{"compile-deps-unused", []string{"auth", "logging"}},
+		{"compile-deps-diamond", []string{}},
+		{"compile-basic", []string{}},
+	}
+
+	for _, tc := range cases {
+		opts := testCompileOpts(t)
+		defer os.RemoveAll(opts.Dir)
+
+		f := testFile(t, tc.Dir)
+		defer f.resetID()
+		c, err := testCompiler(t, opts).Compile(f)
+		if err != nil {
+			t.Fatalf("%s err: %s", tc.Dir, err)
+		}
+
+		vs := c.Unused()
+		actual := make([]string, len(vs))
+		for i, v := range vs {
+			actual[i] = v.Name()
+		}
+		if !reflect.DeepEqual(actual, tc.Result) {
+			t.Fatalf("%s bad: %#v", tc.Dir, actual)
+		}
+	}
+}
+
+func TestCompile_activeTags(t *testing.T) {
+	cases := []struct {
+		Tags   []string
+		Result []string
+	}{
+		{nil, []string{"child", "foo"}},
+		{[]string{"dev"}, []string{"child", "foo"}},
+		{[]string{"dev", "prod"}, []string{"child", "foo", "monitoring"}},
+	}
+
+	for _, tc := range cases {
+		opts := testCompileOpts(t)
+		opts.ActiveTags = tc.Tags
+		defer os.RemoveAll(opts.Dir)
+
+		f := testFile(t, "compile-deps-tags")
+		defer f.resetID()
+		c, err := testCompiler(t, opts).Compile(f)
+		if err != nil {
+			t.Fatalf("%v err: %s", tc.Tags, err)
+		}
+
+		actual := make([]string, 0)
+		for name := range c.IDs() {
+			actual = append(actual, name)
+		}
+		sort.Strings(actual)
+		if !reflect.DeepEqual(actual, tc.Result) {
+			t.Fatalf("%v bad: %#v", tc.Tags, actual)
+		}
+	}
+}
+
+func TestCompiledFilterByLabel(t *testing.T) {
+	opts := testCompileOpts(t)
+	defer os.RemoveAll(opts.Dir)
+
+	f := testFile(t, "compile-labels")
+	defer f.resetID()
+	c, err := testCompiler(t, opts).Compile(f)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// The labels are kept when loading lazily, without loading the Files
+	lazy, err := LoadCompiledLazy(opts.Dir)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	cases := []struct {
+		Key, Value string
+		Result     []string
+	}{
+		{"team", "payments", []string{"api", "web"}},
+		{"team", "search", []string{"worker"}},
+		{"team", "", []string{}},
+		{"tier", "payments", []string{}},
+	}
+
+	for _, compiled := range []*Compiled{c, lazy} {
+		for _, tc := range cases {
+			vs := compiled.FilterByLabel(tc.Key, tc.Value)
+			actual := make([]string, len(vs))
+			for i, v := range vs {
+				actual[i] = v.Name()
+			}
+			if !reflect.DeepEqual(actual, tc.Result) {
+				t.Fatalf("%s=%s bad: %#v", tc.Key, tc.Value, actual)
+			}
+		}
+	}
+}
+
+func TestCompile_mixedCycle(t *testing.T) {
+	opts := testCompileOpts(t)
+	defer os.RemoveAll(opts.Dir)
+
+	// The child depends on nothing itself, but it imports the root,
+	// which depends on the child.
+	f := testFile(t, "compile-cycle-mixed")
+	defer f.resetID()
+	_, err := testCompiler(t, opts).Compile(f)
+	if err == nil {
+		t.Fatal("should error")
+	}
+
+	root := filepath.Dir(f.Path)
+	expected := fmt.Sprintf("Cycle found:\n\n  %s\n    depends on %s\n    imports %s",
+		"file://"+root, "file://"+filepath.Join(root, "child"), "file://"+root)
+	if !strings.Contains(err.Error(), expected) {
+		t.Fatalf("bad: %s", err)
+	}
+}
+
+func TestCompilerDetect(t *testing.T) {
+	opts := testCompileOpts(t)
+	defer os.RemoveAll(opts.Dir)
+	c := testCompiler(t, opts)
+
+	for i := 0; i < 2; i++ {
+		actual, err := c.detect("./foo", "/bar")
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if actual != "file:///bar/foo" {
+			t.Fatalf("bad: %s", actual)
+		}
+	}
+
+	if len(c.detectCache) != 1 {
+		t.Fatalf("bad: %#v", c.detectCache)
+	}
+}
+
+func TestCompilerGet_subdir(t *testing.T) {
+	opts := testCompileOpts(t)
+	defer os.RemoveAll(opts.Dir)
+	c := testCompiler(t, opts)
+
+	pwd, err := filepath.Abs("./test-fixtures/compile-deps-subdir")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	source, err := c.detect("./repo//child", pwd)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	expected := "file://" + filepath.Join(pwd, "repo") + "//child"
+	if source != expected {
+		t.Fatalf("bad: %s", source)
+	}
+
+	for i, update := range []bool{true, false} {
+		dir, _, err := c.get(context.Background(), c.depStorage, source, update)
+		if err != nil {
+			t.Fatalf("%d err: %s", i, err)
+		}
+		if _, err := os.Stat(filepath.Join(dir, "Appfile")); err != nil {
+			t.Fatalf("%d err: %s", i, err)
+		}
+
+		// The root of the source is what's stored
+		root, ok, err := c.depStorage.Dir("file://" + filepath.Join(pwd, "repo"))
+		if err != nil {
+			t.Fatalf("%d err: %s", i, err)
+		}
+		if !ok || dir != filepath.Join(root, "child") {
+			t.Fatalf("%d bad: %s (%s)", i, dir, root)
+		}
+	}
+}
+
+func TestCompile_concurrent(t *testing.T) {
+	opts := testCompileOpts(t)
+	defer os.RemoveAll(opts.Dir)
+	c := testCompiler(t, opts)
+
+	names := []string{"one", "two"}
+	files := make([]*File, len(names))
+	for i, n := range names {
+		files[i] = testFile(t, filepath.Join("compile-import-shared", n))
+		defer files[i].resetID()
+
+		// Compile once first so the IDs are written
+		if _, err := c.Compile(files[i]); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+
+	var wg sync.WaitGroup
+	errCh := make(chan error, 10*len(names))
+	for i := 0; i < 10; i++ {
+		for j, n := range names {
+			wg.Add(1)
+			go func(n string, path string) {
+				defer wg.Done()
+
+				f, err := ParseFile(path)
+				if err != nil {
+					errCh <- err
+					return
+				}
+
+				compiled, err := c.Compile(f)
+				if err != nil {
+					errCh <- err
+					return
+				}
+
+				app := compiled.File.Application
+				if app.Name != n || app.Type != "shared" {
+					errCh <- fmt.Errorf("bad: %#v", app)
+				}
+
+				// Only "one" has foundations
+				infra := compiled.File.ActiveInfrastructure()
+				if (len(infra.Foundations) > 0) != (n == "one") {
+					errCh <- fmt.Errorf("%s bad: %#v", n, infra)
+				}
+			}(n, files[j].Path)
+		}
+	}
+
+	wg.Wait()
+	close(errCh)
+	for err := range errCh {
+		t.Fatalf("err: %s", err)
+	}
+
+	// The compiled output must be from one of the compilations
+	compiled, err := LoadCompiled(opts.Dir)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if n := compiled.File.Application.Name; n != "one" && n != "two" {
+		t.Fatalf("bad: %s", n)
+	}
+
+	// The cached import must not be modified by the merges
+	for _, key := range c.importCache.Keys() {
+		e, _ := c.importCache.Get(key)
+		f := e.File
+		if f.Application.Name != "" {
+			t.Fatalf("cache poisoned: %#v", f.Application)
+		}
+		if len(f.Infrastructure[0].Foundations) > 0 {
+			t.Fatalf("cache poisoned: %#v", f.Infrastructure[0])
+		}
+	}
+}
+
+func TestCompile_selfID(t *testing.T) {
+	opts := testCompileOpts(t)
+	defer os.RemoveAll(opts.Dir)
+
+	// This fixture has a committed ID so we don't reset it
+	f := testFile(t, "compile-deps-self-id")
+	_, err := testCompiler(t, opts).Compile(f)
+	if err == nil {
+		t.Fatal("should error")
+	}
+	if !strings.Contains(err.Error(), "foo -> child") {
+		t.Fatalf("bad: %s", err)
+	}
+}
+
+func TestCompile_depChain(t *testing.T) {
+	opts := testCompileOpts(t)
+	defer os.RemoveAll(opts.Dir)
+
+	f := testFile(t, "compile-deps-chain")
+	defer f.resetID()
+	_, err := testCompiler(t, opts).Compile(f)
+	if err == nil {
+		t.Fatal("should error")
+	}
+
+	source := "file://" + filepath.Join(
+		filepath.Dir(f.Path), "a", "b")
+	if !strings.Contains(err.Error(), "root -> a -> "+source) {
+		t.Fatalf("bad: %s", err)
+	}
+}
+
+func TestCompile_partial(t *testing.T) {
+	opts := testCompileOpts(t)
+	defer os.RemoveAll(opts.Dir)
+
+	f := testFile(t, "compile-deps-chain")
+	defer f.resetID()
+	_, err := testCompiler(t, opts).Compile(f)
+	cerr, ok := err.(*CompileError)
+	if !ok {
+		t.Fatalf("bad: %#v", err)
+	}
+
+	// The dependency that loaded should be in the graph
+	var names []string
+	for _, raw := range cerr.Partial.Graph.Vertices() {
+		names = append(names, raw.(*CompiledGraphVertex).Name())
+	}
+	sort.Strings(names)
+	if !reflect.DeepEqual(names, []string{"a", "root"}) {
+		t.Fatalf("bad: %#v", names)
+	}
+}
+
+func TestCompile_duplicateID(t *testing.T) {
+	opts := testCompileOpts(t)
+	defer os.RemoveAll(opts.Dir)
+
+	f := testFile(t, "compile-deps-fork-id")
+	defer f.resetID()
+	_, err := testCompiler(t, opts).Compile(f)
+	if err == nil {
+		t.Fatal("should error")
+	}
+	if !strings.Contains(err.Error(), "same Otto ID") {
+		t.Fatalf("bad: %s", err)
+	}
+}
+
+func TestCompile_duplicateIDFilename(t *testing.T) {
+	opts := testCompileOpts(t)
+	opts.IDFilename = filepath.Join(".otto", "id")
+	defer os.RemoveAll(opts.Dir)
+
+	f := testFile(t, "compile-deps-fork-id-filename")
+	defer os.RemoveAll(filepath.Join(filepath.Dir(f.Path), ".otto"))
+	_, err := testCompiler(t, opts).Compile(f)
+	if err == nil {
+		t.Fatal("should error")
+	}
+
+	// The message names the configured ID file
+	expected := fmt.Sprintf("delete the\n%s file", opts.IDFilename)
+	if !strings.Contains(err.Error(), expected) {
+		t.Fatalf("bad: %s", err)
+	}
+}
+
+func TestCompile_allowMissingDepID(t *testing.T) {
+	var warnings []*CompileEventWarning
+	opts := testCompileOpts(t)
+	opts.AllowMissingDepID = true
+	opts.Callback = func(raw CompileEvent) {
+		if e, ok := raw.(*CompileEventWarning); ok {
+			warnings = append(warnings, e)
+		}
+	}
+	defer os.RemoveAll(opts.Dir)
+
+	f := testFile(t, "compile-deps-missing-id")
+	defer f.resetID()
+	c, err := testCompiler(t, opts).Compile(f)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if len(warnings) != 1 {
+		t.Fatalf("bad: %#v", warnings)
+	}
+	for _, raw := range c.Graph.Vertices() {
+		if v := raw.(*CompiledGraphVertex); v.File.ID == "" {
+			t.Fatalf("no ID: %s", v.Name())
+		}
+	}
+}
+
+func TestCompile_allowMissingLocalDepID(t *testing.T) {
+	var warnings []*CompileEventWarning
+	opts := testCompileOpts(t)
+	opts.AllowMissingLocalDepID = true
+	opts.Callback = func(raw CompileEvent) {
+		if e, ok := raw.(*CompileEventWarning); ok {
+			warnings = append(warnings, e)
+		}
+	}
+	defer os.RemoveAll(opts.Dir)
+
+	f := testFile(t, "compile-deps-missing-id")
+	defer f.resetID()
+	c, err := testCompiler(t, opts).Compile(f)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if len(warnings) != 1 {
+		t.Fatalf("bad: %#v", warnings)
+	}
+	for _, raw := range c.Graph.Vertices() {
+		if v := raw.(*CompiledGraphVertex); v.File.ID == "" {
+			t.Fatalf("no ID: %s", v.Name())
+		}
+	}
+}
+
+func TestIsLocalSource(t *testing.T) {
+	cases := []struct {
+		Source string
+		Local  bool
+	}{
+		{"file:///foo/bar", true},
+		{"file::/foo/bar", true},
+		{"git::https://github.com/foo/bar.git", false},
+		{"https://example.com/foo.tar.gz", false},
+		{"s3::https://s3.amazonaws.com/bucket/foo", false},
+	}
+
+	for _, tc := range cases {
+		if actual := isLocalSource(tc.Source); actual != tc.Local {
+			t.Fatalf("bad: %s: %v", tc.Source, actual)
+		}
+	}
+}
+
+func TestLocalSourcePath(t *testing.T) {
+	cases := []struct {
+		Source string
+		Path   string
+		Local  bool
+	}{
+		{"file:///foo/bar", "/foo/bar", true},
+		{"file::/foo/bar", "/foo/bar", true},
+		{"file:///foo/bar//baz", "/foo/bar/baz", true},
+		{"git::https://github.com/foo/bar.git", "", false},
+		{"root", "", false},
+	}
+
+	for _, tc := range cases {
+		path, ok := localSourcePath(tc.Source)
+		if ok != tc.Local || path != filepath.FromSlash(tc.Path) {
+			t.Fatalf("bad: %s: %s %v", tc.Source, path, ok)
+		}
+	}
+}
+
+func TestCompile_localSibling(t *testing.T) {
+	for _, content := range []bool{false, true} {
+		opts := testCompileOpts(t)
+		opts.ContentAddressable = content
+		defer os.RemoveAll(opts.Dir)
+
+		// The dependencies are read from the storage, but "../db" must
+		// still resolve against the original directory of api.
+		f := testFile(t, "compile-deps-sibling")
+		defer f.resetID()
+		c, err := testCompiler(t, opts).Compile(f)
+		if err != nil {
+			t.Fatalf("%v err: %s", content, err)
+		}
+
+		actual := strings.TrimSpace(c.Graph.String())
+		expected := strings.TrimSpace(testCompileLocalSiblingStr)
+		if actual != expected {
+			t.Fatalf("%v bad:\n\n%s", content, actual)
+		}
+	}
+}
+
+func TestCompile_noPath(t *testing.T) {
+	opts := testCompileOpts(t)
+	defer os.RemoveAll(opts.Dir)
+
+	// Relative sources in a File that wasn't loaded from a file are
+	// relative to the working directory.
+	f, err := Parse(strings.NewReader(testCompileNoPathAppfile))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := testCompiler(t, opts).CompileAndValidate(f); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
+
+func TestCompile_importNoop(t *testing.T) {
+	var warnings []*CompileEventWarning
+	opts := testCompileOpts(t)
+	opts.Callback = func(raw CompileEvent) {
+		if e, ok := raw.(*CompileEventWarning); ok {
+			warnings = append(warnings, e)
+		}
+	}
+	defer os.RemoveAll(opts.Dir)
+
+	// The second import sets the project the same as the first, so it
+	// changes nothing.
+	f := testFile(t, "import-noop")
+	defer f.resetID()
+	if _, err := testCompiler(t, opts).Compile(f); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if len(warnings) != 1 {
+		t.Fatalf("bad: %#v", warnings)
+	}
+	if !strings.Contains(warnings[0].Message, "/import-noop/same'") {
+		t.Fatalf("bad: %s", warnings[0].Message)
+	}
+}
+
+func TestCompile_profile(t *testing.T) {
+	opts := testCompileOpts(t)
+	opts.Profile = "production"
+	defer os.RemoveAll(opts.Dir)
+
+	f := testFile(t, "compile-profile")
+	defer f.resetID()
+	c, err := testCompiler(t, opts).Compile(f)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// The profile is applied to the root and to the dependencies that
+	// define it.
+	types := make(map[string]string)
+	for _, raw := range c.Graph.Vertices() {
+		v := raw.(*CompiledGraphVertex)
+		types[v.Name()] = v.File.Application.Type
+	}
+	expected := map[string]string{"foo": "baz", "bar": "baz", "other": "bar"}
+	if !reflect.DeepEqual(types, expected) {
+		t.Fatalf("bad: %#v", types)
+	}
+}
+
+func TestCompile_profileUnknown(t *testing.T) {
+	opts := testCompileOpts(t)
+	opts.Profile = "staging"
+	defer os.RemoveAll(opts.Dir)
+
+	f := testFile(t, "compile-profile")
+	defer f.resetID()
+	_, err := testCompiler(t, opts).Compile(f)
+	if err == nil {
+		t.Fatal("should error")
+	}
+	if !strings.Contains(err.Error(), "available profiles: production") {
+		t.Fatalf("bad: %s", err)
+	}
+}
+
+func TestCompile_infraConflict(t *testing.T) {
+	var warnings []*CompileEventWarning
+	opts := testCompileOpts(t)
+	opts.Callback = func(raw CompileEvent) {
+		if e, ok := raw.(*CompileEventWarning); ok {
+			warnings = append(warnings, e)
+		}
+	}
+	defer os.RemoveAll(opts.Dir)
+
+	f := testFile(t, "compile-deps-infra-conflict")
+	defer f.resetID()
+	c, err := testCompiler(t, opts).Compile(f)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if len(warnings) != 1 {
+		t.Fatalf("bad: %#v", warnings)
+	}
+	msg := warnings[0].Message
+	if !strings.Contains(msg, "a (") || !strings.Contains(msg, "gcp (google/simple)") {
+		t.Fatalf("bad: %s", msg)
+	}
+	if strings.Contains(msg, "b (") {
+		t.Fatalf("bad: %s", msg)
+	}
+
+	// The root's infrastructure is still used
+	for _, raw := range c.Graph.Vertices() {
+		v := raw.(*CompiledGraphVertex)
+		if v.File.Project.Infrastructure != "aws" {
+			t.Fatalf("bad: %s: %s", v.Name(), v.File.Project.Infrastructure)
+		}
+	}
+}
+
+func TestCompile_strictValidation(t *testing.T) {
+	cases := []struct {
+		Dir    string
+		Strict bool
+		Err    bool
+	}{
+		{"compile-deps-dup-dep", false, false},
+		{"compile-deps-dup-dep", true, true},
+		{"compile-deps-infra-conflict", true, true},
+	}
+
+	for _, tc := range cases {
+		var warnings []*CompileEventWarning
+		opts := testCompileOpts(t)
+		opts.StrictValidation = tc.Strict
+		opts.Callback = func(raw CompileEvent) {
+			if e, ok := raw.(*CompileEventWarning); ok {
+				warnings = append(warnings, e)
+			}
+		}
+		defer os.RemoveAll(opts.Dir)
+
+		f := testFile(t, tc.Dir)
+		defer f.resetID()
+		_, err := testCompiler(t, opts).Compile(f)
+		if (err != nil) != tc.Err {
+			t.Fatalf("%s %v err: %s", tc.Dir, tc.Strict, err)
+		}
+
+		// Warnings are only sent if they don't fail the compilation
+		if tc.Err != (len(warnings) == 0) {
+			t.Fatalf("%s %v bad: %#v", tc.Dir, tc.Strict, warnings)
+		}
+	}
+}
+
+func TestCompileID(t *testing.T) {
+	opts := testCompileOpts(t)
+	defer os.RemoveAll(opts.Dir)
+	f := testFile(t, "compile-id")
+	defer f.resetID()
+
+	c, err := testCompiler(t, opts).Compile(f)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if f.ID == "" {
+		t.Fatalf("ID should not be blank")
+	}
+	if f.ID != c.File.ID {
+		t.Fatalf("%s != %s", f.ID, c.File.ID)
+	}
+}
+
+func TestCompileID_filename(t *testing.T) {
+	opts := testCompileOpts(t)
+	opts.IDFilename = filepath.Join(".otto", "id")
+	defer os.RemoveAll(opts.Dir)
+	f := testFile(t, "compile-id")
+	dir := filepath.Dir(f.Path)
+	defer os.RemoveAll(filepath.Join(dir, ".otto"))
+
+	c, err := testCompiler(t, opts).Compile(f)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if c.File.ID == "" {
+		t.Fatalf("ID should not be blank")
+	}
+	if _, err := os.Stat(filepath.Join(dir, opts.IDFilename)); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, IDFile)); !os.IsNotExist(err) {
+		t.Fatalf("default ID file shouldn't exist: %s", err)
+	}
+}
+
+func TestCompileID_filenameFallback(t *testing.T) {
+	opts := testCompileOpts(t)
+	opts.IDFilename = filepath.Join(".otto", "id")
+	defer os.RemoveAll(opts.Dir)
+	f := testFile(t, "compile-id-exists")
+	if f.ID == "" {
+		t.Fatalf("ID should not be blank")
+	}
+
+	copyId := f.ID
+	c, err := testCompiler(t, opts).Compile(f)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if copyId != c.File.ID {
+		t.Fatalf("%s != %s", copyId, c.File.ID)
+	}
+}
+
+func TestCompileID_existing(t *testing.T) {
+	opts := testCompileOpts(t)
+	defer os.RemoveAll(opts.Dir)
+	f := testFile(t, "compile-id-exists")
+	if f.ID == "" {
+		t.Fatalf("ID should not be blank")
+	}
+
+	copyId := f.ID
+	c, err := testCompiler(t, opts).Compile(f)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if copyId != c.File.ID {
+		t.Fatalf("%s != %s", f.ID, c.File.ID)
+	}
+}
+
+func TestLoadCompile_new(t *testing.T) {
+	path := filepath.Join("./test-fixtures", "load-new")
+	_, err := LoadCompiled(path)
+	if err == nil {
+		t.Fatal("should error")
+	}
+}
+
+func TestLoadCompiledLazy(t *testing.T) {
+	opts := testCompileOpts(t)
+	defer os.RemoveAll(opts.Dir)
+
+	f := testFile(t, "compile-deps")
+	defer f.resetID()
+	original, err := testCompiler(t, opts).Compile(f)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	c, err := LoadCompiledLazy(opts.Dir)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if c.String() != original.String() {
+		t.Fatalf("bad:\n\n%s\n\n%s", c, original)
+	}
+
+	for _, raw := range c.Graph.Vertices() {
+		v := raw.(*CompiledGraphVertex)
+		if v.File != nil {
+			t.Fatalf("%s should not be loaded", v.Name())
+		}
+
+		f, err := v.LoadFile()
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if f == nil || f.Application.Name != v.Name() {
+			t.Fatalf("bad %s: %#v", v.Name(), f)
+		}
+		if f.ID != original.vertex(v.Name()).File.ID {
+			t.Fatalf("bad %s: %s", v.Name(), f.ID)
+		}
+	}
+}
+
+func testCompileCompare(t *testing.T, c *Compiled, expected string) {
+	actual := strings.TrimSpace(c.String())
+	expected = strings.TrimSpace(fmt.Sprintf(expected, c.File.Path))
+	if actual != expected {
+		t.Fatalf("bad:\n\n%s\n\n%s", actual, expected)
+	}
+}
+
+func testCompileMarshal(t *testing.T, original *Compiled, dir string) {
+	c, err := LoadCompiled(dir)
+	if err != nil {
+		t.Fatalf("err loading compiled: %s", err)
+	}
+
+	if c.String() != original.String() {
+		t.Fatalf("bad:\n\n%s\n\n%s", c, original)
+	}
+}
+
+func testCompileOpts(t *testing.T) *CompileOpts {
+	dir, err := ioutil.TempDir("", "otto-")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	return &CompileOpts{
+		Dir:    dir,
+		Loader: nil,
+	}
+}
+
+func testCompiler(t *testing.T, opts *CompileOpts) *Compiler {
+	c, err := NewCompiler(opts)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	return c
+}
+
+func testFile(t *testing.T, dir string) *File {
+	path := filepath.Join("./test-fixtures", dir, "Appfile")
+	f, err := ParseFile(path)
+	if err != nil {
+		t.Fatalf("err: %s\n\n%s", path, err)
+	}
+
+	return f
+}
+
+// testImportTree creates an Appfile in dir that imports width Appfiles,
+// each of which import width Appfiles, and so on depth times.
+func testImportTree(t *testing.T, dir string, width, depth int) {
+	var buf bytes.Buffer
+	for i := 0; depth > 0 && i < width; i++ {
+		child := filepath.Join(dir, fmt.Sprintf("%d", i))
+		if err := os.MkdirAll(child, 0755); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		testImportTree(t, child, width, depth-1)
+
+		fmt.Fprintf(&buf, "import \"./%d\" {}\n", i)
+	}
+
+	path := filepath.Join(dir, "Appfile")
+	if err := ioutil.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
+
+// testConcurrentStorage is a getter.Storage that tracks the peak number
+// of concurrent calls to Get.
+type testConcurrentStorage struct {
+	getter.Storage
+
+	lock    sync.Mutex
+	active  int
+	peak    int
+	getLock sync.Mutex
+}
+
+func (s *testConcurrentStorage) Get(key string, source string, update bool) error {
+	s.lock.Lock()
+	s.active++
+	if s.active > s.peak {
+		s.peak = s.active
+	}
+	s.lock.Unlock()
+
+	defer func() {
+		s.lock.Lock()
+		defer s.lock.Unlock()
+		s.active--
+	}()
+
+	// Give other downloads the chance to overlap with this one. Only the
+	// overlap is being tested, so the actual downloads are done one at a
+	// time.
+	time.Sleep(5 * time.Millisecond)
+	s.getLock.Lock()
+	defer s.getLock.Unlock()
+	return s.Storage.Get(key, source, update)
+}
+
+const testCompileBasicStr = `
+Compiled Appfile: %s
+
+Dep Graph:
+foo
+`
+
+const testCompileDepsStr = `
+Compiled Appfile: %s
+
+Dep Graph:
+bar
 foo
   bar
 `
 
+const testCompileLocalSiblingStr = `
+api
+  db
+db
+foo
+  api
+`
+
+const testCompileNoPathAppfile = `
+application {
+    name = "foo"
+    type = "bar"
+
+    dependency {
+        source = "./test-fixtures/compile-deps/child"
+    }
+}
+
+project {
+    name = "foo"
+    infrastructure = "aws"
+}
+
+infrastructure "aws" {}
+`
+
 const testCompileDepGitStr = `
 Compiled Appfile: %s
 
@@ -0,0 +1,71 @@
+package appfile
+
+import (
+	"context"
+)
+
+// The names of the spans that are started with CompileOpts.Tracer.
+const (
+	// SpanCompile covers a whole compilation. The other spans are its
+	// descendants.
+	SpanCompile = "otto.compile"
+
+	// SpanImports covers loading the imports of the root Appfile, and
+	// SpanDeps covers loading all the dependencies, including their
+	// imports.
+	SpanImports = "otto.compile.imports"
+	SpanDeps    = "otto.compile.deps"
+
+	// SpanImport and SpanDep cover downloading and parsing a single
+	// import or dependency. They're tagged with the resolved source
+	// with the SpanTagSource key.
+	SpanImport = "otto.compile.import"
+	SpanDep    = "otto.compile.dep"
+
+	SpanValidate = "otto.compile.validate"
+	SpanWrite    = "otto.compile.write"
+
+	// SpanTagSource is the tag key for the source of an import or
+	// dependency.
+	SpanTagSource = "otto.source"
+)
+
+// CompileTracer starts spans for the phases of compilation, so that an
+// embedder can trace compilations with a tracing library such as
+// OpenTracing or OpenTelemetry. The context given to
+// Compiler.CompileContext is the parent of all the spans.
+//
+// Spans are started concurrently when imports and dependencies are
+// loaded in parallel, so this must be safe for concurrent use.
+type CompileTracer interface {
+	// StartSpan starts a span with the given name as a child of the span
+	// in ctx, if any. It returns a context containing the new span, which
+	// is used as the parent of any spans started within it.
+	StartSpan(ctx context.Context, name string) (context.Context, CompileSpan)
+}
+
+// CompileSpan is a span started by a CompileTracer.
+type CompileSpan interface {
+	// SetTag sets a tag on the span.
+	SetTag(key, value string)
+
+	// Finish ends the span. err is the error that the traced operation
+	// failed with, or nil.
+	Finish(err error)
+}
+
+// startSpan starts a span with the configured tracer. If there is no
+// tracer, the span does nothing.
+func (c *Compiler) startSpan(ctx context.Context, name string) (context.Context, CompileSpan) {
+	if c.opts.Tracer == nil {
+		return ctx, nopSpan{}
+	}
+
+	return c.opts.Tracer.StartSpan(ctx, name)
+}
+
+// nopSpan is the CompileSpan used when there is no tracer.
+type nopSpan struct{}
+
+func (nopSpan) SetTag(string, string) {}
+func (nopSpan) Finish(error)          {}
@@ -0,0 +1,104 @@
+package appfile
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestCompileContext_tracer(t *testing.T) {
+	tracer := new(testCompileTracer)
+	opts := testCompileOpts(t)
+	opts.Tracer = tracer
+	defer os.RemoveAll(opts.Dir)
+
+	f := testFile(t, "import-dep")
+	defer f.resetID()
+	if _, err := testCompiler(t, opts).CompileContext(context.Background(), f); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Each span is recorded as "parent > name"
+	var actual []string
+	for _, s := range tracer.Spans {
+		if !s.Finished {
+			t.Fatalf("not finished: %s", s.Name)
+		}
+
+		actual = append(actual, s.Parent+" > "+s.Name)
+		if s.Name == SpanDep || s.Name == SpanImport {
+			if !strings.HasPrefix(s.Tags[SpanTagSource], "file://") {
+				t.Fatalf("bad source for %s: %#v", s.Name, s.Tags)
+			}
+		}
+	}
+	sort.Strings(actual)
+
+	expected := []string{
+		" > " + SpanCompile,
+		SpanCompile + " > " + SpanDeps,
+		SpanCompile + " > " + SpanImports,
+		SpanCompile + " > " + SpanValidate,
+		SpanCompile + " > " + SpanWrite,
+		SpanDep + " > " + SpanImport,
+		SpanDeps + " > " + SpanDep,
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("bad: %#v", actual)
+	}
+}
+
+func TestCompileContext_canceled(t *testing.T) {
+	opts := testCompileOpts(t)
+	defer os.RemoveAll(opts.Dir)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	f := testFile(t, "compile-deps")
+	defer f.resetID()
+	_, err := testCompiler(t, opts).CompileContext(ctx, f)
+	if err == nil || !strings.Contains(err.Error(), context.Canceled.Error()) {
+		t.Fatalf("bad: %s", err)
+	}
+}
+
+// testCompileTracer is a CompileTracer that records every span.
+type testCompileTracer struct {
+	sync.Mutex
+	Spans []*testCompileSpan
+}
+
+type testCompileSpan struct {
+	Name     string
+	Parent   string
+	Tags     map[string]string
+	Finished bool
+}
+
+type testCompileSpanKey struct{}
+
+func (t *testCompileTracer) StartSpan(
+	ctx context.Context, name string) (context.Context, CompileSpan) {
+	span := &testCompileSpan{Name: name, Tags: make(map[string]string)}
+	if parent, ok := ctx.Value(testCompileSpanKey{}).(*testCompileSpan); ok {
+		span.Parent = parent.Name
+	}
+
+	t.Lock()
+	defer t.Unlock()
+	t.Spans = append(t.Spans, span)
+	return context.WithValue(ctx, testCompileSpanKey{}, span), span
+}
+
+func (s *testCompileSpan) SetTag(key, value string) {
+	s.Tags[key] = value
+}
+
+func (s *testCompileSpan) Finish(err error) {
+	s.Finished = true
+}
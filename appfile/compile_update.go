@@ -0,0 +1,201 @@
+package appfile
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// UpdateOpts are the options for Compiler.UpdateWithOpts.
+type UpdateOpts struct {
+	// DryRun, if true, only reports the latest refs of the dependencies
+	// without downloading them. The stored dependencies and the compiled
+	// Appfile are left as they are.
+	DryRun bool
+}
+
+// UpdateReport is the result of updating the dependencies of an Appfile.
+type UpdateReport struct {
+	// Dependencies are the dependencies that track a Git branch, sorted
+	// by name. Dependencies that aren't from Git or are pinned to a tag
+	// or commit can't be updated, so they aren't included.
+	Dependencies []*UpdatedDependency
+}
+
+// Changed returns the dependencies whose ref changed.
+func (r *UpdateReport) Changed() []*UpdatedDependency {
+	result := make([]*UpdatedDependency, 0, len(r.Dependencies))
+	for _, d := range r.Dependencies {
+		if d.Changed() {
+			result = append(result, d)
+		}
+	}
+
+	return result
+}
+
+// UpdatedDependency is a single dependency in an UpdateReport.
+type UpdatedDependency struct {
+	// Name is the name of the application and Source is its source.
+	Name   string
+	Source string
+
+	// Branch is the Git branch that the dependency tracks.
+	Branch string
+
+	// Old is the commit that was stored before the update and New is the
+	// latest commit of the branch.
+	Old string
+	New string
+}
+
+// Changed returns true if the latest commit of the branch is different
+// from the stored commit.
+func (d *UpdatedDependency) Changed() bool {
+	return d.Old != d.New
+}
+
+// Update updates the dependencies of an Appfile that track a Git branch
+// to the latest commit of the branch and reports the old and new commits.
+// This is like compiling with CompileOpts.Update, but only downloads the
+// dependencies again if any of them changed.
+//
+// The stored dependencies and the compiled Appfile are rewritten with the
+// updated dependencies. The Appfile itself is never modified.
+//
+// The stored commits are found by compiling first. If CompileOpts.Update
+// is set, that already downloads the latest commits, so nothing will be
+// reported as changed.
+func (c *Compiler) Update(f *File) (*UpdateReport, error) {
+	return c.UpdateWithOpts(f, nil)
+}
+
+// UpdateWithOpts is like Update, with options.
+func (c *Compiler) UpdateWithOpts(f *File, opts *UpdateOpts) (*UpdateReport, error) {
+	if opts == nil {
+		opts = new(UpdateOpts)
+	}
+
+	// Compile with the stored dependencies first to find the commits
+	// that they're at. Anything that isn't stored yet is downloaded.
+	compiled, err := c.Compile(f)
+	if err != nil {
+		return nil, err
+	}
+
+	report := new(UpdateReport)
+	for _, raw := range compiled.Graph.Vertices() {
+		v := raw.(*CompiledGraphVertex)
+		if v.File == nil || !isGitSource(v.File.Source) {
+			continue
+		}
+
+		d, err := gitUpdate(v)
+		if err != nil {
+			return nil, fmt.Errorf(
+				"Error checking for updates to %s: %s", v.Name(), err)
+		}
+		if d != nil {
+			report.Dependencies = append(report.Dependencies, d)
+		}
+	}
+	sort.Sort(updatedByName(report.Dependencies))
+
+	if opts.DryRun || len(report.Changed()) == 0 {
+		return report, nil
+	}
+
+	if _, err := c.compile(withUpdate(context.Background()), f, true); err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+// isGitSource returns true if the detected source is downloaded with Git.
+func isGitSource(source string) bool {
+	return strings.HasPrefix(source, "git::") || strings.HasPrefix(source, "git://")
+}
+
+// gitUpdate returns the stored and latest commit of the branch that the
+// stored copy of a dependency has checked out. If it isn't on a branch,
+// it can't be updated and nil is returned.
+func gitUpdate(v *CompiledGraphVertex) (*UpdatedDependency, error) {
+	dir := filepath.Dir(v.File.Path)
+	branch, err := gitOutput(dir, "rev-parse", "--abbrev-ref", "HEAD")
+	if err != nil {
+		return nil, err
+	}
+	if branch == "HEAD" {
+		// Detached, so it's pinned to a tag or commit
+		return nil, nil
+	}
+
+	old, err := gitOutput(dir, "rev-parse", "HEAD")
+	if err != nil {
+		return nil, err
+	}
+
+	remote, err := gitOutput(dir, "config", "--get", "remote.origin.url")
+	if err != nil {
+		return nil, err
+	}
+	out, err := gitOutput(dir, "ls-remote", remote, "refs/heads/"+branch)
+	if err != nil {
+		return nil, err
+	}
+	fields := strings.Fields(out)
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("branch %s not found in %s", branch, remote)
+	}
+
+	return &UpdatedDependency{
+		Name:   v.Name(),
+		Source: v.File.Source,
+		Branch: branch,
+		Old:    old,
+		New:    fields[0],
+	}, nil
+}
+
+// gitOutput runs git in dir and returns its trimmed output.
+func gitOutput(dir string, args ...string) (string, error) {
+	var stderr bytes.Buffer
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("git %s: %s\n\n%s",
+			strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+
+	return strings.TrimSpace(string(out)), nil
+}
+
+type updateKey struct{}
+
+// withUpdate returns a context in which compilation downloads every
+// dependency and import again, as if CompileOpts.Update were set.
+func withUpdate(ctx context.Context) context.Context {
+	return context.WithValue(ctx, updateKey{}, true)
+}
+
+// update returns true if the compilation in ctx should download every
+// dependency and import again.
+func (c *Compiler) update(ctx context.Context) bool {
+	force, _ := ctx.Value(updateKey{}).(bool)
+	return c.opts.Update || force
+}
+
+// updatedByName implements sort.Interface to sort updated dependencies
+// by name.
+type updatedByName []*UpdatedDependency
+
+func (u updatedByName) Len() int           { return len(u) }
+func (u updatedByName) Swap(i, j int)      { u[i], u[j] = u[j], u[i] }
+func (u updatedByName) Less(i, j int) bool { return u[i].Name < u[j].Name }
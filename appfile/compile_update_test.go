@@ -0,0 +1,89 @@
+package appfile
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCompilerUpdate(t *testing.T) {
+	if !testHasGit {
+		t.Skip("git not found")
+	}
+
+	dir, err := ioutil.TempDir("", "otto-")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	f := testGitDeps(t, dir, 1, false)
+
+	opts := testCompileOpts(t)
+	defer os.RemoveAll(opts.Dir)
+	c := testCompiler(t, opts)
+
+	// Nothing has changed yet
+	report, err := c.Update(f)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(report.Dependencies) != 1 || len(report.Changed()) != 0 {
+		t.Fatalf("bad: %#v", report.Dependencies)
+	}
+	d := report.Dependencies[0]
+	if d.Name != "dep0" || d.Branch == "" || d.Old == "" {
+		t.Fatalf("bad: %#v", d)
+	}
+	stored := d.Old
+
+	// Commit a change to the dependency
+	repo := filepath.Join(dir, "dep0")
+	if err := ioutil.WriteFile(filepath.Join(repo, "README"), nil, 0644); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	testGitCommit(t, repo)
+	latest, err := gitOutput(repo, "rev-parse", "HEAD")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// A dry run reports the change but doesn't download it
+	for _, dryRun := range []bool{true, false} {
+		report, err = c.UpdateWithOpts(f, &UpdateOpts{DryRun: dryRun})
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		changed := report.Changed()
+		if len(changed) != 1 || changed[0].Old != stored || changed[0].New != latest {
+			t.Fatalf("%v bad: %#v", dryRun, changed)
+		}
+	}
+
+	// The change was downloaded
+	report, err = c.Update(f)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(report.Changed()) != 0 || report.Dependencies[0].Old != latest {
+		t.Fatalf("bad: %#v", report.Dependencies[0])
+	}
+}
+
+func TestIsGitSource(t *testing.T) {
+	cases := []struct {
+		Source string
+		Git    bool
+	}{
+		{"git::https://github.com/foo/bar.git", true},
+		{"git://example.com/foo.git", true},
+		{"file:///foo/bar", false},
+		{"hg::http://example.com/foo.hg", false},
+	}
+
+	for _, tc := range cases {
+		if actual := isGitSource(tc.Source); actual != tc.Git {
+			t.Fatalf("bad: %s: %v", tc.Source, actual)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package appfile
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// webhookQueueSize is the number of events that can be waiting to be
+	// posted to the webhook. If the queue is full, events are dropped
+	// rather than blocking compilation.
+	webhookQueueSize = 128
+
+	// webhookTimeout is how long posting a single event may take.
+	webhookTimeout = 10 * time.Second
+)
+
+// webhook posts compilation events to CompileOpts.WebhookURL. Events are
+// posted one at a time in the order they were sent by a single goroutine,
+// which is started with the first event and stopped by flushWebhook.
+type webhook struct {
+	ch   chan []byte
+	done chan struct{}
+	lock sync.Mutex
+}
+
+// sendWebhook queues the event to be posted to the URL. It never blocks:
+// if the queue is full, the event is dropped and logged.
+func (c *Compiler) sendWebhook(url string, e CompileEvent) {
+	ev, err := encodeEventJSON(e)
+	if err != nil {
+		c.logf("[ERR] error encoding compile event for webhook: %s", err)
+		return
+	}
+	data, err := json.Marshal(ev)
+	if err != nil {
+		c.logf("[ERR] error encoding compile event for webhook: %s", err)
+		return
+	}
+
+	w := &c.webhook
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.ch == nil {
+		w.ch = make(chan []byte, webhookQueueSize)
+		w.done = make(chan struct{})
+		go c.runWebhook(url, w.ch, w.done)
+	}
+
+	select {
+	case w.ch <- data:
+	default:
+		c.logf("[WARN] compile webhook queue full, dropping %s event", ev.Type)
+	}
+}
+
+// runWebhook posts the events from the channel to the URL until the
+// channel is closed. Failures are logged, since they must not fail the
+// compilation.
+func (c *Compiler) runWebhook(url string, ch <-chan []byte, done chan<- struct{}) {
+	defer close(done)
+
+	client := &http.Client{Timeout: webhookTimeout}
+	for data := range ch {
+		if err := postWebhook(client, url, data); err != nil {
+			c.logf("[WARN] error posting compile event to webhook: %s", err)
+		}
+	}
+}
+
+// flushWebhook waits for the queued events to be posted and stops the
+// goroutine posting them. A later event starts a new one.
+func (c *Compiler) flushWebhook() {
+	w := &c.webhook
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.ch == nil {
+		return
+	}
+
+	close(w.ch)
+	<-w.done
+	w.ch = nil
+	w.done = nil
+}
+
+// postWebhook posts a single encoded event. Any status other than 2xx is
+// an error.
+func postWebhook(client *http.Client, url string, data []byte) error {
+	resp, err := client.Post(url, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("%s returned %s", url, resp.Status)
+	}
+
+	return nil
+}
@@ -0,0 +1,109 @@
+package appfile
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestCompile_webhook(t *testing.T) {
+	cases := []struct {
+		Dir   string
+		Err   bool
+		Types []string
+	}{
+		{
+			"compile-multi-dep",
+			false,
+			[]string{"start", "plan", "dep", "dep", "finish"},
+		},
+
+		{
+			"compile-invalid",
+			true,
+			[]string{"start", "plan", "error"},
+		},
+	}
+
+	for _, tc := range cases {
+		var lock sync.Mutex
+		var types []string
+		ts := httptest.NewServer(http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				var e CompileEventJSON
+				if err := json.NewDecoder(r.Body).Decode(&e); err != nil {
+					t.Errorf("%s: err: %s", tc.Dir, err)
+				}
+				if ct := r.Header.Get("Content-Type"); ct != "application/json" {
+					t.Errorf("%s: bad content type: %s", tc.Dir, ct)
+				}
+
+				lock.Lock()
+				defer lock.Unlock()
+				types = append(types, e.Type)
+			}))
+		defer ts.Close()
+
+		opts := testCompileOpts(t)
+		opts.WebhookURL = ts.URL
+		defer os.RemoveAll(opts.Dir)
+
+		f := testFile(t, tc.Dir)
+		defer f.resetID()
+		c := testCompiler(t, opts)
+		_, err := c.Compile(f)
+		if (err != nil) != tc.Err {
+			t.Fatalf("%s: err: %s", tc.Dir, err)
+		}
+
+		// Close waits for the events to be posted
+		if err := c.Close(); err != nil {
+			t.Fatalf("%s: err: %s", tc.Dir, err)
+		}
+
+		lock.Lock()
+		actual := types
+		lock.Unlock()
+		if !reflect.DeepEqual(actual, tc.Types) {
+			t.Fatalf("%s: bad: %#v", tc.Dir, actual)
+		}
+	}
+}
+
+func TestCompile_webhookFailure(t *testing.T) {
+	var lock sync.Mutex
+	var count int
+	ts := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			lock.Lock()
+			defer lock.Unlock()
+			count++
+			w.WriteHeader(http.StatusInternalServerError)
+		}))
+	defer ts.Close()
+
+	opts := testCompileOpts(t)
+	opts.WebhookURL = ts.URL
+	defer os.RemoveAll(opts.Dir)
+
+	// Failing to deliver events doesn't fail the compilation
+	f := testFile(t, "compile-basic")
+	defer f.resetID()
+	c := testCompiler(t, opts)
+	if _, err := c.Compile(f); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := c.Close(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+	if count == 0 {
+		t.Fatal("webhook should be called")
+	}
+}
@@ -0,0 +1,312 @@
+package appfile
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hashicorp/go-getter"
+	"github.com/hashicorp/otto/helper/oneline"
+)
+
+// ContentStorage is an implementation of getter.Storage that stores
+// fetched directories by a hash of their contents rather than by their
+// source. The mapping of source to content hash is stored separately, so
+// identical content fetched from multiple sources is only stored once.
+//
+// Local sources are copied into the storage rather than linked, so the
+// stored contents don't change with the source until it is fetched again.
+//
+// Version control metadata directories such as ".git" are stored with the
+// contents, since they are used to update dependencies. Only the files
+// that identify the repository, such as its origin and checked out ref,
+// are hashed, so separate clones of the same ref are still shared but
+// identical content from different repositories isn't.
+type ContentStorage struct {
+	// StorageDir is the directory where the contents will be stored.
+	StorageDir string
+}
+
+// Dir implements getter.Storage.Dir
+func (s *ContentStorage) Dir(key string) (string, bool, error) {
+	hash, err := oneline.Read(s.keyPath(key))
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+		}
+
+		return "", false, err
+	}
+
+	dir := s.contentDir(hash)
+	if _, err := os.Stat(dir); err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+		}
+
+		return "", false, err
+	}
+
+	return dir, true, nil
+}
+
+// Get implements getter.Storage.Get
+func (s *ContentStorage) Get(key string, source string, update bool) error {
+	return s.get(key, source, update)
+}
+
+func (s *ContentStorage) get(
+	key string, source string, update bool, opts ...getter.ClientOption) error {
+	if !update {
+		if _, ok, err := s.Dir(key); err != nil || ok {
+			return err
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Join(s.StorageDir, "keys"), 0755); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Join(s.StorageDir, "content"), 0755); err != nil {
+		return err
+	}
+
+	// Fetch into a temporary directory since we don't know the hash of
+	// the contents until it is downloaded. We only need a unique name so
+	// we remove the directory, since some getters require that the
+	// destination doesn't exist.
+	tmpDir, err := ioutil.TempDir(s.StorageDir, "tmp-")
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(tmpDir); err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	if err := getter.Get(tmpDir, source, opts...); err != nil {
+		return err
+	}
+
+	// Some getters (such as local files) symlink the directory, which
+	// would store the link rather than the contents.
+	if fi, err := os.Lstat(tmpDir); err == nil && fi.Mode()&os.ModeSymlink != 0 {
+		if err := unlinkDir(tmpDir); err != nil {
+			return fmt.Errorf("Error copying contents of %s: %s", source, err)
+		}
+	}
+
+	hash, err := contentHash(tmpDir)
+	if err != nil {
+		return fmt.Errorf("Error hashing contents of %s: %s", source, err)
+	}
+
+	// Move the contents into place unless we already have them
+	dir := s.contentDir(hash)
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		if err := os.Rename(tmpDir, dir); err != nil {
+			// Another fetch may have stored the same contents at the
+			// same time, in which case we're done.
+			if _, statErr := os.Stat(dir); statErr != nil {
+				return err
+			}
+		}
+	}
+
+	// Record the mapping from the key to the contents
+	return ioutil.WriteFile(s.keyPath(key), []byte(hash+"\n"), 0644)
+}
+
+// verify checks that the contents of the stored directory still match
+// the hash they're stored by.
+func (s *ContentStorage) verify(dir string) (bool, error) {
+	hash, err := contentHash(dir)
+	if err != nil {
+		return false, err
+	}
+
+	return hash == filepath.Base(dir), nil
+}
+
+func (s *ContentStorage) keyPath(key string) string {
+	sum := md5.Sum([]byte(key))
+	return filepath.Join(s.StorageDir, "keys", hex.EncodeToString(sum[:]))
+}
+
+func (s *ContentStorage) contentDir(hash string) string {
+	return filepath.Join(s.StorageDir, "content", hash)
+}
+
+// vcsIdentityFiles are the files within each version control metadata
+// directory that identify the repository and what is checked out. The
+// rest of the metadata differs between clones of the same ref, so it
+// isn't hashed.
+var vcsIdentityFiles = map[string][]string{
+	".git": {"HEAD", "config", "packed-refs"},
+	".hg":  {"hgrc", "branch"},
+	".svn": {"wc.db"},
+}
+
+// contentHash returns a hash of the contents of the directory, made up
+// of the relative paths and contents of all the files within it.
+func contentHash(dir string) (string, error) {
+	h := sha256.New()
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case info.IsDir():
+			if _, ok := vcsIdentityFiles[info.Name()]; ok {
+				return filepath.SkipDir
+			}
+
+			if err := hashVCS(h, rel, path); err != nil {
+				return err
+			}
+
+			return nil
+		case info.Mode()&os.ModeSymlink != 0:
+			target, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+
+			fmt.Fprintf(h, "link %s\x00%s\x00", filepath.ToSlash(rel), target)
+			return nil
+		case !info.Mode().IsRegular():
+			return nil
+		}
+
+		return hashFile(h, rel, path)
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// hashVCS hashes the identity files of the version control metadata
+// directories directly within the directory at path, and for Git, the
+// ref that HEAD points to.
+func hashVCS(h io.Writer, rel, path string) error {
+	for _, name := range []string{".git", ".hg", ".svn"} {
+		files := vcsIdentityFiles[name]
+		vcsDir := filepath.Join(path, name)
+		if _, err := os.Stat(vcsDir); err != nil {
+			continue
+		}
+
+		if name == ".git" {
+			head, err := ioutil.ReadFile(filepath.Join(vcsDir, "HEAD"))
+			if err == nil && strings.HasPrefix(string(head), "ref: ") {
+				ref := strings.TrimSpace(strings.TrimPrefix(string(head), "ref: "))
+				files = append(files[:len(files):len(files)], filepath.FromSlash(ref))
+			}
+		}
+
+		for _, file := range files {
+			filePath := filepath.Join(vcsDir, file)
+			fi, err := os.Stat(filePath)
+			if err != nil || !fi.Mode().IsRegular() {
+				continue
+			}
+
+			if err := hashFile(h, filepath.Join(rel, name, file), filePath); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// hashFile hashes the relative path, size and contents of the file.
+func hashFile(h io.Writer, rel, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(h, "file %s\x00%d\x00", filepath.ToSlash(rel), fi.Size())
+	_, err = io.Copy(h, f)
+	return err
+}
+
+// unlinkDir replaces the symlink at dir with a copy of the directory it
+// points to.
+func unlinkDir(dir string) error {
+	src, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(dir); err != nil {
+		return err
+	}
+
+	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		dst := filepath.Join(dir, rel)
+
+		switch {
+		case info.IsDir():
+			return os.Mkdir(dst, info.Mode().Perm())
+		case info.Mode()&os.ModeSymlink != 0:
+			target, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+
+			return os.Symlink(target, dst)
+		case !info.Mode().IsRegular():
+			return nil
+		}
+
+		return copyFile(dst, path, info.Mode().Perm())
+	})
+}
+
+// copyFile copies the regular file at src to dst with the given mode.
+func copyFile(dst, src string, mode os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+
+	return out.Close()
+}
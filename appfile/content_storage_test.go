@@ -0,0 +1,243 @@
+package appfile
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/go-getter"
+)
+
+func TestContentStorage_impl(t *testing.T) {
+	var _ getter.Storage = new(ContentStorage)
+}
+
+func TestContentStorage(t *testing.T) {
+	td, err := ioutil.TempDir("", "otto")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+
+	// Create sources where two have identical contents
+	sources := map[string]string{
+		"a": "foo",
+		"b": "foo",
+		"c": "bar",
+	}
+	for name, contents := range sources {
+		dir := filepath.Join(td, "src", name)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		path := filepath.Join(dir, "Appfile")
+		if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+
+	s := &ContentStorage{StorageDir: filepath.Join(td, "storage")}
+	if _, ok, err := s.Dir("a"); err != nil || ok {
+		t.Fatalf("bad: %v %s", ok, err)
+	}
+
+	dirs := make(map[string]string)
+	for name := range sources {
+		source := filepath.Join(td, "src", name)
+		if err := s.Get(name, source, false); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		dir, ok, err := s.Dir(name)
+		if err != nil || !ok {
+			t.Fatalf("bad: %v %s", ok, err)
+		}
+
+		data, err := ioutil.ReadFile(filepath.Join(dir, "Appfile"))
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if string(data) != sources[name] {
+			t.Fatalf("bad %s: %s", name, data)
+		}
+
+		dirs[name] = dir
+	}
+
+	if dirs["a"] != dirs["b"] {
+		t.Fatalf("should share contents: %#v", dirs)
+	}
+	if dirs["a"] == dirs["c"] {
+		t.Fatalf("should not share contents: %#v", dirs)
+	}
+}
+
+func TestContentStorage_verify(t *testing.T) {
+	td, err := ioutil.TempDir("", "otto")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+
+	source := filepath.Join(td, "src")
+	path := filepath.Join(source, "Appfile")
+	if err := os.MkdirAll(source, 0755); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := ioutil.WriteFile(path, []byte("foo"), 0644); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	s := &ContentStorage{StorageDir: filepath.Join(td, "storage")}
+	if err := s.Get("a", source, false); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	dir, _, err := s.Dir("a")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if ok, err := s.verify(dir); err != nil || !ok {
+		t.Fatalf("bad: %v %s", ok, err)
+	}
+
+	// Local sources are copied, so changing the source doesn't change it
+	if err := ioutil.WriteFile(path, []byte("bar"), 0644); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if ok, err := s.verify(dir); err != nil || !ok {
+		t.Fatalf("bad: %v %s", ok, err)
+	}
+
+	// Changing the stored copy invalidates it
+	stored := filepath.Join(dir, "Appfile")
+	if err := ioutil.WriteFile(stored, []byte("bar"), 0644); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if ok, err := s.verify(dir); err != nil || ok {
+		t.Fatalf("bad: %v %s", ok, err)
+	}
+}
+
+func TestContentStorage_localCopy(t *testing.T) {
+	td, err := ioutil.TempDir("", "otto")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+
+	source := filepath.Join(td, "src")
+	if err := os.MkdirAll(source, 0755); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	path := filepath.Join(source, "Appfile")
+	if err := ioutil.WriteFile(path, []byte("foo"), 0644); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	s := &ContentStorage{StorageDir: filepath.Join(td, "storage")}
+	if err := s.Get("a", source, false); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	dir, _, err := s.Dir("a")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	fi, err := os.Lstat(dir)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !fi.IsDir() {
+		t.Fatalf("should be a directory: %s", fi.Mode())
+	}
+
+	// Removing the source must not affect the stored copy
+	if err := os.RemoveAll(source); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(dir, "Appfile"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if string(data) != "foo" {
+		t.Fatalf("bad: %s", data)
+	}
+}
+
+func TestContentStorage_vcs(t *testing.T) {
+	td, err := ioutil.TempDir("", "otto")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+
+	// Create sources with identical contents, where "a" and "b" are
+	// clones of the same repository and "c" is from another one.
+	sources := map[string]string{
+		"a": "https://example.com/foo.git",
+		"b": "https://example.com/foo.git",
+		"c": "https://example.com/bar.git",
+	}
+	for name, origin := range sources {
+		dir := filepath.Join(td, "src", name)
+		files := map[string]string{
+			"Appfile":                 "foo",
+			".git/HEAD":               "ref: refs/heads/master\n",
+			".git/config":             "[remote \"origin\"]\n\turl = " + origin + "\n",
+			".git/refs/heads/master":  "abc123\n",
+			".git/index":              name,
+			".git/objects/pack/index": name,
+		}
+		for file, contents := range files {
+			path := filepath.Join(dir, filepath.FromSlash(file))
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				t.Fatalf("err: %s", err)
+			}
+			if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+				t.Fatalf("err: %s", err)
+			}
+		}
+	}
+
+	s := &ContentStorage{StorageDir: filepath.Join(td, "storage")}
+	dirs := make(map[string]string)
+	for name := range sources {
+		if err := s.Get(name, filepath.Join(td, "src", name), false); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		dir, ok, err := s.Dir(name)
+		if err != nil || !ok {
+			t.Fatalf("bad: %v %s", ok, err)
+		}
+		dirs[name] = dir
+	}
+
+	if dirs["a"] != dirs["b"] {
+		t.Fatalf("should share contents: %#v", dirs)
+	}
+	if dirs["a"] == dirs["c"] {
+		t.Fatalf("should not share contents: %#v", dirs)
+	}
+
+	// The metadata is stored with the contents
+	if _, err := os.Stat(filepath.Join(dirs["c"], ".git", "config")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
+
+func TestCompile_contentAddressable(t *testing.T) {
+	opts := testCompileOpts(t)
+	opts.ContentAddressable = true
+	defer os.RemoveAll(opts.Dir)
+
+	f := testFile(t, "compile-multi-dep")
+	defer f.resetID()
+	c, err := testCompiler(t, opts).Compile(f)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	testCompileCompare(t, c, testCompileMultiDepStr)
+}
@@ -0,0 +1,160 @@
+package appfile
+
+import (
+	"sort"
+
+	"github.com/hashicorp/terraform/dag"
+)
+
+// GraphDiff is the difference between the dependency graphs of two
+// compiled Appfiles. Vertices are matched by their Otto ID. All the
+// lists are sorted by ID.
+type GraphDiff struct {
+	Added   []*DiffVertex
+	Removed []*DiffVertex
+	Changed []*DiffVertexChange
+
+	AddedEdges   []*DiffEdge
+	RemovedEdges []*DiffEdge
+}
+
+// DiffVertex is a single application in a GraphDiff.
+type DiffVertex struct {
+	ID     string
+	Name   string
+	Source string
+}
+
+// DiffVertexChange is an application that exists in both graphs, but
+// whose name or resolved source changed.
+type DiffVertexChange struct {
+	Old *DiffVertex
+	New *DiffVertex
+}
+
+// DiffEdge is a dependency in a GraphDiff. Source depends on Target, and
+// both are Otto IDs.
+type DiffEdge struct {
+	Source string
+	Target string
+}
+
+// Empty returns true if there are no differences.
+func (d *GraphDiff) Empty() bool {
+	return len(d.Added) == 0 &&
+		len(d.Removed) == 0 &&
+		len(d.Changed) == 0 &&
+		len(d.AddedEdges) == 0 &&
+		len(d.RemovedEdges) == 0
+}
+
+// Diff returns the differences in the dependency graph from old to new.
+func Diff(old, new *Compiled) *GraphDiff {
+	oldVs := diffVertices(old)
+	newVs := diffVertices(new)
+	oldEs := diffEdges(old)
+	newEs := diffEdges(new)
+
+	var result GraphDiff
+	for id, v := range newVs {
+		o, ok := oldVs[id]
+		if !ok {
+			result.Added = append(result.Added, v)
+			continue
+		}
+
+		if *o != *v {
+			result.Changed = append(result.Changed, &DiffVertexChange{
+				Old: o,
+				New: v,
+			})
+		}
+	}
+	for id, v := range oldVs {
+		if _, ok := newVs[id]; !ok {
+			result.Removed = append(result.Removed, v)
+		}
+	}
+
+	for e := range newEs {
+		if _, ok := oldEs[e]; !ok {
+			e := e
+			result.AddedEdges = append(result.AddedEdges, &e)
+		}
+	}
+	for e := range oldEs {
+		if _, ok := newEs[e]; !ok {
+			e := e
+			result.RemovedEdges = append(result.RemovedEdges, &e)
+		}
+	}
+
+	sort.Sort(diffVertexByID(result.Added))
+	sort.Sort(diffVertexByID(result.Removed))
+	sort.Sort(diffChangeByID(result.Changed))
+	sort.Sort(diffEdgeByID(result.AddedEdges))
+	sort.Sort(diffEdgeByID(result.RemovedEdges))
+	return &result
+}
+
+// diffID returns the ID used to match up a vertex between graphs. This
+// is the Otto ID, falling back to the name for Appfiles without one.
+func diffID(raw dag.Vertex) string {
+	v := raw.(*CompiledGraphVertex)
+	if v.File != nil && v.File.ID != "" {
+		return v.File.ID
+	}
+
+	return v.Name()
+}
+
+func diffVertices(c *Compiled) map[string]*DiffVertex {
+	result := make(map[string]*DiffVertex)
+	for _, raw := range c.Graph.Vertices() {
+		v := raw.(*CompiledGraphVertex)
+		dv := &DiffVertex{ID: diffID(v), Name: v.Name()}
+		if v.File != nil {
+			dv.Source = v.File.Source
+		}
+
+		result[dv.ID] = dv
+	}
+
+	return result
+}
+
+func diffEdges(c *Compiled) map[DiffEdge]struct{} {
+	result := make(map[DiffEdge]struct{})
+	for _, e := range c.Graph.Edges() {
+		result[DiffEdge{
+			Source: diffID(e.Source()),
+			Target: diffID(e.Target()),
+		}] = struct{}{}
+	}
+
+	return result
+}
+
+type diffVertexByID []*DiffVertex
+
+func (s diffVertexByID) Len() int           { return len(s) }
+func (s diffVertexByID) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s diffVertexByID) Less(i, j int) bool { return s[i].ID < s[j].ID }
+
+type diffChangeByID []*DiffVertexChange
+
+func (s diffChangeByID) Len() int           { return len(s) }
+func (s diffChangeByID) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s diffChangeByID) Less(i, j int) bool { return s[i].New.ID < s[j].New.ID }
+
+type diffEdgeByID []*DiffEdge
+
+func (s diffEdgeByID) Len() int      { return len(s) }
+func (s diffEdgeByID) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s diffEdgeByID) Less(i, j int) bool {
+	if s[i].Source != s[j].Source {
+		return s[i].Source < s[j].Source
+	}
+
+	return s[i].Target < s[j].Target
+}
@@ -0,0 +1,100 @@
+package appfile
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/hashicorp/terraform/dag"
+)
+
+func TestDiff(t *testing.T) {
+	foo := testDiffVertex("1", "foo", "")
+	bar := testDiffVertex("2", "bar", "git::https://example.com/bar.git?ref=v1")
+	barNew := testDiffVertex("2", "bar", "git::https://example.com/bar.git?ref=v2")
+	baz := testDiffVertex("3", "baz", "./baz")
+
+	cases := []struct {
+		Name   string
+		Old    *Compiled
+		New    *Compiled
+		Result *GraphDiff
+	}{
+		{
+			"same",
+			testDiffCompiled([]*CompiledGraphVertex{foo, bar}, [][2]int{{0, 1}}),
+			testDiffCompiled([]*CompiledGraphVertex{foo, bar}, [][2]int{{0, 1}}),
+			&GraphDiff{},
+		},
+
+		{
+			"added",
+			testDiffCompiled([]*CompiledGraphVertex{foo}, nil),
+			testDiffCompiled([]*CompiledGraphVertex{foo, baz}, [][2]int{{0, 1}}),
+			&GraphDiff{
+				Added: []*DiffVertex{
+					&DiffVertex{ID: "3", Name: "baz", Source: "./baz"},
+				},
+				AddedEdges: []*DiffEdge{
+					&DiffEdge{Source: "1", Target: "3"},
+				},
+			},
+		},
+
+		{
+			"removed",
+			testDiffCompiled([]*CompiledGraphVertex{foo, baz}, [][2]int{{0, 1}}),
+			testDiffCompiled([]*CompiledGraphVertex{foo}, nil),
+			&GraphDiff{
+				Removed: []*DiffVertex{
+					&DiffVertex{ID: "3", Name: "baz", Source: "./baz"},
+				},
+				RemovedEdges: []*DiffEdge{
+					&DiffEdge{Source: "1", Target: "3"},
+				},
+			},
+		},
+
+		{
+			"changed",
+			testDiffCompiled([]*CompiledGraphVertex{foo, bar}, [][2]int{{0, 1}}),
+			testDiffCompiled([]*CompiledGraphVertex{foo, barNew}, [][2]int{{0, 1}}),
+			&GraphDiff{
+				Changed: []*DiffVertexChange{
+					&DiffVertexChange{
+						Old: &DiffVertex{ID: "2", Name: "bar", Source: bar.File.Source},
+						New: &DiffVertex{ID: "2", Name: "bar", Source: barNew.File.Source},
+					},
+				},
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		actual := Diff(tc.Old, tc.New)
+		if !reflect.DeepEqual(actual, tc.Result) {
+			t.Fatalf("%s bad: %#v", tc.Name, actual)
+		}
+		if actual.Empty() != (tc.Name == "same") {
+			t.Fatalf("%s bad empty: %v", tc.Name, actual.Empty())
+		}
+	}
+}
+
+func testDiffVertex(id, name, source string) *CompiledGraphVertex {
+	return &CompiledGraphVertex{
+		File:      &File{ID: id, Source: source},
+		NameValue: name,
+	}
+}
+
+func testDiffCompiled(vs []*CompiledGraphVertex, edges [][2]int) *Compiled {
+	g := new(dag.AcyclicGraph)
+	for _, v := range vs {
+		g.Add(v)
+	}
+	for _, e := range edges {
+		g.Connect(dag.BasicEdge(vs[e[0]], vs[e[1]]))
+	}
+
+	return &Compiled{File: vs[0].File, Graph: g}
+}
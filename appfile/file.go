@@ -5,13 +5,17 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/hashicorp/otto/helper/oneline"
 	"github.com/hashicorp/otto/helper/uuid"
+	"github.com/mitchellh/copystructure"
 )
 
 const (
+	// IDFile is the default name of the file next to the Appfile that
+	// stores the Otto ID.
 	IDFile = ".ottoid"
 )
 
@@ -30,6 +34,11 @@ type File struct {
 	// value. This can be used for debugging.
 	Source string
 
+	// IDFilename is the path relative to the directory of the Appfile
+	// where the Otto ID is stored. If this is empty, IDFile is used. If
+	// this is set but doesn't exist, an existing IDFile is still used.
+	IDFilename string
+
 	Application    *Application
 	Project        *Project
 	Infrastructure []*Infrastructure
@@ -39,6 +48,44 @@ type File struct {
 	// are realized during compilation, but this list won't be cleared
 	// in case it wants to be inspected later.
 	Imports []*Import
+
+	// Variables are the variables declared in this File. References to
+	// them are interpolated when the File is parsed.
+	Variables []*Variable
+
+	// Aliases are short names for dependency and import sources. A
+	// source that exactly matches the name of an alias is replaced
+	// with the source of the alias during compilation.
+	Aliases []*Alias
+
+	// Labels are arbitrary key/value pairs used to group and filter
+	// applications, such as by team or tier.
+	Labels map[string]string
+
+	// Profiles are named sets of overrides for this File, such as for
+	// staging or production. A profile is applied with ApplyProfile.
+	Profiles []*Profile
+
+	// Positions are where the stanzas and fields of this File are in
+	// the source Appfile, keyed by their path such as "application" or
+	// "project.name". They're used to say where validation problems are.
+	// This is empty if the File wasn't parsed.
+	Positions map[string]Pos
+}
+
+// Pos is a position in an Appfile.
+type Pos struct {
+	Filename string
+	Line     int
+	Column   int
+}
+
+func (p Pos) String() string {
+	if p.Filename == "" {
+		return fmt.Sprintf("%d,%d", p.Line, p.Column)
+	}
+
+	return fmt.Sprintf("%s:%d,%d", p.Filename, p.Line, p.Column)
 }
 
 // Application is the structure of an application definition.
@@ -59,6 +106,10 @@ type Customization struct {
 // Dependency is another Appfile that an App depends on
 type Dependency struct {
 	Source string
+
+	// Tags, if set, make the dependency optional: it is only compiled if
+	// at least one of its tags is active. See CompileOpts.ActiveTags.
+	Tags []string
 }
 
 // Project is the structure of a project that many applications
@@ -90,6 +141,29 @@ type Import struct {
 	Source string
 }
 
+// Variable is a variable that can be referenced within the Appfile
+// with "${var.name}". The value can be overridden with an environment
+// variable, see VariableEnvPrefix.
+type Variable struct {
+	Name        string
+	Default     string
+	Description string
+}
+
+// Profile is a named set of overrides for a File. File is made up of
+// only the stanzas that the profile overrides: application, project,
+// infrastructure and customization.
+type Profile struct {
+	Name string
+	File *File
+}
+
+// Alias is a short name for a dependency or import source.
+type Alias struct {
+	Name   string
+	Source string
+}
+
 //-------------------------------------------------------------------
 // Merging
 //-------------------------------------------------------------------
@@ -143,6 +217,64 @@ func (f *File) Merge(other *File) error {
 	// TODO: customizations
 	f.Customization = other.Customization
 
+	// Variables
+	varMap := make(map[string]int)
+	for i, v := range f.Variables {
+		varMap[v.Name] = i
+	}
+	for _, v := range other.Variables {
+		if idx, ok := varMap[v.Name]; ok {
+			f.Variables[idx] = v
+			continue
+		}
+
+		f.Variables = append(f.Variables, v)
+	}
+
+	// Aliases
+	aliasMap := make(map[string]int)
+	for i, a := range f.Aliases {
+		aliasMap[a.Name] = i
+	}
+	for _, a := range other.Aliases {
+		if idx, ok := aliasMap[a.Name]; ok {
+			f.Aliases[idx] = a
+			continue
+		}
+
+		f.Aliases = append(f.Aliases, a)
+	}
+
+	// Labels
+	if len(other.Labels) > 0 && f.Labels == nil {
+		f.Labels = make(map[string]string)
+	}
+	for k, v := range other.Labels {
+		f.Labels[k] = v
+	}
+
+	// Profiles
+	profileMap := make(map[string]int)
+	for i, p := range f.Profiles {
+		profileMap[p.Name] = i
+	}
+	for _, p := range other.Profiles {
+		if idx, ok := profileMap[p.Name]; ok {
+			f.Profiles[idx] = p
+			continue
+		}
+
+		f.Profiles = append(f.Profiles, p)
+	}
+
+	// Positions
+	if len(other.Positions) > 0 && f.Positions == nil {
+		f.Positions = make(map[string]Pos)
+	}
+	for k, v := range other.Positions {
+		f.Positions[k] = v
+	}
+
 	return nil
 }
 
@@ -161,6 +293,78 @@ func (app *Application) Merge(other *Application) {
 	}
 }
 
+func (p *Project) Merge(other *Project) {
+	if other.Name != "" {
+		p.Name = other.Name
+	}
+	if other.Infrastructure != "" {
+		p.Infrastructure = other.Infrastructure
+	}
+}
+
+// ApplyProfile merges the profile with the given name onto this File.
+// Unlike Merge, only what the profile sets is overridden: the fields of
+// the application and project, and customizations by type.
+// Infrastructures are replaced by name, the same as Merge. An error
+// listing the available profiles is returned if there is no profile with
+// the name.
+func (f *File) ApplyProfile(name string) error {
+	var profile *Profile
+	names := make([]string, 0, len(f.Profiles))
+	for _, p := range f.Profiles {
+		if p.Name == name {
+			profile = p
+		}
+		names = append(names, p.Name)
+	}
+	if profile == nil {
+		if len(names) == 0 {
+			return fmt.Errorf(
+				"unknown profile '%s', no profiles are defined", name)
+		}
+
+		sort.Strings(names)
+		return fmt.Errorf(
+			"unknown profile '%s', available profiles: %s",
+			name, strings.Join(names, ", "))
+	}
+
+	// Copy the profile so that applying it doesn't share any pointers
+	// with it.
+	raw, err := copystructure.Copy(profile.File)
+	if err != nil {
+		return err
+	}
+	other := raw.(*File)
+	if other.Project != nil && f.Project != nil {
+		project := *f.Project
+		project.Merge(other.Project)
+		other.Project = &project
+	}
+
+	// Customizations of the types that the profile sets are replaced
+	// and the rest are kept.
+	if other.Customization == nil {
+		other.Customization = f.Customization
+	} else if f.Customization != nil {
+		types := make(map[string]struct{})
+		for _, c := range other.Customization.Raw {
+			types[c.Type] = struct{}{}
+		}
+
+		raw := make([]*Customization, 0, len(f.Customization.Raw))
+		for _, c := range f.Customization.Raw {
+			if _, ok := types[c.Type]; !ok {
+				raw = append(raw, c)
+			}
+		}
+		other.Customization = &CustomizationSet{
+			Raw: append(raw, other.Customization.Raw...)}
+	}
+
+	return f.Merge(other)
+}
+
 //-------------------------------------------------------------------
 // Helper Methods
 //-------------------------------------------------------------------
@@ -177,16 +381,58 @@ func (f *File) ActiveInfrastructure() *Infrastructure {
 	return nil
 }
 
+// resolveAlias returns the source of the alias with the given name.
+// If there is no such alias, the source is returned unchanged.
+func (f *File) resolveAlias(source string) string {
+	for _, a := range f.Aliases {
+		if a.Name == source {
+			return a.Source
+		}
+	}
+
+	return source
+}
+
 // resetID deletes the ID associated with this file.
 func (f *File) resetID() error {
-	return os.Remove(filepath.Join(filepath.Dir(f.Path), IDFile))
+	return os.Remove(f.idPath())
+}
+
+// idPath returns the path to the file that stores the ID.
+func (f *File) idPath() string {
+	dir := filepath.Dir(f.Path)
+	path := filepath.Join(dir, IDFile)
+	if f.IDFilename == "" {
+		return path
+	}
+
+	// If the configured path doesn't exist but the default does, then
+	// use the default so existing IDs continue to work.
+	custom := filepath.Join(dir, f.IDFilename)
+	if _, err := os.Stat(custom); os.IsNotExist(err) {
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+
+	return custom
+}
+
+// idFile returns the path to the file that stores the ID relative to
+// the directory of the Appfile, for use in messages.
+func (f *File) idFile() string {
+	rel, err := filepath.Rel(filepath.Dir(f.Path), f.idPath())
+	if err != nil {
+		return IDFile
+	}
+
+	return rel
 }
 
 // hasID checks whether we have an ID file. This can return an error
 // for filesystem errors.
 func (f *File) hasID() (bool, error) {
-	path := filepath.Join(filepath.Dir(f.Path), IDFile)
-	_, err := os.Stat(path)
+	_, err := os.Stat(f.idPath())
 	if err != nil && !os.IsNotExist(err) {
 		return false, err
 	}
@@ -197,7 +443,11 @@ func (f *File) hasID() (bool, error) {
 // initID creates a new UUID and writes the file. This will overwrite
 // any prior ID file.
 func (f *File) initID() error {
-	path := filepath.Join(filepath.Dir(f.Path), IDFile)
+	path := f.idPath()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
 	uuid := uuid.GenerateUUID()
 	data := strings.TrimSpace(fmt.Sprintf(idFileTemplate, uuid)) + "\n"
 	return ioutil.WriteFile(path, []byte(data), 0644)
@@ -214,8 +464,7 @@ func (appF *File) loadID() error {
 		return nil
 	}
 
-	path := filepath.Join(filepath.Dir(appF.Path), IDFile)
-	uuid, err := oneline.Read(path)
+	uuid, err := oneline.Read(appF.idPath())
 	if err != nil {
 		return err
 	}
@@ -111,6 +111,27 @@ func (f *Dependency) HCL() *ast.ObjectItem {
 		},
 		Assign: emptyAssign,
 	})
+	if len(f.Tags) > 0 {
+		tags := make([]ast.Node, 0, len(f.Tags))
+		for _, tag := range f.Tags {
+			tags = append(tags, &ast.LiteralType{
+				Token: token.Token{
+					Type: token.STRING,
+					Text: fmt.Sprintf(`"%s"`, tag),
+				},
+			})
+		}
+
+		items = append(items, &ast.ObjectItem{
+			Keys: []*ast.ObjectKey{
+				&ast.ObjectKey{
+					Token: token.Token{Type: token.IDENT, Text: "tags"},
+				},
+			},
+			Val:    &ast.ListType{List: tags},
+			Assign: emptyAssign,
+		})
+	}
 
 	return &ast.ObjectItem{
 		Keys: []*ast.ObjectKey{
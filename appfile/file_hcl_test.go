@@ -19,6 +19,7 @@ func TestFileHCL(t *testing.T) {
 		Input, Output string
 	}{
 		{"basic.hcl", "basic.golden"},
+		{"dependency-tags.hcl", "dependency-tags.golden"},
 	}
 
 	for _, tc := range cases {
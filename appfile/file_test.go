@@ -3,6 +3,7 @@ package appfile
 import (
 	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/mitchellh/copystructure"
@@ -50,6 +51,18 @@ func TestFileMerge(t *testing.T) {
 			},
 		},
 
+		"Labels": {
+			One: &File{
+				Labels: map[string]string{"team": "payments", "tier": "1"},
+			},
+			Two: &File{
+				Labels: map[string]string{"tier": "2"},
+			},
+			Three: &File{
+				Labels: map[string]string{"team": "payments", "tier": "2"},
+			},
+		},
+
 		"Path": {
 			One: &File{
 				Path: "foo",
@@ -271,6 +284,59 @@ func TestFileMerge(t *testing.T) {
 	}
 }
 
+func TestFileApplyProfile(t *testing.T) {
+	f, err := ParseFile(filepath.Join("./test-fixtures", "profile.hcl"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	f.Customization = &CustomizationSet{Raw: []*Customization{
+		&Customization{Type: "ruby", Config: map[string]interface{}{"a": "b"}},
+		&Customization{Type: "go", Config: map[string]interface{}{"c": "d"}},
+	}}
+
+	if err := f.ApplyProfile("production"); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Only the fields that the profile sets are overridden
+	expected := &Project{Name: "foo", Infrastructure: "aws-prod"}
+	if !reflect.DeepEqual(f.Project, expected) {
+		t.Fatalf("bad: %#v", f.Project)
+	}
+	if infra := f.ActiveInfrastructure(); infra == nil || infra.Type != "aws" {
+		t.Fatalf("bad: %#v", infra)
+	}
+
+	// Customizations are replaced by type
+	if c := f.Customization.Filter("go"); len(c) != 1 {
+		t.Fatalf("bad: %#v", c)
+	}
+	c := f.Customization.Filter("ruby")
+	if len(c) != 1 || c[0].Config["region"] != "us-east-1" {
+		t.Fatalf("bad: %#v", c)
+	}
+
+	// The profile itself isn't modified
+	if f.Profiles[0].File.Project.Name != "" {
+		t.Fatalf("bad: %#v", f.Profiles[0].File.Project)
+	}
+}
+
+func TestFileApplyProfile_unknown(t *testing.T) {
+	f, err := ParseFile(filepath.Join("./test-fixtures", "profile.hcl"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	err = f.ApplyProfile("staging")
+	if err == nil {
+		t.Fatal("should error")
+	}
+	if !strings.Contains(err.Error(), "available profiles: production") {
+		t.Fatalf("bad: %s", err)
+	}
+}
+
 func TestFileDeepCopy(t *testing.T) {
 	f, err := ParseFile(filepath.Join("./test-fixtures", "basic.hcl"))
 	if err != nil {
@@ -0,0 +1,97 @@
+package appfile
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+
+	"github.com/hashicorp/go-multierror"
+)
+
+// VariableEnvPrefix is the prefix of environment variables that override
+// the default value of Appfile variables. For example, the variable "foo"
+// can be set with the environment variable "OTTO_VAR_foo".
+const VariableEnvPrefix = "OTTO_VAR_"
+
+// varRe matches a variable reference such as "${var.name}".
+var varRe = regexp.MustCompile(`\$\{var\.([^}]+)\}`)
+
+// interpolate replaces the variable references in the File with their
+// values. References are supported in dependency sources, import sources
+// and customization configuration, including those within profiles.
+func (f *File) interpolate() error {
+	// Build the values for our variables, using the environment to
+	// override the defaults. A variable that is set but empty overrides
+	// the default with an empty string.
+	vars := make(map[string]string, len(f.Variables))
+	for _, v := range f.Variables {
+		vars[v.Name] = v.Default
+		if env, ok := os.LookupEnv(VariableEnvPrefix + v.Name); ok {
+			vars[v.Name] = env
+		}
+	}
+
+	var result error
+	replace := func(s string) string {
+		return varRe.ReplaceAllStringFunc(s, func(ref string) string {
+			name := varRe.FindStringSubmatch(ref)[1]
+			value, ok := vars[name]
+			if !ok {
+				result = multierror.Append(result, fmt.Errorf(
+					"unknown variable '%s' referenced", name))
+			}
+
+			return value
+		})
+	}
+
+	f.interpolateWith(replace)
+	for _, p := range f.Profiles {
+		p.File.interpolateWith(replace)
+	}
+
+	return result
+}
+
+// interpolateWith calls replace on the strings in the File that can
+// reference variables.
+func (f *File) interpolateWith(replace func(string) string) {
+	for _, i := range f.Imports {
+		i.Source = replace(i.Source)
+	}
+
+	if f.Application != nil {
+		for _, d := range f.Application.Dependencies {
+			d.Source = replace(d.Source)
+		}
+	}
+
+	if f.Customization != nil {
+		for _, c := range f.Customization.Raw {
+			c.Config = interpolateValue(c.Config, replace).(map[string]interface{})
+		}
+	}
+}
+
+// interpolateValue calls replace on all the strings within the given
+// value as decoded from HCL, returning the new value.
+func interpolateValue(raw interface{}, replace func(string) string) interface{} {
+	switch v := raw.(type) {
+	case string:
+		return replace(v)
+	case map[string]interface{}:
+		for k, elem := range v {
+			v[k] = interpolateValue(elem, replace)
+		}
+	case []interface{}:
+		for i, elem := range v {
+			v[i] = interpolateValue(elem, replace)
+		}
+	case []map[string]interface{}:
+		for _, elem := range v {
+			interpolateValue(elem, replace)
+		}
+	}
+
+	return raw
+}
@@ -11,14 +11,29 @@ import (
 	"github.com/hashicorp/go-multierror"
 	"github.com/hashicorp/hcl"
 	"github.com/hashicorp/hcl/hcl/ast"
+	"github.com/hashicorp/hcl/hcl/token"
+	jsonParser "github.com/hashicorp/hcl/json/parser"
 	"github.com/mitchellh/mapstructure"
 )
 
 // Parse parses the Appfile from the given io.Reader.
 //
+// The Appfile can be either HCL or JSON. JSON is detected by the contents
+// starting with "{".
+//
 // Due to current internal limitations, the entire contents of the
 // io.Reader will be copied into memory first before parsing.
 func Parse(r io.Reader) (*File, error) {
+	return parse(r, false)
+}
+
+// ParseJSON parses the Appfile from the given io.Reader as JSON. This is
+// the same as Parse except the contents are always treated as JSON.
+func ParseJSON(r io.Reader) (*File, error) {
+	return parse(r, true)
+}
+
+func parse(r io.Reader, json bool) (*File, error) {
 	// Copy the reader into an in-memory buffer first since HCL requires it.
 	var buf bytes.Buffer
 	if _, err := io.Copy(&buf, r); err != nil {
@@ -26,7 +41,13 @@ func Parse(r io.Reader) (*File, error) {
 	}
 
 	// Parse the buffer
-	root, err := hcl.Parse(buf.String())
+	var root *ast.File
+	var err error
+	if json {
+		root, err = jsonParser.Parse(buf.Bytes())
+	} else {
+		root, err = hcl.Parse(buf.String())
+	}
 	if err != nil {
 		return nil, fmt.Errorf("error parsing: %s", err)
 	}
@@ -40,11 +61,15 @@ func Parse(r io.Reader) (*File, error) {
 
 	// Check for invalid keys
 	valid := []string{
+		"alias",
 		"application",
 		"customization",
 		"import",
 		"infrastructure",
+		"labels",
+		"profile",
 		"project",
+		"variable",
 	}
 	if err := checkHCLKeys(list, valid); err != nil {
 		return nil, err
@@ -52,6 +77,20 @@ func Parse(r io.Reader) (*File, error) {
 
 	var result File
 
+	// Parse the variables
+	if o := list.Filter("variable"); len(o.Items) > 0 {
+		if err := parseVariables(&result, o); err != nil {
+			return nil, fmt.Errorf("error parsing 'variable': %s", err)
+		}
+	}
+
+	// Parse the aliases
+	if o := list.Filter("alias"); len(o.Items) > 0 {
+		if err := parseAliases(&result, o); err != nil {
+			return nil, fmt.Errorf("error parsing 'alias': %s", err)
+		}
+	}
+
 	// Parse the imports
 	if o := list.Filter("import"); len(o.Items) > 0 {
 		if err := parseImport(&result, o); err != nil {
@@ -73,6 +112,13 @@ func Parse(r io.Reader) (*File, error) {
 		}
 	}
 
+	// Parse the labels
+	if o := list.Filter("labels"); len(o.Items) > 0 {
+		if err := parseLabels(&result, o); err != nil {
+			return nil, fmt.Errorf("error parsing 'labels': %s", err)
+		}
+	}
+
 	// Parse the infrastructure
 	if o := list.Filter("infrastructure"); len(o.Items) > 0 {
 		if err := parseInfra(&result, o); err != nil {
@@ -87,6 +133,18 @@ func Parse(r io.Reader) (*File, error) {
 		}
 	}
 
+	// Parse the profiles
+	if o := list.Filter("profile"); len(o.Items) > 0 {
+		if err := parseProfiles(&result, o); err != nil {
+			return nil, fmt.Errorf("error parsing 'profile': %s", err)
+		}
+	}
+
+	// Interpolate the variables
+	if err := result.interpolate(); err != nil {
+		return nil, err
+	}
+
 	return &result, nil
 }
 
@@ -103,9 +161,26 @@ func ParseFile(path string) (*File, error) {
 	}
 	defer f.Close()
 
-	result, err := Parse(f)
+	// Files with a ".json" extension are always parsed as JSON,
+	// otherwise we detect it from the contents.
+	parseFunc := Parse
+	if filepath.Ext(path) == ".json" {
+		parseFunc = ParseJSON
+	}
+
+	result, err := parseFunc(f)
 	if result != nil {
 		result.Path = path
+		for k, pos := range result.Positions {
+			pos.Filename = path
+			result.Positions[k] = pos
+		}
+		for _, p := range result.Profiles {
+			for k, pos := range p.File.Positions {
+				pos.Filename = path
+				p.File.Positions[k] = pos
+			}
+		}
 		if err := result.loadID(); err != nil {
 			return nil, err
 		}
@@ -133,6 +208,8 @@ func parseApplication(result *File, list *ast.ObjectList) error {
 		return err
 	}
 
+	recordPositions(result, "application", item)
+
 	app := Application{Detect: true}
 	result.Application = &app
 	return mapstructure.WeakDecode(m, &app)
@@ -312,6 +389,8 @@ func parseProject(result *File, list *ast.ObjectList) error {
 		return err
 	}
 
+	recordPositions(result, "project", item)
+
 	// Parse the project
 	var proj Project
 	result.Project = &proj
@@ -322,6 +401,220 @@ func parseProject(result *File, list *ast.ObjectList) error {
 	return nil
 }
 
+func parseVariables(result *File, list *ast.ObjectList) error {
+	list = list.Children()
+	if len(list.Items) == 0 {
+		return nil
+	}
+
+	// Go through each object and turn it into an actual result.
+	collection := make([]*Variable, 0, len(list.Items))
+	seen := make(map[string]struct{})
+	for _, item := range list.Items {
+		n := item.Keys[0].Token.Value().(string)
+
+		// Make sure we haven't already found this
+		if _, ok := seen[n]; ok {
+			return fmt.Errorf("variable '%s' defined more than once", n)
+		}
+		seen[n] = struct{}{}
+
+		// Check for invalid keys
+		valid := []string{"default", "description"}
+		if err := checkHCLKeys(item.Val, valid); err != nil {
+			return multierror.Prefix(err, fmt.Sprintf(
+				"variable '%s':", n))
+		}
+
+		var m map[string]interface{}
+		if err := hcl.DecodeObject(&m, item.Val); err != nil {
+			return err
+		}
+
+		var v Variable
+		if err := mapstructure.WeakDecode(m, &v); err != nil {
+			return fmt.Errorf(
+				"error parsing variable '%s': %s", n, err)
+		}
+		v.Name = n
+
+		collection = append(collection, &v)
+	}
+
+	result.Variables = collection
+	return nil
+}
+
+func parseAliases(result *File, list *ast.ObjectList) error {
+	list = list.Children()
+	if len(list.Items) == 0 {
+		return nil
+	}
+
+	// Go through each object and turn it into an actual result.
+	collection := make([]*Alias, 0, len(list.Items))
+	seen := make(map[string]struct{})
+	for _, item := range list.Items {
+		n := item.Keys[0].Token.Value().(string)
+
+		// Make sure we haven't already found this
+		if _, ok := seen[n]; ok {
+			return fmt.Errorf("alias '%s' defined more than once", n)
+		}
+		seen[n] = struct{}{}
+
+		// Check for invalid keys
+		valid := []string{"source"}
+		if err := checkHCLKeys(item.Val, valid); err != nil {
+			return multierror.Prefix(err, fmt.Sprintf(
+				"alias '%s':", n))
+		}
+
+		var m map[string]interface{}
+		if err := hcl.DecodeObject(&m, item.Val); err != nil {
+			return err
+		}
+
+		var a Alias
+		if err := mapstructure.WeakDecode(m, &a); err != nil {
+			return fmt.Errorf(
+				"error parsing alias '%s': %s", n, err)
+		}
+		a.Name = n
+
+		if a.Source == "" {
+			return fmt.Errorf("alias '%s': source must be set", n)
+		}
+
+		collection = append(collection, &a)
+	}
+
+	result.Aliases = collection
+	return nil
+}
+
+func parseLabels(result *File, list *ast.ObjectList) error {
+	if len(list.Items) > 1 {
+		return fmt.Errorf("only one 'labels' block allowed")
+	}
+
+	// Get our one item
+	item := list.Items[0]
+	if _, ok := item.Val.(*ast.ObjectType); !ok {
+		return fmt.Errorf("labels: should be an object")
+	}
+
+	var m map[string]interface{}
+	if err := hcl.DecodeObject(&m, item.Val); err != nil {
+		return err
+	}
+
+	recordPositions(result, "labels", item)
+
+	// Labels are only strings, so there's nothing to nest
+	labels := make(map[string]string, len(m))
+	for k, v := range m {
+		switch v.(type) {
+		case string, int, float64, bool:
+			labels[k] = fmt.Sprintf("%v", v)
+		default:
+			return fmt.Errorf("labels: '%s' must be a string", k)
+		}
+	}
+
+	result.Labels = labels
+	return nil
+}
+
+func parseProfiles(result *File, list *ast.ObjectList) error {
+	list = list.Children()
+	if len(list.Items) == 0 {
+		return nil
+	}
+
+	// Go through each object and turn it into an actual result.
+	collection := make([]*Profile, 0, len(list.Items))
+	seen := make(map[string]struct{})
+	for _, item := range list.Items {
+		n := item.Keys[0].Token.Value().(string)
+
+		// Make sure we haven't already found this
+		if _, ok := seen[n]; ok {
+			return fmt.Errorf("profile '%s' defined more than once", n)
+		}
+		seen[n] = struct{}{}
+
+		// Check for invalid keys
+		valid := []string{
+			"application", "customization", "infrastructure", "project"}
+		if err := checkHCLKeys(item.Val, valid); err != nil {
+			return multierror.Prefix(err, fmt.Sprintf(
+				"profile '%s':", n))
+		}
+
+		ot, ok := item.Val.(*ast.ObjectType)
+		if !ok {
+			return fmt.Errorf("profile '%s': should be an object", n)
+		}
+
+		// The profile is parsed like the stanzas of the Appfile itself
+		var f File
+		if o := ot.List.Filter("application"); len(o.Items) > 0 {
+			if err := parseApplication(&f, o); err != nil {
+				return fmt.Errorf("profile '%s': %s", n, err)
+			}
+		}
+		if o := ot.List.Filter("project"); len(o.Items) > 0 {
+			if err := parseProject(&f, o); err != nil {
+				return fmt.Errorf("profile '%s': %s", n, err)
+			}
+		}
+		if o := ot.List.Filter("infrastructure"); len(o.Items) > 0 {
+			if err := parseInfra(&f, o); err != nil {
+				return fmt.Errorf("profile '%s': %s", n, err)
+			}
+		}
+		if o := ot.List.Filter("customization"); len(o.Items) > 0 {
+			if err := parseCustomizations(&f, o); err != nil {
+				return fmt.Errorf("profile '%s': %s", n, err)
+			}
+		}
+
+		collection = append(collection, &Profile{Name: n, File: &f})
+	}
+
+	result.Profiles = collection
+	return nil
+}
+
+// recordPositions records the position of the stanza item as key, and
+// the position of each of its fields as "key.field". If a field is set
+// more than once, the first position is used.
+func recordPositions(result *File, key string, item *ast.ObjectItem) {
+	if result.Positions == nil {
+		result.Positions = make(map[string]Pos)
+	}
+
+	// The key of the stanza is filtered out, so use the start of its
+	// value.
+	result.Positions[key] = astPos(item.Val.Pos())
+	obj, ok := item.Val.(*ast.ObjectType)
+	if !ok {
+		return
+	}
+
+	for _, field := range obj.List.Items {
+		k := fmt.Sprintf("%s.%s", key, field.Keys[0].Token.Value().(string))
+		if _, ok := result.Positions[k]; !ok {
+			result.Positions[k] = astPos(field.Pos())
+		}
+	}
+}
+
+func astPos(pos token.Pos) Pos {
+	return Pos{Filename: pos.Filename, Line: pos.Line, Column: pos.Column}
+}
+
 func checkHCLKeys(node ast.Node, valid []string) error {
 	var list *ast.ObjectList
 	switch n := node.(type) {
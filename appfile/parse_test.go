@@ -1,6 +1,7 @@
 package appfile
 
 import (
+	"os"
 	"path/filepath"
 	"reflect"
 	"testing"
@@ -42,6 +43,36 @@ func TestParse(t *testing.T) {
 			false,
 		},
 
+		{
+			"basic.json",
+			&File{
+				Application: &Application{
+					Name:   "foo",
+					Detect: true,
+					Dependencies: []*Dependency{
+						&Dependency{
+							Source: "foo",
+						},
+						&Dependency{
+							Source: "bar",
+						},
+					},
+				},
+				Project: &Project{
+					Name:           "foo",
+					Infrastructure: "aws",
+				},
+				Infrastructure: []*Infrastructure{
+					&Infrastructure{
+						Name:   "aws",
+						Type:   "aws",
+						Flavor: "foo",
+					},
+				},
+			},
+			false,
+		},
+
 		// Applications
 		{
 			"multi-app.hcl",
@@ -170,6 +201,221 @@ func TestParse(t *testing.T) {
 			false,
 		},
 
+		// Variables
+		{
+			"variables.hcl",
+			&File{
+				Application: &Application{
+					Name:   "foo",
+					Detect: true,
+					Dependencies: []*Dependency{
+						&Dependency{
+							Source: "github.com/hashicorp/bar",
+						},
+					},
+				},
+				Customization: &CustomizationSet{
+					Raw: []*Customization{
+						&Customization{
+							Type: "dev",
+							Config: map[string]interface{}{
+								"go_version": "1.5",
+							},
+						},
+					},
+				},
+				Imports: []*Import{
+					&Import{
+						Source: "github.com/hashicorp/otto-shared",
+					},
+				},
+				Variables: []*Variable{
+					&Variable{
+						Name:    "org",
+						Default: "hashicorp",
+					},
+					&Variable{
+						Name:        "version",
+						Default:     "1.5",
+						Description: "Go version",
+					},
+				},
+			},
+			false,
+		},
+
+		{
+			"variables-unknown.hcl",
+			nil,
+			true,
+		},
+
+		{
+			"variables-dup.hcl",
+			nil,
+			true,
+		},
+
+		// Aliases
+		{
+			"alias.hcl",
+			&File{
+				Application: &Application{
+					Name:   "foo",
+					Detect: true,
+					Dependencies: []*Dependency{
+						&Dependency{
+							Source: "common",
+						},
+					},
+				},
+				Imports: []*Import{
+					&Import{
+						Source: "common",
+					},
+				},
+				Aliases: []*Alias{
+					&Alias{
+						Name:   "common",
+						Source: "git::https://github.com/hashicorp/otto-shared.git",
+					},
+				},
+			},
+			false,
+		},
+
+		{
+			"alias-dup.hcl",
+			nil,
+			true,
+		},
+
+		{
+			"alias-unknown.hcl",
+			nil,
+			true,
+		},
+
+		{
+			"alias-no-source.hcl",
+			nil,
+			true,
+		},
+
+		// Dependency tags
+		{
+			"dependency-tags.hcl",
+			&File{
+				Application: &Application{
+					Name:   "foo",
+					Type:   "bar",
+					Detect: true,
+					Dependencies: []*Dependency{
+						&Dependency{
+							Source: "foo",
+						},
+						&Dependency{
+							Source: "monitoring",
+							Tags:   []string{"prod", "staging"},
+						},
+					},
+				},
+				Project: &Project{
+					Name:           "foo",
+					Infrastructure: "aws",
+				},
+				Infrastructure: []*Infrastructure{
+					&Infrastructure{
+						Name: "aws",
+						Type: "aws",
+					},
+				},
+			},
+			false,
+		},
+
+		// Labels
+		{
+			"labels.hcl",
+			&File{
+				Application: &Application{
+					Name:   "foo",
+					Detect: true,
+				},
+				Labels: map[string]string{
+					"team": "payments",
+					"tier": "1",
+				},
+			},
+			false,
+		},
+
+		{
+			"labels-dup.hcl",
+			nil,
+			true,
+		},
+
+		// Profiles
+		{
+			"profile.hcl",
+			&File{
+				Application: &Application{
+					Name:   "foo",
+					Detect: true,
+				},
+				Project: &Project{
+					Name:           "foo",
+					Infrastructure: "aws",
+				},
+				Variables: []*Variable{
+					&Variable{
+						Name:    "region",
+						Default: "us-east-1",
+					},
+				},
+				Profiles: []*Profile{
+					&Profile{
+						Name: "production",
+						File: &File{
+							Project: &Project{
+								Infrastructure: "aws-prod",
+							},
+							Infrastructure: []*Infrastructure{
+								&Infrastructure{
+									Name: "aws-prod",
+									Type: "aws",
+								},
+							},
+							Customization: &CustomizationSet{
+								Raw: []*Customization{
+									&Customization{
+										Type: "ruby",
+										Config: map[string]interface{}{
+											"region": "us-east-1",
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			false,
+		},
+
+		{
+			"profile-dup.hcl",
+			nil,
+			true,
+		},
+
+		{
+			"profile-unknown-keys.hcl",
+			nil,
+			true,
+		},
+
 		// Unknown keys
 		{
 			"unknown-keys.hcl",
@@ -196,6 +442,10 @@ func TestParse(t *testing.T) {
 				t.Fatalf("file: %s\n\n%s", tc.File, actual.Path)
 			}
 			actual.Path = ""
+			actual.Positions = nil
+			for _, p := range actual.Profiles {
+				p.File.Positions = nil
+			}
 		}
 
 		if !reflect.DeepEqual(actual, tc.Result) {
@@ -203,3 +453,59 @@ func TestParse(t *testing.T) {
 		}
 	}
 }
+
+func TestParse_positions(t *testing.T) {
+	path, err := filepath.Abs(filepath.Join("./test-fixtures", "basic.hcl"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	f, err := ParseFile(path)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := map[string]Pos{
+		"application":            Pos{Filename: path, Line: 1, Column: 13},
+		"application.name":       Pos{Filename: path, Line: 2, Column: 5},
+		"application.dependency": Pos{Filename: path, Line: 4, Column: 5},
+		"project":                Pos{Filename: path, Line: 13, Column: 9},
+		"project.name":           Pos{Filename: path, Line: 14, Column: 5},
+		"project.infrastructure": Pos{Filename: path, Line: 15, Column: 5},
+	}
+	if !reflect.DeepEqual(f.Positions, expected) {
+		t.Fatalf("bad: %#v", f.Positions)
+	}
+}
+
+func TestParse_variablesEnv(t *testing.T) {
+	key := VariableEnvPrefix + "org"
+	if old, ok := os.LookupEnv(key); ok {
+		defer os.Setenv(key, old)
+	} else {
+		defer os.Unsetenv(key)
+	}
+
+	cases := []struct {
+		Value    string
+		Expected string
+	}{
+		{"mitchellh", "github.com/mitchellh/bar"},
+
+		// Set but empty still overrides the default
+		{"", "github.com//bar"},
+	}
+
+	for _, tc := range cases {
+		os.Setenv(key, tc.Value)
+
+		f, err := ParseFile(filepath.Join("./test-fixtures", "variables.hcl"))
+		if err != nil {
+			t.Fatalf("%q: err: %s", tc.Value, err)
+		}
+
+		if actual := f.Application.Dependencies[0].Source; actual != tc.Expected {
+			t.Fatalf("%q: bad: %s", tc.Value, actual)
+		}
+	}
+}
@@ -0,0 +1,2 @@
+alias "common" { source = "./foo" }
+alias "common" { source = "./bar" }
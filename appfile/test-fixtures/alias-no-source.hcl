@@ -0,0 +1 @@
+alias "common" {}
@@ -0,0 +1,4 @@
+alias "common" {
+    source = "./foo"
+    bad = "key"
+}
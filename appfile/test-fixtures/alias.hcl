@@ -0,0 +1,13 @@
+alias "common" {
+    source = "git::https://github.com/hashicorp/otto-shared.git"
+}
+
+import "common" {}
+
+application {
+    name = "foo"
+
+    dependency {
+        source = "common"
+    }
+}
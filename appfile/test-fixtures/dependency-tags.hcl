@@ -0,0 +1,20 @@
+application {
+    name = "foo"
+    type = "bar"
+
+    dependency {
+        source = "foo"
+    }
+
+    dependency {
+        source = "monitoring"
+        tags = ["prod", "staging"]
+    }
+}
+
+project {
+    name = "foo"
+    infrastructure = "aws"
+}
+
+infrastructure "aws" {}
@@ -0,0 +1,11 @@
+application {
+    name = "foo"
+}
+
+labels {
+    team = "payments"
+}
+
+labels {
+    tier = "1"
+}
@@ -0,0 +1,8 @@
+application {
+    name = "foo"
+}
+
+labels {
+    team = "payments"
+    tier = 1
+}
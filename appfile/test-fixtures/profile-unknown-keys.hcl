@@ -0,0 +1,7 @@
+application {
+    name = "foo"
+}
+
+profile "production" {
+    import "foo" {}
+}
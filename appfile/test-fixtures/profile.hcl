@@ -0,0 +1,26 @@
+variable "region" {
+    default = "us-east-1"
+}
+
+application {
+    name = "foo"
+}
+
+project {
+    name = "foo"
+    infrastructure = "aws"
+}
+
+profile "production" {
+    project {
+        infrastructure = "aws-prod"
+    }
+
+    infrastructure "aws-prod" {
+        type = "aws"
+    }
+
+    customization "ruby" {
+        region = "${var.region}"
+    }
+}
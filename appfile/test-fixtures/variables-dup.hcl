@@ -0,0 +1,2 @@
+variable "org" {}
+variable "org" {}
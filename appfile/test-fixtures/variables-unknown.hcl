@@ -0,0 +1,7 @@
+application {
+    name = "foo"
+
+    dependency {
+        source = "github.com/${var.org}/bar"
+    }
+}
@@ -0,0 +1,22 @@
+variable "org" {
+    default = "hashicorp"
+}
+
+variable "version" {
+    default = "1.5"
+    description = "Go version"
+}
+
+import "github.com/${var.org}/otto-shared" {}
+
+application {
+    name = "foo"
+
+    dependency {
+        source = "github.com/${var.org}/bar"
+    }
+}
+
+customization "dev" {
+    go_version = "${var.version}"
+}
@@ -1,50 +1,143 @@
 package appfile
 
 import (
+	"errors"
 	"fmt"
 
 	"github.com/hashicorp/go-multierror"
 )
 
-// Validate validates the Appfile
-func (f *File) Validate() error {
+// ValidationSeverity is how severe a problem found by validation is.
+type ValidationSeverity int
+
+const (
+	// SeverityError is a problem that makes the Appfile invalid.
+	SeverityError ValidationSeverity = iota
+
+	// SeverityWarning is a problem that should be fixed, but doesn't
+	// make the Appfile invalid unless validation is strict.
+	SeverityWarning
+)
+
+// ValidationResult is a single problem found by validation.
+type ValidationResult struct {
+	Severity ValidationSeverity
+	Err      error
+}
+
+func (r *ValidationResult) Error() string {
+	if r.Severity == SeverityWarning {
+		return fmt.Sprintf("warning: %s", r.Err)
+	}
+
+	return r.Err.Error()
+}
+
+// fails returns true if this result fails validation. Warnings only
+// fail validation if it is strict.
+func (r *ValidationResult) fails(strict bool) bool {
+	return r.Severity == SeverityError || strict
+}
+
+// ValidationResults are all the problems found by validation.
+type ValidationResults []*ValidationResult
+
+// Err returns the results that fail validation as a single error, or nil
+// if validation passes. If strict is true, warnings fail validation too.
+func (rs ValidationResults) Err(strict bool) error {
 	var result error
+	for _, r := range rs {
+		if r.fails(strict) {
+			result = multierror.Append(result, r)
+		}
+	}
+
+	return result
+}
+
+// Warnings returns only the warnings.
+func (rs ValidationResults) Warnings() ValidationResults {
+	var result ValidationResults
+	for _, r := range rs {
+		if r.Severity == SeverityWarning {
+			result = append(result, r)
+		}
+	}
+
+	return result
+}
+
+// Validate validates the Appfile. Only errors are returned: use
+// ValidateResults to get the warnings as well.
+func (f *File) Validate() error {
+	return f.ValidateResults().Err(false)
+}
+
+// ValidateResults validates the Appfile and returns all the problems
+// found, tagged with their severity.
+//
+// If the File was parsed, problems are prefixed with where they are in
+// the source Appfile, such as "/path/to/Appfile:12,3: ".
+func (f *File) ValidateResults() ValidationResults {
+	var result ValidationResults
+	add := func(s ValidationSeverity, key, format string, args ...interface{}) {
+		msg := fmt.Sprintf(format, args...)
+		if pos, ok := f.Positions[key]; ok {
+			msg = fmt.Sprintf("%s: %s", pos, msg)
+		}
+
+		result = append(result, &ValidationResult{
+			Severity: s,
+			Err:      errors.New(msg),
+		})
+	}
+	errorf := func(key, format string, args ...interface{}) {
+		add(SeverityError, key, format, args...)
+	}
+	warnf := func(key, format string, args ...interface{}) {
+		add(SeverityWarning, key, format, args...)
+	}
 
 	// Basic checking for stanzas
 	if f.Application == nil {
-		result = multierror.Append(result, fmt.Errorf(
-			"'application' stanza required for Appfile"))
+		errorf("", "'application' stanza required for Appfile")
 	}
 	if f.Project == nil {
-		result = multierror.Append(result, fmt.Errorf(
-			"'project' stanza required for Appfile"))
+		errorf("", "'project' stanza required for Appfile")
 	}
 	if f.Infrastructure == nil {
-		result = multierror.Append(result, fmt.Errorf(
-			"'infrastructure' stanza required for Appfile"))
+		errorf("", "'infrastructure' stanza required for Appfile")
 	}
 
 	// Verify the application itself
 	if f.Application != nil {
 		if f.Application.Name == "" {
-			result = multierror.Append(result, fmt.Errorf(
-				"application: name is required"))
+			errorf("application", "application: name is required")
 		}
 		if f.Application.Type == "" {
-			result = multierror.Append(result, fmt.Errorf(
-				"application: type is required"))
+			errorf("application", "application: type is required")
+		}
+
+		// Listing a dependency twice has no effect, so it is likely
+		// a mistake.
+		seen := make(map[string]struct{})
+		for _, dep := range f.Application.Dependencies {
+			if _, ok := seen[dep.Source]; ok {
+				warnf("application.dependency", "application: dependency '%s' is listed more than once",
+					dep.Source)
+				continue
+			}
+			seen[dep.Source] = struct{}{}
 		}
 	}
 
 	// Validate the project
 	if f.Project != nil {
 		if f.Project.Name == "" {
-			result = multierror.Append(result, fmt.Errorf(
-				"project: name is required"))
+			errorf("project", "project: name is required")
 		}
 		if f.Project.Infrastructure == "" {
-			result = multierror.Append(result, fmt.Errorf(
-				"project: infrastructure is required"))
+			errorf("project", "project: infrastructure is required")
 		} else {
 			found := false
 			for _, i := range f.Infrastructure {
@@ -54,9 +147,8 @@ func (f *File) Validate() error {
 				}
 			}
 			if !found {
-				result = multierror.Append(result, fmt.Errorf(
-					"project: infra '%s' has no corresponding infrastructure stanza",
-					f.Project.Infrastructure))
+				errorf("project.infrastructure", "project: infra '%s' has no corresponding infrastructure stanza",
+					f.Project.Infrastructure)
 			}
 		}
 	}
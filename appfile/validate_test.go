@@ -2,6 +2,7 @@ package appfile
 
 import (
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -54,6 +55,11 @@ func TestFileValidate(t *testing.T) {
 			"validate-project-unknown-infra",
 			true,
 		},
+
+		{
+			"validate-dup-dep",
+			false,
+		},
 	}
 
 	for _, tc := range cases {
@@ -70,3 +76,42 @@ func TestFileValidate(t *testing.T) {
 		}
 	}
 }
+
+func TestFileValidateResults(t *testing.T) {
+	f, err := ParseFile(filepath.Join("./test-fixtures", "validate-dup-dep", "Appfile"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	results := f.ValidateResults()
+	if len(results) != 1 || results[0].Severity != SeverityWarning {
+		t.Fatalf("bad: %#v", results)
+	}
+	if len(results.Warnings()) != 1 {
+		t.Fatalf("bad: %#v", results.Warnings())
+	}
+	if err := results.Err(false); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := results.Err(true); err == nil {
+		t.Fatal("should error when strict")
+	}
+}
+
+func TestFileValidate_positions(t *testing.T) {
+	f, err := ParseFile(filepath.Join(
+		"./test-fixtures", "validate-project-unknown-infra", "Appfile"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	err = f.Validate()
+	if err == nil {
+		t.Fatal("should error")
+	}
+
+	expected := f.Path + ":8,5: project: infra 'aws'"
+	if !strings.Contains(err.Error(), expected) {
+		t.Fatalf("bad: %s", err)
+	}
+}
@@ -56,21 +56,72 @@ func (a *App) Compile(ctx *app.Context) (*app.CompileResult, error) {
 			Callback: custom.process,
 			Schema: map[string]*schema.FieldSchema{
 				"go_version": &schema.FieldSchema{
-					Type:        schema.TypeString,
-					Default:     "1.5",
-					Description: "Go version to install",
+					Type:         schema.TypeString,
+					Default:      "1.5",
+					DefaultEnv:   "OTTO_GO_VERSION",
+					Description:  "Go version to install",
+					ValidateFunc: validateGoVersion,
 				},
 
 				"go_import_path": &schema.FieldSchema{
+					Type:           schema.TypeString,
+					Description:    "Go import path for where to put this in the GOPATH",
+					ValidateRegexp: importPathRegexp,
+				},
+
+				"main_package": &schema.FieldSchema{
+					Type:           schema.TypeString,
+					Description:    "Package to build and run, such as ./cmd/app. Detected if unset",
+					ValidateRegexp: mainPackageRegexp,
+				},
+
+				"run_command": &schema.FieldSchema{
+					Type:        schema.TypeStringList,
+					Default:     "{{ dep_binary_path }}",
+					Description: "Command or list of commands to run this app as a dep",
+				},
+
+				"healthcheck_command": &schema.FieldSchema{
 					Type:        schema.TypeString,
 					Default:     "",
-					Description: "Go import path for where to put this in the GOPATH",
+					Description: "Command that succeeds when this app is healthy",
 				},
 
-				"run_command": &schema.FieldSchema{
+				"test_command": &schema.FieldSchema{
 					Type:        schema.TypeString,
-					Default:     "{{ dep_binary_path }}",
-					Description: "Command to run this app as a dep",
+					Default:     "go test ./...",
+					Description: "Command to run the tests for this app",
+				},
+
+				"race": &schema.FieldSchema{
+					Type:        schema.TypeBool,
+					Default:     false,
+					Description: "Build and run with the Go race detector",
+				},
+
+				"generate": &schema.FieldSchema{
+					Type:        schema.TypeBool,
+					Default:     false,
+					Description: "Run go generate before building",
+				},
+
+				"debug": &schema.FieldSchema{
+					Type:        schema.TypeBool,
+					Default:     false,
+					Description: "Install Delve and forward a port for debugging",
+				},
+
+				"debug_port": &schema.FieldSchema{
+					Type:         schema.TypeInt,
+					Default:      2345,
+					Description:  "Port Delve listens on for a debugger",
+					ValidateFunc: validatePort,
+				},
+
+				"vendor": &schema.FieldSchema{
+					Type:        schema.TypeBool,
+					DefaultFunc: custom.detectVendor,
+					Description: "Use the vendor directory instead of fetching dependencies",
 				},
 			},
 		}).Merge(compile.VagrantCustomizations(&opts)),
@@ -3,6 +3,7 @@ package goapp
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/hashicorp/otto/app"
@@ -73,3 +74,419 @@ func TestApp_importPath(t *testing.T) {
 		},
 	})
 }
+
+func TestApp_importPath_explicitEmpty(t *testing.T) {
+	gopath := filepath.Join("./test-fixtures", "gopath")
+
+	compile.AppTest(true)
+	defer compile.AppTest(false)
+
+	// The app is in the GOPATH, but detection is disabled
+	defer os.Setenv("GOPATH", os.Getenv("GOPATH"))
+	os.Setenv("GOPATH", gopath)
+
+	otto.Test(t, otto.TestCase{
+		Unit: true,
+		Core: otto.TestCore(t, &otto.TestCoreOpts{
+			Path: filepath.Join(gopath, "src", "explicit-empty", "Appfile"),
+			App:  new(App),
+		}),
+
+		Steps: []otto.TestStep{
+			&compile.AppTestStepContext{
+				Key:   "import_path",
+				Value: "",
+			},
+
+			&compile.AppTestStepContext{
+				Key:   "shared_folder_path",
+				Value: "/vagrant",
+			},
+		},
+	})
+}
+
+func TestApp_goVersionEnv(t *testing.T) {
+	compile.AppTest(true)
+	defer compile.AppTest(false)
+
+	defer os.Setenv("OTTO_GO_VERSION", os.Getenv("OTTO_GO_VERSION"))
+	os.Setenv("OTTO_GO_VERSION", "1.6")
+
+	otto.Test(t, otto.TestCase{
+		Unit: true,
+		Core: otto.TestCore(t, &otto.TestCoreOpts{
+			Path: filepath.Join("./test-fixtures", "basic", "Appfile"),
+			App:  new(App),
+		}),
+
+		Steps: []otto.TestStep{
+			&compile.AppTestStepContext{
+				Key:   "dev_go_version",
+				Value: "1.6",
+			},
+		},
+	})
+}
+
+func TestApp_healthcheck(t *testing.T) {
+	compile.AppTest(true)
+	defer compile.AppTest(false)
+
+	cases := []struct {
+		Fixture string
+		Value   string
+	}{
+		{"basic", ""},
+		{"healthcheck", "curl -f http://localhost/health"},
+	}
+
+	for _, tc := range cases {
+		otto.Test(t, otto.TestCase{
+			Unit: true,
+			Core: otto.TestCore(t, &otto.TestCoreOpts{
+				Path: filepath.Join("./test-fixtures", tc.Fixture, "Appfile"),
+				App:  new(App),
+			}),
+
+			Steps: []otto.TestStep{
+				&compile.AppTestStepContext{
+					Key:   "healthcheck_command",
+					Value: tc.Value,
+				},
+			},
+		})
+	}
+}
+
+func TestApp_testCommand(t *testing.T) {
+	compile.AppTest(true)
+	defer compile.AppTest(false)
+
+	cases := []struct {
+		Fixture string
+		Value   string
+	}{
+		{"basic", "go test ./..."},
+		{"test-command", "go test ./... -count=1 -tags=integration"},
+	}
+
+	for _, tc := range cases {
+		otto.Test(t, otto.TestCase{
+			Unit: true,
+			Core: otto.TestCore(t, &otto.TestCoreOpts{
+				Path: filepath.Join("./test-fixtures", tc.Fixture, "Appfile"),
+				App:  new(App),
+			}),
+
+			Steps: []otto.TestStep{
+				&compile.AppTestStepContext{
+					Key:   "test_command",
+					Value: tc.Value,
+				},
+			},
+		})
+	}
+}
+
+func TestApp_race(t *testing.T) {
+	compile.AppTest(true)
+	defer compile.AppTest(false)
+
+	cases := []struct {
+		Fixture string
+		Value   bool
+	}{
+		{"basic", false},
+		{"race", true},
+	}
+
+	for _, tc := range cases {
+		otto.Test(t, otto.TestCase{
+			Unit: true,
+			Core: otto.TestCore(t, &otto.TestCoreOpts{
+				Path: filepath.Join("./test-fixtures", tc.Fixture, "Appfile"),
+				App:  new(App),
+			}),
+
+			Steps: []otto.TestStep{
+				&compile.AppTestStepContext{
+					Key:   "race",
+					Value: tc.Value,
+				},
+			},
+		})
+	}
+}
+
+func TestApp_generate(t *testing.T) {
+	compile.AppTest(true)
+	defer compile.AppTest(false)
+
+	cases := []struct {
+		Fixture string
+		Value   bool
+	}{
+		{"basic", false},
+		{"generate", true},
+	}
+
+	for _, tc := range cases {
+		otto.Test(t, otto.TestCase{
+			Unit: true,
+			Core: otto.TestCore(t, &otto.TestCoreOpts{
+				Path: filepath.Join("./test-fixtures", tc.Fixture, "Appfile"),
+				App:  new(App),
+			}),
+
+			Steps: []otto.TestStep{
+				&compile.AppTestStepContext{
+					Key:   "generate",
+					Value: tc.Value,
+				},
+			},
+		})
+	}
+}
+
+func TestApp_debug(t *testing.T) {
+	compile.AppTest(true)
+	defer compile.AppTest(false)
+
+	cases := []struct {
+		Fixture string
+		Debug   bool
+		Port    int
+	}{
+		{"basic", false, 2345},
+		{"debug", true, 4000},
+	}
+
+	for _, tc := range cases {
+		otto.Test(t, otto.TestCase{
+			Unit: true,
+			Core: otto.TestCore(t, &otto.TestCoreOpts{
+				Path: filepath.Join("./test-fixtures", tc.Fixture, "Appfile"),
+				App:  new(App),
+			}),
+
+			Steps: []otto.TestStep{
+				&compile.AppTestStepContext{
+					Key:   "debug",
+					Value: tc.Debug,
+				},
+
+				&compile.AppTestStepContext{
+					Key:   "debug_port",
+					Value: tc.Port,
+				},
+
+				&compile.AppTestStepContext{
+					Key:   "delve_version",
+					Value: delveVersion,
+				},
+			},
+		})
+	}
+}
+
+func TestApp_debugGoVersion(t *testing.T) {
+	core := otto.TestCore(t, &otto.TestCoreOpts{
+		Path: filepath.Join("./test-fixtures", "debug-old-go", "Appfile"),
+		App:  new(App),
+	})
+
+	// Delve can't be installed with this Go version
+	err := core.Compile()
+	if err == nil {
+		t.Fatal("should error")
+	}
+	if !strings.Contains(err.Error(), "requires Go "+minDebugGoVersion) {
+		t.Fatalf("bad: %s", err)
+	}
+}
+
+func TestApp_vendor(t *testing.T) {
+	compile.AppTest(true)
+	defer compile.AppTest(false)
+
+	cases := []struct {
+		Fixture string
+		Value   bool
+	}{
+		{"basic", false},
+		{"vendor", true},
+		{filepath.Join("gopath-vendor", "src", "example.com"), false},
+	}
+
+	for _, tc := range cases {
+		otto.Test(t, otto.TestCase{
+			Unit: true,
+			Core: otto.TestCore(t, &otto.TestCoreOpts{
+				Path: filepath.Join("./test-fixtures", tc.Fixture, "Appfile"),
+				App:  new(App),
+			}),
+
+			Steps: []otto.TestStep{
+				&compile.AppTestStepContext{
+					Key:   "vendor",
+					Value: tc.Value,
+				},
+			},
+		})
+	}
+}
+
+func TestApp_vendorBuild(t *testing.T) {
+	gopath := filepath.Join("./test-fixtures", "gopath-vendor")
+
+	compile.AppTest(true)
+	defer compile.AppTest(false)
+
+	defer os.Setenv("GOPATH", os.Getenv("GOPATH"))
+	os.Setenv("GOPATH", gopath)
+
+	cases := []struct {
+		Fixture     string
+		Contains    []string
+		NotContains []string
+	}{
+		// Modules build with the vendor directory
+		{
+			filepath.Join("./test-fixtures", "vendor"),
+			[]string{"go build -mod=vendor"},
+			[]string{"go get"},
+		},
+
+		// GOPATH layouts use the vendor directory without any flags
+		{
+			filepath.Join(gopath, "src", "example.com"),
+			[]string{"go get", "go build -o"},
+			[]string{"-mod=vendor"},
+		},
+	}
+
+	for _, tc := range cases {
+		otto.Test(t, otto.TestCase{
+			Unit: true,
+			Core: otto.TestCore(t, &otto.TestCoreOpts{
+				Path: filepath.Join(tc.Fixture, "Appfile"),
+				App:  new(App),
+			}),
+
+			Steps: []otto.TestStep{
+				&compile.AppTestStepFile{
+					Path:        filepath.Join("dev-dep", "build.sh"),
+					Contains:    tc.Contains,
+					NotContains: tc.NotContains,
+				},
+			},
+		})
+	}
+}
+
+func TestApp_mainPackage(t *testing.T) {
+	compile.AppTest(true)
+	defer compile.AppTest(false)
+
+	cases := []struct {
+		Fixture string
+		Value   string
+	}{
+		{"basic", "."},
+		{"main-package", "./cmd/app"},
+	}
+
+	for _, tc := range cases {
+		otto.Test(t, otto.TestCase{
+			Unit: true,
+			Core: otto.TestCore(t, &otto.TestCoreOpts{
+				Path: filepath.Join("./test-fixtures", tc.Fixture, "Appfile"),
+				App:  new(App),
+			}),
+
+			Steps: []otto.TestStep{
+				&compile.AppTestStepContext{
+					Key:   "main_package",
+					Value: tc.Value,
+				},
+			},
+		})
+	}
+}
+
+func TestApp_workspace(t *testing.T) {
+	compile.AppTest(true)
+	defer compile.AppTest(false)
+
+	root, err := filepath.Abs(filepath.Join("./test-fixtures", "workspace"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	otto.Test(t, otto.TestCase{
+		Unit: true,
+		Core: otto.TestCore(t, &otto.TestCoreOpts{
+			Path: filepath.Join("./test-fixtures", "workspace", "app", "Appfile"),
+			App:  new(App),
+		}),
+
+		Steps: []otto.TestStep{
+			&compile.AppTestStepContext{
+				Key:   "workspace_path",
+				Value: root,
+			},
+
+			&compile.AppTestStepContext{
+				Key:   "import_path",
+				Value: "",
+			},
+
+			&compile.AppTestStepContext{
+				Key:   "shared_folder_path",
+				Value: "/otto-workspace/app",
+			},
+		},
+	})
+}
+
+func TestApp_runCommand(t *testing.T) {
+	compile.AppTest(true)
+	defer compile.AppTest(false)
+
+	cases := []struct {
+		Fixture  string
+		Commands []string
+	}{
+		{
+			"basic",
+			[]string{"/usr/local/bin/basic"},
+		},
+		{
+			"run-command-list",
+			[]string{"echo setup", "/usr/local/bin/run-command-list -v"},
+		},
+	}
+
+	for _, tc := range cases {
+		otto.Test(t, otto.TestCase{
+			Unit: true,
+			Core: otto.TestCore(t, &otto.TestCoreOpts{
+				Path: filepath.Join("./test-fixtures", tc.Fixture, "Appfile"),
+				App:  new(App),
+			}),
+
+			Steps: []otto.TestStep{
+				&compile.AppTestStepContext{
+					Key:   "dep_run_commands",
+					Value: tc.Commands,
+				},
+
+				&compile.AppTestStepContext{
+					Key:   "dep_run_command",
+					Value: strings.Join(tc.Commands, " && "),
+				},
+			},
+		})
+	}
+}
@@ -2,44 +2,148 @@ package goapp
 
 import (
 	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
 
+	"github.com/hashicorp/go-version"
 	"github.com/hashicorp/otto/helper/compile"
 	"github.com/hashicorp/otto/helper/schema"
 )
 
+const (
+	// delveVersion is the version of Delve that is installed in the
+	// development environment when debug is set.
+	delveVersion = "v1.22.1"
+
+	// minDebugGoVersion is the oldest Go version that can install and
+	// run delveVersion.
+	minDebugGoVersion = "1.20"
+
+	// minVendorModGoVersion is the oldest Go version that supports
+	// building with -mod=vendor.
+	minVendorModGoVersion = "1.14"
+)
+
 type customizations struct {
 	Opts *compile.AppOptions
 }
 
 func (c *customizations) process(d *schema.FieldData) error {
-	cmd, err := c.Opts.Bindata.RenderString(d.Get("run_command").(string))
+	// The run command can be a list of commands to run in order, where
+	// the last one is the app itself.
+	rawCmds := d.Get("run_command").([]string)
+	cmds := make([]string, len(rawCmds))
+	for i, v := range rawCmds {
+		cmd, err := c.Opts.Bindata.RenderString(v)
+		if err != nil {
+			return fmt.Errorf("Error processing 'run_command': %s", err)
+		}
+
+		cmds[i] = cmd
+	}
+
+	c.Opts.Bindata.Context["dep_run_commands"] = cmds
+	c.Opts.Bindata.Context["dep_run_command"] = strings.Join(cmds, " && ")
+
+	// The health check is optional, so only render it if it is set
+	healthcheck := d.Get("healthcheck_command").(string)
+	if healthcheck != "" {
+		var err error
+		healthcheck, err = c.Opts.Bindata.RenderString(healthcheck)
+		if err != nil {
+			return fmt.Errorf("Error processing 'healthcheck_command': %s", err)
+		}
+	}
+
+	c.Opts.Bindata.Context["healthcheck_command"] = healthcheck
+
+	testCmd, err := c.Opts.Bindata.RenderString(d.Get("test_command").(string))
 	if err != nil {
-		return fmt.Errorf("Error processing 'run_command': %s", err)
+		return fmt.Errorf("Error processing 'test_command': %s", err)
 	}
 
-	c.Opts.Bindata.Context["dep_run_command"] = cmd
+	c.Opts.Bindata.Context["test_command"] = testCmd
 
+	c.Opts.Bindata.Context["race"] = d.Get("race")
+	c.Opts.Bindata.Context["generate"] = d.Get("generate")
+	debug := d.Get("debug").(bool)
+	if debug {
+		if err := checkDebugGoVersion(d.Get("go_version").(string)); err != nil {
+			return err
+		}
+	}
+
+	c.Opts.Bindata.Context["debug"] = debug
+	c.Opts.Bindata.Context["debug_port"] = d.Get("debug_port")
+	c.Opts.Bindata.Context["delve_version"] = delveVersion
+
+	vendor, err := d.GetErr("vendor")
+	if err != nil {
+		return err
+	}
+	vendorMod, err := c.vendorMod(vendor.(bool), d.Get("go_version").(string))
+	if err != nil {
+		return err
+	}
+	c.Opts.Bindata.Context["vendor"] = vendor
+	c.Opts.Bindata.Context["vendor_mod"] = vendorMod
 	c.Opts.Bindata.Context["dev_go_version"] = d.Get("go_version")
 
+	mainPkg, err := c.mainPackage(d)
+	if err != nil {
+		return err
+	}
+	c.Opts.Bindata.Context["main_package"] = mainPkg
+
+	// If the app is part of a multi-module workspace, then the GOPATH
+	// doesn't matter. Instead we sync the whole workspace and work from
+	// the app's directory within it.
+	root, rel, err := DetectWorkspace(filepath.Dir(c.Opts.Ctx.Appfile.Path))
+	if err != nil {
+		return err
+	}
+	if root != "" {
+		c.Opts.Ctx.Ui.Header("Detected Go workspace (go.work)...")
+		c.Opts.Ctx.Ui.Message(fmt.Sprintf(
+			"Found a go.work file in %s.\n\n"+
+				"Otto will sync this workspace into your dev and build environments\n"+
+				"and use the application's directory within it as the working\n"+
+				"directory. The GOPATH won't be setup, since it isn't used in\n"+
+				"workspace mode.",
+			root))
+
+		c.Opts.Bindata.Context["import_path"] = ""
+		c.Opts.Bindata.Context["workspace_path"] = root
+		c.Opts.Bindata.Context["workspace_guest_path"] = workspaceGuestPath
+		c.Opts.Bindata.Context["shared_folder_path"] = path.Join(
+			workspaceGuestPath, filepath.ToSlash(rel))
+		return nil
+	}
+
+	c.Opts.Bindata.Context["workspace_path"] = ""
+
 	// Go is really finicky about the GOPATH. To help make the dev
-	// environment and build environment more correct, we attempt to
-	// detect the GOPATH automatically.
+	// environment and build environment more correct, the import path
+	// is detected automatically if it isn't set (see detectImportPath).
+	// It can be explicitly set to an empty string to skip detection and
+	// not use the GOPATH.
 	//
 	// We use this GOPATH for example in Vagrant to setup the synced
 	// folder directly into the GOPATH properly. Magic!
-	gopathPath := d.Get("go_import_path").(string)
-	if gopathPath == "" {
-		var err error
-		c.Opts.Ctx.Ui.Header("Detecting application import path for GOPATH...")
-		gopathPath, err = DetectImportPath(c.Opts.Ctx)
+	raw, ok := d.GetOk("go_import_path")
+	if !ok {
+		raw, err = c.detectImportPath()
 		if err != nil {
 			return err
 		}
 	}
+	gopathPath := raw.(string)
 
 	folderPath := "/vagrant"
 	if gopathPath != "" {
-		folderPath = "/opt/gopath/src/" + gopathPath
+		folderPath = path.Join("/opt/gopath/src", gopathPath)
 	}
 
 	c.Opts.Bindata.Context["import_path"] = gopathPath
@@ -47,3 +151,146 @@ func (c *customizations) process(d *schema.FieldData) error {
 
 	return nil
 }
+
+// detectImportPath detects the value of go_import_path. It is only
+// called if the import path isn't set at all.
+func (c *customizations) detectImportPath() (interface{}, error) {
+	c.Opts.Ctx.Ui.Header("Detecting application import path for GOPATH...")
+	return DetectImportPath(c.Opts.Ctx)
+}
+
+// mainPackage returns the value of main_package, detecting it if it isn't
+// set. If there is no main package, the root of the application is used
+// as before detection existed. If there are several, one must be chosen
+// with main_package unless run_command is set, since then the command
+// decides what runs.
+func (c *customizations) mainPackage(d *schema.FieldData) (string, error) {
+	if raw, ok := d.GetOk("main_package"); ok {
+		return raw.(string), nil
+	}
+
+	pkgs, err := DetectMainPackages(filepath.Dir(c.Opts.Ctx.Appfile.Path))
+	if err != nil {
+		return "", err
+	}
+
+	switch len(pkgs) {
+	case 0:
+		return ".", nil
+	case 1:
+		if pkgs[0] != "." {
+			c.Opts.Ctx.Ui.Header("Detected main package: " + pkgs[0])
+		}
+
+		return pkgs[0], nil
+	default:
+		if _, ok := d.GetOk("run_command"); ok {
+			return ".", nil
+		}
+
+		return "", fmt.Errorf(
+			"Multiple main packages were found: %s\n\n"+
+				"Otto can't tell which one to build and run. Set the 'main_package'\n"+
+				"customization to the one to use, or set 'run_command' to run the\n"+
+				"application yourself.",
+			strings.Join(pkgs, ", "))
+	}
+}
+
+// detectVendor is the DefaultFunc for vendor. It returns true if the
+// application is a module with a vendor directory next to the Appfile.
+// GOPATH layouts use their vendor directory without any flags, so it
+// isn't enabled for them.
+func (c *customizations) detectVendor() (interface{}, error) {
+	dir := filepath.Dir(c.Opts.Ctx.Appfile.Path)
+	mod, err := c.isModule()
+	if err != nil || !mod {
+		return false, err
+	}
+
+	fi, err := os.Stat(filepath.Join(dir, "vendor"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+		}
+
+		return false, err
+	}
+
+	return fi.IsDir(), nil
+}
+
+// vendorMod returns whether the build needs -mod=vendor to use the
+// vendor directory. That is only the case for modules, and only Go 1.14
+// and later support the flag. Otherwise vendoring only skips `go get`.
+func (c *customizations) vendorMod(vendor bool, goVersion string) (bool, error) {
+	if !vendor {
+		return false, nil
+	}
+
+	v, err := version.NewVersion(goVersion)
+	if err != nil {
+		return false, fmt.Errorf("invalid Go version %q: %s", goVersion, err)
+	}
+	if v.LessThan(version.Must(version.NewVersion(minVendorModGoVersion))) {
+		return false, nil
+	}
+
+	return c.isModule()
+}
+
+// isModule returns true if there is a go.mod next to the Appfile.
+func (c *customizations) isModule() (bool, error) {
+	path := filepath.Join(filepath.Dir(c.Opts.Ctx.Appfile.Path), "go.mod")
+	if _, err := os.Stat(path); err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+		}
+
+		return false, err
+	}
+
+	return true, nil
+}
+
+// validateGoVersion verifies that the go_version customization is
+// a valid version string.
+func validateGoVersion(v interface{}) ([]string, []error) {
+	if _, err := version.NewVersion(v.(string)); err != nil {
+		return nil, []error{fmt.Errorf(
+			"invalid Go version %q: %s", v, err)}
+	}
+
+	return nil, nil
+}
+
+// checkDebugGoVersion verifies that Delve can be installed with the Go
+// version goVersion when the debug customization is set.
+func checkDebugGoVersion(goVersion string) error {
+	v, err := version.NewVersion(goVersion)
+	if err != nil {
+		return fmt.Errorf("invalid Go version %q: %s", goVersion, err)
+	}
+
+	if v.LessThan(version.Must(version.NewVersion(minDebugGoVersion))) {
+		return fmt.Errorf(
+			"The 'debug' customization requires Go %s or later, but\n"+
+				"'go_version' is %s. Delve %s can't be installed with older\n"+
+				"versions of Go. Set 'go_version' to %s or later, or disable\n"+
+				"'debug'.",
+			minDebugGoVersion, goVersion, delveVersion, minDebugGoVersion)
+	}
+
+	return nil
+}
+
+// validatePort verifies that the debug_port customization is a valid
+// TCP port.
+func validatePort(v interface{}) ([]string, []error) {
+	if port := v.(int); port < 1 || port > 65535 {
+		return nil, []error{fmt.Errorf(
+			"invalid port %d: must be between 1 and 65535", port)}
+	}
+
+	return nil, nil
+}
@@ -8,11 +8,17 @@
 Vagrant.configure("2") do |config|
   config.vm.box = "hashicorp/precise64"
 
+  {% if workspace_path != "" %}
+  # Setup a synced folder from the root of our Go workspace
+  config.vm.synced_folder '{{ workspace_path }}', "{{ workspace_guest_path }}",
+    owner: "vagrant", group: "vagrant"
+  {% else %}
   # Setup a synced folder from our working directory to /vagrant
   config.vm.synced_folder '{{ path.working }}', "{{ shared_folder_path }}",
     owner: "vagrant", group: "vagrant"
+  {% endif %}
 
-  {% if import_path != "" %}
+  {% if import_path != "" or workspace_path != "" %}
   # Disable the default synced folder
   config.vm.synced_folder ".", "/vagrant", disabled: true
   {% endif %}
@@ -18,11 +18,20 @@ export PS1="> "
 # Go into our working directory
 cd {{ shared_folder_path }}
 
-# Get all the dependencies
+{% if not vendor %}
+# Get all the dependencies. If they're vendored, we build with
+# those rather than fetching them.
 ol "Getting dependencies..."
 go get -v ./...
+{% endif %}
+
+{% if generate %}
+# Regenerate any generated code so the build uses fresh output
+ol "Running go generate..."
+go generate{% if vendor_mod %} -mod=vendor{% endif %} ./...
+{% endif %}
 
 # Build the project and write the output into our shared directory
 # with the compiled directory so that we can easily extract it.
 ol "Building..."
-go build -o "/otto-cache/dev-dep-output"
+go build{% if vendor_mod %} -mod=vendor{% endif %}{% if race %} -race{% endif %} -o "/otto-cache/dev-dep-output" {{ main_package|safe }}
@@ -10,5 +10,21 @@ stop on runlevel [06]
 post-stop exec sleep 5
 
 script
-  {{ dep_run_command }} >>/var/log/{{ name }}.log 2>&1
+{% for cmd in dep_run_commands %}  {{ cmd|safe }} >>/var/log/{{ name }}.log 2>&1
+{% endfor %}end script
+{% if healthcheck_command %}
+
+# Wait for the app to be healthy before it is considered started, and
+# give up if it isn't healthy within a minute.
+post-start script
+  tries=0
+  until {{ healthcheck_command|safe }}; do
+    tries=$((tries + 1))
+    if [ "$tries" -ge 60 ]; then
+      echo "{{ name }} wasn't healthy after $tries tries" >>/var/log/{{ name }}.log
+      exit 1
+    fi
+    sleep 1
+  done
 end script
+{% endif %}
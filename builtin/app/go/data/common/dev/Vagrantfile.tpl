@@ -5,13 +5,19 @@
 {% endblock %}
 
 {% block default_shared_folder %}
+  {% if workspace_path != "" %}
+  # Setup a synced folder from the root of our Go workspace
+  config.vm.synced_folder '{{ workspace_path }}', "{{ workspace_guest_path }}",
+    owner: "vagrant", group: "vagrant"
+  {% else %}
   # Setup a synced folder from our working directory to /vagrant
   config.vm.synced_folder '{{ path.working }}', "{{ shared_folder_path }}",
     owner: "vagrant", group: "vagrant"
+  {% endif %}
 {% endblock %}
 
 {% block vagrant_config %}
-  {% if import_path != "" %}
+  {% if import_path != "" or workspace_path != "" %}
   # Disable the default synced folder
   config.vm.synced_folder ".", "/vagrant", disabled: true
   {% endif %}
@@ -19,4 +25,82 @@
   # Make it so that `vagrant ssh` goes directly to the correct dir
   config.vm.provision "shell", inline:
     %Q[echo "cd {{ shared_folder_path }}" >> /home/vagrant/.profile]
+
+  {% if vendor_mod %}
+  # Use the vendored dependencies rather than fetching them
+  config.vm.provision "shell", inline:
+    %Q[echo "export GOFLAGS=-mod=vendor" >> /home/vagrant/.profile]
+  {% endif %}
+
+  {% if race %}
+  # Build and run with the race detector by default
+  config.vm.provision "shell", inline: $script_race
+  {% endif %}
+
+  {% if generate %}
+  # Regenerate any generated code before development starts
+  config.vm.provision "shell", inline: $script_generate, privileged: false
+  {% endif %}
+
+  {% if debug %}
+  # Install Delve and forward its port so a debugger can attach
+  config.vm.network "forwarded_port",
+    guest: {{ debug_port }}, host: {{ debug_port }}, auto_correct: true
+  config.vm.provision "shell", inline: $script_debug, privileged: false
+  {% endif %}
+{% endblock %}
+
+{% block footer %}
+{% if race %}
+$script_race = <<SCRIPT
+cat >> /home/vagrant/.profile <<'EOF'
+go() {
+    case "$1" in
+    build|install|run|test)
+        cmd="$1"; shift
+        command go "$cmd" -race "$@"
+        ;;
+    *)
+        command go "$@"
+        ;;
+    esac
+}
+EOF
+SCRIPT
+{% endif %}
+
+{% if generate %}
+$script_generate = <<SCRIPT
+set -e
+
+ol() { echo "[otto] $@"; }
+
+. /home/vagrant/.profile
+
+cd {{ shared_folder_path }}
+ol "Running go generate..."
+go generate ./...
+SCRIPT
+{% endif %}
+
+{% if debug %}
+$script_debug = <<SCRIPT
+set -e
+
+ol() { echo "[otto] $@"; }
+
+. /home/vagrant/.profile
+
+if ! command -v dlv >/dev/null 2>&1; then
+    ol "Installing Delve..."
+    go install github.com/go-delve/delve/cmd/dlv@{{ delve_version }}
+fi
+
+cat >> /home/vagrant/.profile <<'EOF'
+debug() {
+    dlv debug --headless --listen=:{{ debug_port }} "$@"
+}
+EOF
+SCRIPT
+{% endif %}
 {% endblock %}
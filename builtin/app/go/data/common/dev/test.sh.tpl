@@ -0,0 +1,18 @@
+#!/bin/bash
+#
+# Auto-generated by Otto.
+#
+# This is the test script for a Go-based project. It is run from within
+# the development environment.
+set -e
+
+ol() { echo "[otto] $@"; }
+
+# Source our profile so we get our path properly setup
+. /home/vagrant/.profile
+
+# Go into our working directory
+cd {{ shared_folder_path }}
+
+ol "Running tests..."
+{{ test_command|safe }}
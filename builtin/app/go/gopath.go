@@ -4,11 +4,18 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
 
 	"github.com/hashicorp/otto/app"
 )
 
+// importPathRegexp matches valid Go import paths: slash-separated
+// elements made up of letters, digits, and the punctuation that Go
+// allows, without leading or trailing slashes. An empty import path is
+// allowed to disable the GOPATH setup.
+var importPathRegexp = regexp.MustCompile(`^([A-Za-z0-9_.~+-]+(/[A-Za-z0-9_.~+-]+)*)?$`)
+
 // DetectImportPath will try to automatically determine the import path
 // for the Go application under development.
 //
@@ -56,9 +63,9 @@ func DetectImportPath(ctx *app.Context) (string, error) {
 		}
 	}
 
-	// The directory has to be prefixed with the gopath
-	gopath = filepath.Join(gopath, "src")
-	if !strings.HasPrefix(dir, gopath) {
+	// The directory has to be within the gopath
+	detected, ok := importPathFromDir(gopath, dir, filepath.Separator)
+	if !ok {
 		ctx.Ui.Message(
 			"Warning! It looks like your application is not within your set\n" +
 				"GOPATH. Otto will be unable to automatically setup the proper\n" +
@@ -68,7 +75,6 @@ func DetectImportPath(ctx *app.Context) (string, error) {
 		return "", nil
 	}
 
-	detected := dir[len(gopath)+1:]
 	ctx.Ui.Message(fmt.Sprintf(
 		"Detected import path: %s\n\n"+
 			"Otto will use this import path to automatically setup your dev\n"+
@@ -76,3 +82,30 @@ func DetectImportPath(ctx *app.Context) (string, error) {
 		detected))
 	return detected, nil
 }
+
+// importPathFromDir returns the import path of the directory dir within
+// the "src" folder of gopath, both absolute paths on the host. Import
+// paths always use forward slashes, so on Windows hosts the separators
+// are converted and, since paths there are case-insensitive, the GOPATH
+// is matched without regard to case. The separator of the host is given
+// so this can be tested on any platform. The boolean is false if dir
+// isn't within the GOPATH.
+func importPathFromDir(gopath, dir string, sep byte) (string, bool) {
+	s := string(sep)
+	src := strings.TrimRight(gopath, s) + s + "src" + s
+	if len(dir) <= len(src) {
+		return "", false
+	}
+
+	prefix := dir[:len(src)]
+	if prefix != src && !(sep == '\\' && strings.EqualFold(prefix, src)) {
+		return "", false
+	}
+
+	rel := strings.Trim(dir[len(src):], s)
+	if rel == "" {
+		return "", false
+	}
+
+	return strings.Replace(rel, s, "/", -1), true
+}
@@ -0,0 +1,57 @@
+package goapp
+
+import (
+	"testing"
+)
+
+func TestImportPathFromDir(t *testing.T) {
+	cases := []struct {
+		GOPATH string
+		Dir    string
+		Sep    byte
+		Result string
+		OK     bool
+	}{
+		{"/home/dev/go", "/home/dev/go/src/example.com/foo", '/', "example.com/foo", true},
+		{"/home/dev/go/", "/home/dev/go/src/example.com", '/', "example.com", true},
+		{"/home/dev/go", "/home/dev/go/src", '/', "", false},
+		{"/home/dev/go", "/home/dev/go/srcfoo/example.com", '/', "", false},
+		{"/home/dev/go", "/home/dev/other/example.com", '/', "", false},
+		{"/home/dev/go", "/home/dev/GO/src/example.com", '/', "", false},
+		{`C:\Users\dev\go`, `C:\Users\dev\go\src\github.com\foo\bar`, '\\', "github.com/foo/bar", true},
+		{`C:\Users\dev\go`, `c:\users\dev\go\src\example.com`, '\\', "example.com", true},
+		{`C:\Users\dev\go\`, `C:\Users\dev\go\src\example.com\`, '\\', "example.com", true},
+		{`C:\Users\dev\go`, `C:\Users\dev\code\example.com`, '\\', "", false},
+	}
+
+	for _, tc := range cases {
+		actual, ok := importPathFromDir(tc.GOPATH, tc.Dir, tc.Sep)
+		if actual != tc.Result || ok != tc.OK {
+			t.Fatalf("bad: %q %q: %q %v", tc.GOPATH, tc.Dir, actual, ok)
+		}
+	}
+}
+
+func TestImportPathRegexp(t *testing.T) {
+	cases := []struct {
+		Input string
+		Match bool
+	}{
+		{"github.com/hashicorp/otto", true},
+		{"example.com", true},
+		{"gopkg.in/yaml.v2", true},
+		{"github.com/foo/bar-baz_qux", true},
+		{"", true},
+		{"/github.com/foo", false},
+		{"github.com/foo/", false},
+		{"github.com//foo", false},
+		{"github.com/foo bar", false},
+		{"github.com/foo;rm -rf", false},
+	}
+
+	for _, tc := range cases {
+		if importPathRegexp.MatchString(tc.Input) != tc.Match {
+			t.Fatalf("bad: %q", tc.Input)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package goapp
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// mainPackageRegexp matches the main_package customization: a path
+// relative to the application such as "." or "./cmd/app".
+var mainPackageRegexp = regexp.MustCompile(`^\.(/[\w.-]+)*$`)
+
+// DetectMainPackages finds the packages in the directory of the
+// application that declare "func main()", returned as paths relative to
+// that directory such as "." or "./cmd/app", sorted. Vendored packages,
+// test data, hidden directories and nested Go modules are skipped.
+func DetectMainPackages(dir string) ([]string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, fmt.Errorf(
+			"Error expanding Appfile path to an absolute path: %s", err)
+	}
+
+	var result []string
+	err = filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return nil
+		}
+
+		if p != dir {
+			name := info.Name()
+			if name == "vendor" || name == "testdata" ||
+				strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") {
+				return filepath.SkipDir
+			}
+			if _, err := os.Stat(filepath.Join(p, "go.mod")); err == nil {
+				return filepath.SkipDir
+			}
+		}
+
+		ok, err := isMainPackage(p)
+		if err != nil || !ok {
+			return err
+		}
+
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		pkg := "."
+		if rel != "." {
+			pkg = "./" + filepath.ToSlash(rel)
+		}
+
+		result = append(result, pkg)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(result)
+	return result, nil
+}
+
+// isMainPackage returns true if a Go file in the directory, other than
+// a test, is in package main and declares "func main()". Files that don't
+// parse are skipped, since building reports a better error for them.
+func isMainPackage(dir string) (bool, error) {
+	matches, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		return false, err
+	}
+
+	fset := token.NewFileSet()
+	for _, m := range matches {
+		if strings.HasSuffix(m, "_test.go") {
+			continue
+		}
+
+		f, err := parser.ParseFile(fset, m, nil, 0)
+		if err != nil || f.Name.Name != "main" {
+			continue
+		}
+
+		for _, decl := range f.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if ok && fn.Recv == nil && fn.Name.Name == "main" {
+				return true, nil
+			}
+		}
+	}
+
+	return false, nil
+}
@@ -0,0 +1,49 @@
+package goapp
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestDetectMainPackages(t *testing.T) {
+	cases := []struct {
+		Fixture string
+		Result  []string
+	}{
+		{"basic", []string{"."}},
+		{"main-package", []string{"./cmd/app"}},
+		{"main-packages", []string{"./cmd/a", "./cmd/b"}},
+		{"gopath", nil},
+	}
+
+	for _, tc := range cases {
+		actual, err := DetectMainPackages(filepath.Join("./test-fixtures", tc.Fixture))
+		if err != nil {
+			t.Fatalf("%s: err: %s", tc.Fixture, err)
+		}
+		if !reflect.DeepEqual(actual, tc.Result) {
+			t.Fatalf("%s: bad: %#v", tc.Fixture, actual)
+		}
+	}
+}
+
+func TestMainPackageRegexp(t *testing.T) {
+	cases := []struct {
+		Input string
+		Match bool
+	}{
+		{".", true},
+		{"./cmd/app", true},
+		{"", false},
+		{"cmd/app", false},
+		{"./cmd/", false},
+		{"./cmd app; rm -rf /", false},
+	}
+
+	for _, tc := range cases {
+		if mainPackageRegexp.MatchString(tc.Input) != tc.Match {
+			t.Fatalf("bad: %q", tc.Input)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package goapp
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// workspaceGuestPath is the path in the dev and build environments where
+// the root of a Go workspace is synced.
+const workspaceGuestPath = "/otto-workspace"
+
+// DetectWorkspace looks for a go.work file in the directory of the
+// Appfile and its parents. If one is found, the directory containing it
+// is returned along with the path from that directory to the application.
+// If no workspace is found, the returned root is empty.
+func DetectWorkspace(dir string) (string, string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", "", fmt.Errorf(
+			"Error expanding Appfile path to an absolute path: %s", err)
+	}
+
+	for root := dir; ; {
+		if _, err := os.Stat(filepath.Join(root, "go.work")); err == nil {
+			rel, err := filepath.Rel(root, dir)
+			if err != nil {
+				return "", "", err
+			}
+
+			return root, rel, nil
+		} else if !os.IsNotExist(err) {
+			return "", "", err
+		}
+
+		parent := filepath.Dir(root)
+		if parent == root {
+			return "", "", nil
+		}
+
+		root = parent
+	}
+}
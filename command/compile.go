@@ -7,6 +7,7 @@ import (
 	"path/filepath"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/hashicorp/otto/appfile"
 	"github.com/hashicorp/otto/appfile/detect"
@@ -27,9 +28,17 @@ type CompileCommand struct {
 
 func (c *CompileCommand) Run(args []string) int {
 	var flagAppfile string
+	var flagLocalNoID bool
+	var flagProfile string
+	var flagTags string
+	var flagIDFromGit bool
 	fs := c.FlagSet("compile", FlagSetNone)
 	fs.Usage = func() { c.Ui.Error(c.Help()) }
 	fs.StringVar(&flagAppfile, "appfile", "", "")
+	fs.BoolVar(&flagLocalNoID, "allow-local-deps-without-id", false, "")
+	fs.StringVar(&flagProfile, "profile", "", "")
+	fs.StringVar(&flagTags, "tags", "", "")
+	fs.BoolVar(&flagIDFromGit, "id-from-git", false, "")
 	if err := fs.Parse(args); err != nil {
 		return 1
 	}
@@ -103,12 +112,15 @@ func (c *CompileCommand) Run(args []string) int {
 
 	// Build the appfile compiler
 	var loader appfileLoad.Loader
-	compiler, err := appfile.NewCompiler(&appfile.CompileOpts{
-		Dir: filepath.Join(
-			appPath, DefaultOutputDir, DefaultOutputDirCompiledAppfile),
-		Loader:   loader.Load,
-		Callback: c.compileCallback(ui),
-	})
+	compileOpts := appfile.DefaultCompileOpts(filepath.Join(
+		appPath, DefaultOutputDir, DefaultOutputDirCompiledAppfile))
+	compileOpts.Loader = loader.Load
+	compileOpts.Callback = c.compileCallback(ui)
+	compileOpts.AllowMissingLocalDepID = flagLocalNoID
+	compileOpts.IDFromGitRemote = flagIDFromGit
+	compileOpts.Profile = flagProfile
+	compileOpts.ActiveTags = splitTags(flagTags)
+	compiler, err := appfile.NewCompiler(compileOpts)
 	if err != nil {
 		c.Ui.Error(fmt.Sprintf(
 			"Error initializing Appfile compiler: %s", err))
@@ -220,11 +232,40 @@ Usage: otto [options] [path]
   compilation so that every other Otto operation begins executing much
   more quickly.
 
+Options:
+
+  -allow-local-deps-without-id  Allow dependencies on the local filesystem
+                                that don't have an Otto ID yet. A temporary
+                                ID is used for them. This is only meant for
+                                development.
+
+  -id-from-git                  If the .ottoid file is missing, recover it
+                                from the default branch of the "origin"
+                                Git remote rather than generating a new ID.
+
+  -profile=name                 Apply the profile with the given name in
+                                the Appfile, such as "production".
+
+  -tags=a,b                     Compile the optional dependencies with any
+                                of the given comma-separated tags.
+
 `
 
 	return strings.TrimSpace(helpText)
 }
 
+// splitTags splits the comma-separated value of the -tags flag.
+func splitTags(v string) []string {
+	var result []string
+	for _, tag := range strings.Split(v, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			result = append(result, tag)
+		}
+	}
+
+	return result
+}
+
 func (c *CompileCommand) compileCallback(ui ui.Ui) func(appfile.CompileEvent) {
 	return func(raw appfile.CompileEvent) {
 		switch e := raw.(type) {
@@ -234,6 +275,20 @@ func (c *CompileCommand) compileCallback(ui ui.Ui) func(appfile.CompileEvent) {
 		case *appfile.CompileEventImport:
 			ui.Message(fmt.Sprintf(
 				"Fetching import: %s", e.Source))
+		case *appfile.CompileEventWarning:
+			ui.Message(fmt.Sprintf(
+				"[yellow]Warning: %s", e.Message))
+		case *appfile.CompileEventProgress:
+			if e.Total <= 0 {
+				ui.Message(fmt.Sprintf(
+					"  %s: %d bytes", e.Source, e.Bytes))
+				return
+			}
+
+			ui.Message(fmt.Sprintf(
+				"  %s: %d/%d bytes (%d%%), %s remaining",
+				e.Source, e.Bytes, e.Total, e.Bytes*100/e.Total,
+				e.ETA-e.ETA%time.Second))
 		}
 	}
 }
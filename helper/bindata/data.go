@@ -8,9 +8,11 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/flosch/pongo2"
+	"github.com/hashicorp/otto/helper/schema"
 
 	// Template helpers
 	_ "github.com/hashicorp/otto/helper/pongo2"
@@ -30,6 +32,23 @@ type Data struct {
 	// Context is the template context that is given when rendering
 	Context map[string]interface{}
 
+	// Funcs are additional functions that are made available to templates.
+	// They're called like regular functions: {{ upper(name) }}. If a
+	// function has the same name as a key in Context, the Context value
+	// is used. Use AddFuncs to register functions.
+	Funcs map[string]interface{}
+
+	// Strict, if true, causes rendering to fail if a template outputs a
+	// variable that isn't set in Context, rather than silently rendering
+	// it as empty. This is a best-effort check of the template itself and
+	// doesn't follow extends or includes.
+	Strict bool
+
+	// Sensitive is a list of values, such as tokens or passwords, that
+	// are masked in diagnostic output such as ContextString. They are
+	// still rendered into templates as-is.
+	Sensitive []string
+
 	// SharedExtends is a mapping of share prefixes and files that can be
 	// accessed using {% extends %} in templates. Example:
 	// {% extends "foo:bar/baz.tpl" %} would find the "bar/baz.tpl" in the
@@ -37,6 +56,18 @@ type Data struct {
 	SharedExtends map[string]*Data
 }
 
+// AddFuncs registers additional functions for use in templates. Functions
+// registered later replace ones registered earlier with the same name.
+func (d *Data) AddFuncs(funcs map[string]interface{}) {
+	if d.Funcs == nil {
+		d.Funcs = make(map[string]interface{})
+	}
+
+	for k, v := range funcs {
+		d.Funcs[k] = v
+	}
+}
+
 // CopyDir copies all the assets from the given prefix to the destination
 // directory. It will automatically set file permissions, create folders,
 // etc.
@@ -172,6 +203,13 @@ func (d *Data) renderLowLevel(dst string, src string, prefix string, r io.Reader
 		if err != nil {
 			return err
 		}
+
+		// If we're strict, verify all the variables we use exist
+		if d.Strict {
+			if err := d.checkStrict(src, buf.String()); err != nil {
+				return err
+			}
+		}
 	}
 
 	// Make the directory containing the final path.
@@ -193,5 +231,37 @@ func (d *Data) renderLowLevel(dst string, src string, prefix string, r io.Reader
 		return err
 	}
 
-	return tpl.ExecuteWriter(d.Context, f)
+	return tpl.ExecuteWriter(d.renderContext(), f)
+}
+
+// renderContext builds the context that templates are executed with,
+// which is the Context along with any registered Funcs.
+func (d *Data) renderContext() pongo2.Context {
+	result := make(pongo2.Context, len(d.Context)+len(d.Funcs))
+	for k, v := range d.Funcs {
+		result[k] = v
+	}
+	for k, v := range d.Context {
+		result[k] = v
+	}
+
+	return result
+}
+
+// ContextString returns a human readable dump of the Context, sorted by
+// key, for use in logs and other diagnostic output. Any Sensitive values
+// are masked.
+func (d *Data) ContextString() string {
+	keys := make([]string, 0, len(d.Context))
+	for k := range d.Context {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var buf bytes.Buffer
+	for _, k := range keys {
+		fmt.Fprintf(&buf, "%s = %#v\n", k, d.Context[k])
+	}
+
+	return schema.Redact(buf.String(), d.Sensitive)
 }
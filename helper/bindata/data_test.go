@@ -8,6 +8,7 @@ import (
 	"os"
 	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/hashicorp/otto/helper/bindata/test-pkg"
@@ -44,6 +45,77 @@ func TestDataCopyDir(t *testing.T) {
 	}
 }
 
+func TestDataRenderString_funcs(t *testing.T) {
+	d := testData()
+	d.AddFuncs(map[string]interface{}{
+		"upper": strings.ToUpper,
+		"value": func() string { return "shadowed" },
+	})
+
+	actual, err := d.RenderString("{{ upper(value) }}")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if actual != "FOO" {
+		t.Fatalf("bad: %s", actual)
+	}
+}
+
+func TestDataContextString(t *testing.T) {
+	d := &Data{
+		Context: map[string]interface{}{
+			"name":  "foo",
+			"token": "secret",
+		},
+		Sensitive: []string{"secret"},
+	}
+
+	actual := d.ContextString()
+	expected := "name = \"foo\"\ntoken = \"<sensitive>\"\n"
+	if actual != expected {
+		t.Fatalf("bad: %q", actual)
+	}
+
+	// The value is still rendered as-is
+	rendered, err := d.RenderString("{{ token }}")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if rendered != "secret" {
+		t.Fatalf("bad: %s", rendered)
+	}
+}
+
+func TestDataRenderString_strict(t *testing.T) {
+	cases := []struct {
+		Input string
+		Err   string
+	}{
+		{"{{ value }}", ""},
+		{"{{ missing }}", `"missing"`},
+		{"{{ nested.key }}", ""},
+		{"{{ nested.missing }}", `"nested.missing"`},
+		{`{{ missing|default:"foo" }}`, ""},
+		{"{% for item in list %}{{ item }}{% endfor %}", ""},
+		{"{% if missing %}yes{% endif %}", ""},
+	}
+
+	for _, tc := range cases {
+		d := testData()
+		d.Strict = true
+		d.Context["nested"] = map[string]string{"key": "value"}
+		d.Context["list"] = []string{"a", "b"}
+
+		_, err := d.RenderString(tc.Input)
+		if (err != nil) != (tc.Err != "") {
+			t.Fatalf("bad: %s\n\n%s", tc.Input, err)
+		}
+		if err != nil && !strings.Contains(err.Error(), tc.Err) {
+			t.Fatalf("bad: %s\n\n%s", tc.Input, err)
+		}
+	}
+}
+
 func testData() *Data {
 	return &Data{
 		Asset:    Asset,
@@ -0,0 +1,97 @@
+package bindata
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/hashicorp/go-multierror"
+)
+
+var (
+	// strictVarRe matches simple variable output tags such as
+	// "{{ name }}", "{{ path.working }}" or "{{ name|upper }}". Anything
+	// more complex (function calls, literals, operators) is not checked.
+	strictVarRe = regexp.MustCompile(
+		`{{-?\s*([A-Za-z_][A-Za-z0-9_]*(?:\.[A-Za-z0-9_]+)*)\s*(\|[^}]*)?-?}}`)
+
+	// strictDefineRe matches tags that define new variables within
+	// a template, such as for loops, "with" and "set".
+	strictDefineRe = regexp.MustCompile(
+		`{%-?\s*(?:for\s+([A-Za-z_][A-Za-z0-9_]*)(?:\s*,\s*([A-Za-z_][A-Za-z0-9_]*))?\s+in` +
+			`|with\s+([A-Za-z_][A-Za-z0-9_]*)\s*=` +
+			`|set\s+([A-Za-z_][A-Za-z0-9_]*)\s*=)`)
+)
+
+// checkStrict verifies that every variable the template outputs exists
+// in the render context. This is a best-effort static check of the
+// template source: only simple "{{ a.b.c }}" tags are checked, variables
+// defined by the template itself are skipped, and so is any variable
+// piped through the "default" filter.
+func (d *Data) checkStrict(name, tpl string) error {
+	ctx := d.renderContext()
+
+	// Find all the variables the template defines itself
+	defined := make(map[string]struct{})
+	for _, m := range strictDefineRe.FindAllStringSubmatch(tpl, -1) {
+		for _, v := range m[1:] {
+			if v != "" {
+				defined[v] = struct{}{}
+			}
+		}
+	}
+
+	var result error
+	seen := make(map[string]struct{})
+	for _, m := range strictVarRe.FindAllStringSubmatch(tpl, -1) {
+		key, filters := m[1], m[2]
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = struct{}{}
+
+		if strings.Contains(filters, "default") {
+			continue
+		}
+
+		parts := strings.Split(key, ".")
+		if _, ok := defined[parts[0]]; ok {
+			continue
+		}
+
+		if !strictLookup(ctx, parts) {
+			result = multierror.Append(result, fmt.Errorf(
+				"%s: template references missing key %q", name, key))
+		}
+	}
+
+	return result
+}
+
+// strictLookup returns false if the given path is definitely missing
+// from the context. If the path goes through something that isn't a map
+// with string keys, we can't know statically and assume it exists.
+func strictLookup(ctx map[string]interface{}, parts []string) bool {
+	current := reflect.ValueOf(ctx)
+	for _, part := range parts {
+		for current.Kind() == reflect.Interface || current.Kind() == reflect.Ptr {
+			if current.IsNil() {
+				return false
+			}
+
+			current = current.Elem()
+		}
+
+		if current.Kind() != reflect.Map || current.Type().Key().Kind() != reflect.String {
+			return true
+		}
+
+		current = current.MapIndex(reflect.ValueOf(part).Convert(current.Type().Key()))
+		if !current.IsValid() {
+			return false
+		}
+	}
+
+	return true
+}
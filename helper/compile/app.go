@@ -76,12 +76,15 @@ func App(opts *AppOptions) (*app.CompileResult, error) {
 	}
 
 	// Process the customizations!
-	err := processCustomizations(
+	sensitive, err := processCustomizations(
 		ctx.Appfile.Customization,
-		opts.Customization)
+		opts.Customization,
+		&ctx.Shared)
 	if err != nil {
 		return nil, err
 	}
+	opts.Bindata.Sensitive = append(opts.Bindata.Sensitive, sensitive...)
+	log.Printf("[DEBUG] compile: template context:\n%s", opts.Bindata.ContextString())
 
 	// Upload the ScriptPacks
 	if err := opts.compileScriptPacks(); err != nil {
@@ -146,6 +149,7 @@ func appFoundations(opts *AppOptions) error {
 	for k, v := range opts.Bindata.Context {
 		data.Context[k] = v
 	}
+	data.Funcs = opts.Bindata.Funcs
 
 	// Go through each foundation and setup the layers
 	log.Printf("[INFO] compile: looking for foundation layers for dev")
@@ -2,7 +2,10 @@ package compile
 
 import (
 	"fmt"
+	"io/ioutil"
+	"path/filepath"
 	"reflect"
+	"strings"
 	"sync"
 
 	"github.com/hashicorp/otto/otto"
@@ -54,3 +57,40 @@ func (s *AppTestStepContext) Run(c *otto.Core) error {
 
 	return nil
 }
+
+// AppTestStepFile is an otto.TestStep that tests the contents of a file
+// written by the compilation. Path is relative to the compilation
+// directory.
+type AppTestStepFile struct {
+	Path        string
+	Contains    []string
+	NotContains []string
+}
+
+func (s *AppTestStepFile) Run(c *otto.Core) error {
+	testLock.RLock()
+	defer testLock.RUnlock()
+
+	if testAppOpts == nil {
+		return fmt.Errorf("no context")
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(testAppOpts.Ctx.Dir, s.Path))
+	if err != nil {
+		return err
+	}
+
+	contents := string(data)
+	for _, v := range s.Contains {
+		if !strings.Contains(contents, v) {
+			return fmt.Errorf("'%s' should contain %q:\n\n%s", s.Path, v, contents)
+		}
+	}
+	for _, v := range s.NotContains {
+		if strings.Contains(contents, v) {
+			return fmt.Errorf("'%s' shouldn't contain %q:\n\n%s", s.Path, v, contents)
+		}
+	}
+
+	return nil
+}
@@ -4,7 +4,9 @@ import (
 	"fmt"
 
 	"github.com/hashicorp/otto/appfile"
+	"github.com/hashicorp/otto/context"
 	"github.com/hashicorp/otto/helper/schema"
+	"github.com/hashicorp/otto/ui"
 )
 
 // CustomizationFunc is the callback called for customizations.
@@ -20,6 +22,12 @@ type Customization struct {
 	// This is guaranteed to be called even if there is no customization set
 	// to allow you to setup defaults.
 	Callback CustomizationFunc
+
+	// Strict, if true, makes it an error to set customization fields that
+	// aren't in the Schema. Since all the customizations in the Appfile
+	// are given to every component, this should only be set if no other
+	// component is expected to be customized.
+	Strict bool
 }
 
 // Merge will merge this customization with the other and return a new
@@ -27,6 +35,7 @@ type Customization struct {
 func (c *Customization) Merge(other *Customization) *Customization {
 	result := &Customization{
 		Schema: make(map[string]*schema.FieldSchema),
+		Strict: c.Strict || other.Strict,
 	}
 
 	// Merge the schemas
@@ -49,10 +58,17 @@ func (c *Customization) Merge(other *Customization) *Customization {
 	return result
 }
 
-func processCustomizations(cs *appfile.CustomizationSet, c *Customization) error {
+// processCustomizations validates the customizations against the schema
+// and calls the callback. If any sensitive fields are set, the Ui of the
+// shared context is replaced with one that masks their values and the
+// values are returned so that they can be masked elsewhere.
+func processCustomizations(
+	cs *appfile.CustomizationSet,
+	c *Customization,
+	shared *context.Shared) ([]string, error) {
 	// If we have no customization we do nothing
 	if c == nil {
-		return nil
+		return nil, nil
 	}
 
 	// We process customizations below by going through multiple
@@ -77,17 +93,52 @@ func processCustomizations(cs *appfile.CustomizationSet, c *Customization) error
 	data := &schema.FieldData{
 		Raw:    rawData,
 		Schema: c.Schema,
+		Strict: c.Strict,
 	}
 
 	// Validate it. If it is valid, then we're fine.
 	if err := data.Validate(); err != nil {
-		return fmt.Errorf("Error in customization: %s", err)
+		return nil, fmt.Errorf("Error in customization: %s", err)
+	}
+
+	// Mask any sensitive values in everything shown from here on
+	sensitive := data.SensitiveValues()
+	if len(sensitive) > 0 {
+		shared.Ui = &redactedUi{Ui: shared.Ui, Values: sensitive}
+	}
+
+	// Show any warnings that came out of validation
+	for _, w := range data.Warnings {
+		shared.Ui.Message(fmt.Sprintf("[yellow]Warning in customization: %s", w))
 	}
 
 	// Call the callback
 	if err := c.Callback(data); err != nil {
-		return fmt.Errorf("Error in customization: %s", err)
+		return nil, fmt.Errorf(
+			"Error in customization: %s", schema.Redact(err.Error(), sensitive))
 	}
 
-	return nil
+	return sensitive, nil
+}
+
+// redactedUi is a ui.Ui that masks the given values in all output.
+type redactedUi struct {
+	Ui     ui.Ui
+	Values []string
+}
+
+func (u *redactedUi) Header(msg string) {
+	u.Ui.Header(schema.Redact(msg, u.Values))
+}
+
+func (u *redactedUi) Message(msg string) {
+	u.Ui.Message(schema.Redact(msg, u.Values))
+}
+
+func (u *redactedUi) Raw(msg string) {
+	u.Ui.Raw(schema.Redact(msg, u.Values))
+}
+
+func (u *redactedUi) Input(opts *ui.InputOpts) (string, error) {
+	return u.Ui.Input(opts)
 }
@@ -0,0 +1,86 @@
+package compile
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/otto/appfile"
+	"github.com/hashicorp/otto/context"
+	"github.com/hashicorp/otto/helper/schema"
+	"github.com/hashicorp/otto/ui"
+)
+
+func TestRedactedUi_impl(t *testing.T) {
+	var _ ui.Ui = new(redactedUi)
+}
+
+func TestProcessCustomizations_sensitive(t *testing.T) {
+	mock := new(ui.Mock)
+	shared := &context.Shared{Ui: mock}
+
+	cs := &appfile.CustomizationSet{
+		Raw: []*appfile.Customization{
+			&appfile.Customization{
+				Config: map[string]interface{}{"token": "secret"},
+			},
+		},
+	}
+
+	c := &Customization{
+		Schema: map[string]*schema.FieldSchema{
+			"token": &schema.FieldSchema{
+				Type:      schema.TypeString,
+				Sensitive: true,
+			},
+		},
+		Callback: func(d *schema.FieldData) error {
+			shared.Ui.Message(fmt.Sprintf("token is %s", d.Get("token")))
+			return nil
+		},
+	}
+
+	sensitive, err := processCustomizations(cs, c, shared)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(sensitive) != 1 || sensitive[0] != "secret" {
+		t.Fatalf("bad: %#v", sensitive)
+	}
+
+	output := strings.Join(mock.MessageBuf, "\n")
+	if output != "token is <sensitive>" {
+		t.Fatalf("bad: %s", output)
+	}
+}
+
+func TestProcessCustomizations_strict(t *testing.T) {
+	cs := &appfile.CustomizationSet{
+		Raw: []*appfile.Customization{
+			&appfile.Customization{
+				Config: map[string]interface{}{"go_verison": "1.5"},
+			},
+		},
+	}
+
+	c := &Customization{
+		Schema: map[string]*schema.FieldSchema{
+			"go_version": &schema.FieldSchema{Type: schema.TypeString},
+		},
+		Callback: func(d *schema.FieldData) error { return nil },
+	}
+
+	shared := &context.Shared{Ui: new(ui.Mock)}
+	if _, err := processCustomizations(cs, c, shared); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	c.Strict = true
+	_, err := processCustomizations(cs, c, shared)
+	if err == nil {
+		t.Fatal("should error")
+	}
+	if !strings.Contains(err.Error(), `did you mean "go_version"?`) {
+		t.Fatalf("bad: %s", err)
+	}
+}
@@ -2,6 +2,7 @@ package compile
 
 import (
 	"fmt"
+	"log"
 	"path/filepath"
 	"strings"
 
@@ -59,12 +60,15 @@ func Foundation(opts *FoundationOptions) (*foundation.CompileResult, error) {
 	}
 
 	// Process the customizations!
-	err := processCustomizations(
+	sensitive, err := processCustomizations(
 		ctx.Appfile.Customization,
-		opts.Customization)
+		opts.Customization,
+		&ctx.Shared)
 	if err != nil {
 		return nil, err
 	}
+	data.Sensitive = append(data.Sensitive, sensitive...)
+	log.Printf("[DEBUG] compile: template context:\n%s", data.ContextString())
 
 	// Create the directory list that we'll copy from, and copy those
 	// directly into the compilation directory.
@@ -0,0 +1,92 @@
+package compile
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/hashicorp/go-getter"
+)
+
+// RemoteTemplateFolder is the folder within the compilation directory
+// where templates fetched with RenderURL and RenderURLString are cached.
+const RemoteTemplateFolder = "remote-templates"
+
+// RenderURL fetches the template at the given URL and renders it with
+// the Bindata context to dst. The URL can be anything go-getter supports.
+//
+// The fetched template is cached in the compilation directory so that
+// multiple renders of the same URL during a compilation only fetch it once.
+func (a *AppOptions) RenderURL(dst, src string) error {
+	path, err := a.fetchTemplate(src)
+	if err != nil {
+		return err
+	}
+
+	// RenderReal only treats the file as a template if it ends in ".tpl",
+	// which our cached paths always do.
+	if err := a.Bindata.RenderReal(dst, path); err != nil {
+		return fmt.Errorf("Error rendering template %s: %s", src, err)
+	}
+
+	return nil
+}
+
+// RenderURLString fetches the template at the given URL and renders it
+// with the Bindata context, returning the result. See RenderURL.
+func (a *AppOptions) RenderURLString(src string) (string, error) {
+	path, err := a.fetchTemplate(src)
+	if err != nil {
+		return "", err
+	}
+
+	tpl, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	result, err := a.Bindata.RenderString(string(tpl))
+	if err != nil {
+		return "", fmt.Errorf("Error rendering template %s: %s", src, err)
+	}
+
+	return result, nil
+}
+
+// fetchTemplate downloads the template at src into the remote template
+// cache if it isn't already there and returns the path to it.
+func (a *AppOptions) fetchTemplate(src string) (string, error) {
+	dir := filepath.Join(a.Ctx.Dir, RemoteTemplateFolder)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(dir, fmt.Sprintf("%x.tpl", sha1.Sum([]byte(src))))
+	if _, err := os.Stat(path); err == nil {
+		log.Printf("[DEBUG] compile: remote template cache hit: %s", src)
+		return path, nil
+	}
+
+	// Fetch into a temporary path first. Some getters (such as local
+	// files) only create a symlink, so we copy the contents out to make
+	// sure the cached template doesn't depend on the source.
+	log.Printf("[DEBUG] compile: fetching remote template: %s", src)
+	tmpPath := path + ".download"
+	defer os.Remove(tmpPath)
+	if err := getter.GetFile(tmpPath, src); err != nil {
+		return "", fmt.Errorf("Error fetching template %s: %s", src, err)
+	}
+
+	data, err := ioutil.ReadFile(tmpPath)
+	if err != nil {
+		return "", err
+	}
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		return "", err
+	}
+
+	return path, nil
+}
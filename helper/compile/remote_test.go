@@ -0,0 +1,56 @@
+package compile
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/otto/app"
+	"github.com/hashicorp/otto/helper/bindata"
+)
+
+func TestAppOptionsRenderURL(t *testing.T) {
+	td, err := ioutil.TempDir("", "otto")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+
+	src := filepath.Join(td, "remote.tpl")
+	if err := ioutil.WriteFile(src, []byte("hello {{ name }}"), 0644); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	opts := &AppOptions{
+		Ctx: &app.Context{Dir: filepath.Join(td, "compiled")},
+		Bindata: &bindata.Data{
+			Context: map[string]interface{}{"name": "otto"},
+		},
+	}
+
+	dst := filepath.Join(td, "result")
+	if err := opts.RenderURL(dst, src); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	actual, err := ioutil.ReadFile(dst)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if string(actual) != "hello otto" {
+		t.Fatalf("bad: %s", actual)
+	}
+
+	// Remove the source, the cached copy should still be used
+	if err := os.Remove(src); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	result, err := opts.RenderURLString(src)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if result != "hello otto" {
+		t.Fatalf("bad: %s", result)
+	}
+}
@@ -2,7 +2,12 @@ package schema
 
 import (
 	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
 
+	"github.com/hashicorp/go-multierror"
 	"github.com/mitchellh/mapstructure"
 )
 
@@ -12,54 +17,261 @@ import (
 type FieldData struct {
 	Raw    map[string]interface{}
 	Schema map[string]*FieldSchema
+
+	// Strict, if true, causes Validate to fail if Raw contains any keys
+	// that aren't in the Schema. The error suggests similarly named
+	// fields in the Schema, to help catch typos.
+	Strict bool
+
+	// Warnings is populated by Validate with any warnings that were
+	// generated while validating the data. These should be shown to the
+	// user but don't prevent the data from being used.
+	Warnings []string
 }
 
 // Cycle through raw data and validate conversions in
 // the schema, so we don't get an error/panic later when
 // trying to get data out.  Data not in the schema is not
-// an error at this point, so we don't worry about it.
+// an error at this point unless Strict is set.
+//
+// Once conversions are validated, cross-field constraints such as
+// ConflictsWith and RequiredWith are checked, values are checked against
+// any AllowedValues and ValidateRegexp, and any ValidateFunc set on the
+// schema is called.
+// Errors from those are accumulated and returned together and warnings
+// are stored in Warnings.
 func (d *FieldData) Validate() error {
-	for field, value := range d.Raw {
+	d.Warnings = nil
+
+	// Go through the fields in a stable order so that warnings and
+	// errors are always reported the same way.
+	fields := make([]string, 0, len(d.Raw))
+	for field := range d.Raw {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	var result error
+	for _, field := range fields {
+		value := d.Raw[field]
 		schema, ok := d.Schema[field]
 		if !ok {
+			if d.Strict {
+				result = multierror.Append(result, d.unknownField(field))
+			}
+
 			continue
 		}
 
+		// Never show the value of a sensitive field in errors
+		var redact []string
+		if schema.Sensitive {
+			value = SensitiveMask
+			redact = d.SensitiveValues()
+		}
+
 		switch schema.Type {
-		case TypeBool, TypeInt, TypeMap, TypeString:
+		case TypeBool, TypeInt, TypeMap, TypeString, TypeStringList:
 			_, _, err := d.getPrimitive(field, schema)
 			if err != nil {
 				return fmt.Errorf("Error converting input %v for field %s", value, field)
 			}
+		case TypeDuration, TypeList:
+			// Duration and list errors are already scoped to the field
+			// and carry the parse error, so return them as-is.
+			if _, _, err := d.getPrimitive(field, schema); err != nil {
+				return fmt.Errorf("%s", Redact(err.Error(), redact))
+			}
 		default:
 			return fmt.Errorf("unknown field type %s for field %s",
 				schema.Type, field)
 		}
+
+		if schema.Deprecated != "" {
+			d.Warnings = append(d.Warnings, fmt.Sprintf(
+				"%s is deprecated: %s", field, schema.Deprecated))
+		}
+
+		for _, other := range schema.ConflictsWith {
+			if _, ok := d.Raw[other]; ok {
+				result = multierror.Append(result, fmt.Errorf(
+					"%s: conflicts with %s", field, other))
+			}
+		}
+
+		for _, other := range schema.RequiredWith {
+			if _, ok := d.Raw[other]; !ok {
+				result = multierror.Append(result, fmt.Errorf(
+					"%s: requires %s to be set", field, other))
+			}
+		}
+
+		if len(schema.AllowedValues) > 0 {
+			v, _, _ := d.getPrimitive(field, schema)
+			for _, err := range validateAllowed(schema.AllowedValues, v) {
+				result = multierror.Append(result, fmt.Errorf(
+					"%s: %s", field, Redact(err.Error(), redact)))
+			}
+		}
+
+		if schema.ValidateRegexp != nil {
+			v, _, _ := d.getPrimitive(field, schema)
+			for _, err := range validateRegexp(schema.ValidateRegexp, v) {
+				result = multierror.Append(result, fmt.Errorf(
+					"%s: %s", field, Redact(err.Error(), redact)))
+			}
+		}
+
+		if schema.ValidateFunc != nil {
+			v, _, _ := d.getPrimitive(field, schema)
+			ws, es := schema.ValidateFunc(v)
+			for _, w := range ws {
+				d.Warnings = append(d.Warnings, fmt.Sprintf(
+					"%s: %s", field, Redact(w, redact)))
+			}
+			for _, e := range es {
+				result = multierror.Append(result, fmt.Errorf(
+					"%s: %s", field, Redact(e.Error(), redact)))
+			}
+		}
 	}
 
-	return nil
+	return result
+}
+
+// unknownField returns the error for a field that isn't in the schema,
+// suggesting the closest field if there is one.
+func (d *FieldData) unknownField(field string) error {
+	keys := make([]string, 0, len(d.Schema))
+	for k := range d.Schema {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	// Only suggest fields that are reasonably close, relative to the
+	// length of the field name.
+	var suggestion string
+	best := len(field)/3 + 1
+	for _, k := range keys {
+		if dist := levenshtein(field, k); dist < best {
+			best = dist
+			suggestion = k
+		}
+	}
+
+	if suggestion != "" {
+		return fmt.Errorf("%s: unknown field, did you mean %q?", field, suggestion)
+	}
+
+	return fmt.Errorf("%s: unknown field", field)
+}
+
+// levenshtein returns the edit distance between a and b.
+func levenshtein(a, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+
+			curr[j] = curr[j-1] + 1
+			if v := prev[j] + 1; v < curr[j] {
+				curr[j] = v
+			}
+			if v := prev[j-1] + cost; v < curr[j] {
+				curr[j] = v
+			}
+		}
+
+		prev, curr = curr, prev
+	}
+
+	return prev[len(b)]
+}
+
+// SensitiveValues returns the values of all the set fields that are
+// marked Sensitive, as they would be printed. These can be given to
+// Redact to mask them in output.
+func (d *FieldData) SensitiveValues() []string {
+	set := make(map[string]struct{})
+	for k, schema := range d.Schema {
+		if !schema.Sensitive {
+			continue
+		}
+
+		raw, ok := d.Raw[k]
+		if !ok {
+			continue
+		}
+
+		values := []interface{}{raw}
+		if v, _, err := d.getPrimitive(k, schema); err == nil {
+			values = append(values, v)
+		}
+		for _, v := range values {
+			if str := fmt.Sprintf("%v", v); str != "" {
+				set[str] = struct{}{}
+			}
+		}
+	}
+
+	var result []string
+	for v := range set {
+		result = append(result, v)
+	}
+
+	sort.Strings(result)
+	return result
 }
 
 // Get gets the value for the given field. If the key is an invalid field,
 // FieldData will panic. If you want a safer version of this method, use
 // GetOk. If the field k is not set, the default value (if set) will be
 // returned, otherwise the zero value will be returned.
+//
+// If the default is computed with a DefaultFunc that returns an error,
+// Get will panic. Use GetErr to handle that error instead.
 func (d *FieldData) Get(k string) interface{} {
+	if _, ok := d.Schema[k]; !ok {
+		panic(fmt.Sprintf("field %s not in the schema", k))
+	}
+
+	value, err := d.GetErr(k)
+	if err != nil {
+		panic(fmt.Sprintf("error reading %s: %s", k, err))
+	}
+
+	return value
+}
+
+// GetErr is the same as Get, but returns an error rather than panicking
+// if the field is unknown or the default value can't be computed.
+func (d *FieldData) GetErr(k string) (interface{}, error) {
 	schema, ok := d.Schema[k]
 	if !ok {
-		panic(fmt.Sprintf("field %s not in the schema", k))
+		return nil, fmt.Errorf("unknown field: %s", k)
 	}
 
 	value, ok := d.GetOk(k)
 	if !ok {
-		value = schema.DefaultOrZero()
+		return schema.DefaultValue()
 	}
 
-	return value
+	return value, nil
 }
 
 // GetOk gets the value for the given field. The second return value
 // will be false if the key is invalid or the key is not set at all.
+// This can be used to tell a field that is explicitly set to its zero
+// value apart from one that isn't set, which Get can't do.
 func (d *FieldData) GetOk(k string) (interface{}, bool) {
 	schema, ok := d.Schema[k]
 	if !ok {
@@ -89,7 +301,8 @@ func (d *FieldData) GetOkErr(k string) (interface{}, bool, error) {
 	}
 
 	switch schema.Type {
-	case TypeBool, TypeInt, TypeMap, TypeString:
+	case TypeBool, TypeInt, TypeMap, TypeString, TypeDuration, TypeStringList,
+		TypeList:
 		return d.getPrimitive(k, schema)
 	default:
 		return nil, false,
@@ -132,9 +345,162 @@ func (d *FieldData) getPrimitive(
 			return nil, true, err
 		}
 
+		return result, true, nil
+	case TypeDuration:
+		result, err := parseDuration(raw)
+		if err != nil {
+			return nil, true, fmt.Errorf("field %s: %s", k, err)
+		}
+
+		return result, true, nil
+	case TypeStringList:
+		result, err := parseStringList(raw)
+		if err != nil {
+			return nil, true, err
+		}
+
+		return result, true, nil
+	case TypeList:
+		result, err := parseList(raw, schema.Elem)
+		if err != nil {
+			return nil, true, fmt.Errorf("field %s: %s", k, err)
+		}
+
 		return result, true, nil
 
 	default:
 		panic(fmt.Sprintf("Unknown type: %s", schema.Type))
 	}
 }
+
+// validateAllowed checks that the value of a TypeString or TypeStringList
+// field is one of the allowed values.
+func validateAllowed(allowed []string, v interface{}) []error {
+	var errs []error
+	for _, value := range stringValues(v) {
+		ok := false
+		for _, a := range allowed {
+			if value == a {
+				ok = true
+				break
+			}
+		}
+
+		if !ok {
+			errs = append(errs, fmt.Errorf(
+				"invalid value %q, must be one of: %s",
+				value, strings.Join(allowed, ", ")))
+		}
+	}
+
+	return errs
+}
+
+// validateRegexp checks that the value of a TypeString or TypeStringList
+// field matches the pattern.
+func validateRegexp(re *regexp.Regexp, v interface{}) []error {
+	var errs []error
+	for _, value := range stringValues(v) {
+		if !re.MatchString(value) {
+			errs = append(errs, fmt.Errorf(
+				"%q doesn't match the pattern %s", value, re))
+		}
+	}
+
+	return errs
+}
+
+// stringValues returns the values of a TypeString or TypeStringList
+// field as a list. Values of other types result in an empty list.
+func stringValues(v interface{}) []string {
+	switch v := v.(type) {
+	case string:
+		return []string{v}
+	case []string:
+		return v
+	default:
+		return nil
+	}
+}
+
+// parseDuration converts a raw value into a time.Duration. Strings such
+// as "30s" or "5m" are parsed with time.ParseDuration, a time.Duration is
+// used as-is, and bare integers are treated as a number of seconds.
+func parseDuration(raw interface{}) (time.Duration, error) {
+	switch v := raw.(type) {
+	case time.Duration:
+		return v, nil
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		var seconds int64
+		if err := mapstructure.WeakDecode(v, &seconds); err != nil {
+			return 0, err
+		}
+
+		return time.Duration(seconds) * time.Second, nil
+	}
+
+	var str string
+	if err := mapstructure.WeakDecode(raw, &str); err != nil {
+		return 0, err
+	}
+
+	return time.ParseDuration(str)
+}
+
+// parseStringList converts a raw value to a list of strings. A single
+// value is converted to a list with one element.
+func parseStringList(raw interface{}) ([]string, error) {
+	switch v := raw.(type) {
+	case []string:
+		return v, nil
+	case []interface{}:
+		var result []string
+		if err := mapstructure.WeakDecode(v, &result); err != nil {
+			return nil, err
+		}
+
+		return result, nil
+	}
+
+	var str string
+	if err := mapstructure.WeakDecode(raw, &str); err != nil {
+		return nil, err
+	}
+
+	return []string{str}, nil
+}
+
+// parseList converts a raw value to a list of objects, decoding each
+// element with the given schema. A single object is converted to a list
+// with one element.
+func parseList(
+	raw interface{}, elem map[string]*FieldSchema) ([]map[string]interface{}, error) {
+	var raws []map[string]interface{}
+	if v, ok := raw.(map[string]interface{}); ok {
+		raws = []map[string]interface{}{v}
+	} else if err := mapstructure.WeakDecode(raw, &raws); err != nil {
+		return nil, err
+	}
+
+	result := make([]map[string]interface{}, len(raws))
+	for i, r := range raws {
+		data := &FieldData{Raw: r, Schema: elem}
+		if err := data.Validate(); err != nil {
+			return nil, fmt.Errorf("element %d: %s", i, err)
+		}
+
+		obj := make(map[string]interface{}, len(elem))
+		for k := range elem {
+			v, err := data.GetErr(k)
+			if err != nil {
+				return nil, fmt.Errorf("element %d: %s", i, err)
+			}
+
+			obj[k] = v
+		}
+
+		result[i] = obj
+	}
+
+	return result, nil
+}
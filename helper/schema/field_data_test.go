@@ -1,8 +1,13 @@
 package schema
 
 import (
+	"fmt"
+	"os"
 	"reflect"
+	"regexp"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestFieldDataGet(t *testing.T) {
@@ -91,6 +96,201 @@ func TestFieldDataGet(t *testing.T) {
 				"child": true,
 			},
 		},
+
+		"duration type, string value": {
+			map[string]*FieldSchema{
+				"foo": &FieldSchema{Type: TypeDuration},
+			},
+			map[string]interface{}{
+				"foo": "5m",
+			},
+			"foo",
+			5 * time.Minute,
+		},
+
+		"duration type, unset value": {
+			map[string]*FieldSchema{
+				"foo": &FieldSchema{Type: TypeDuration},
+			},
+			map[string]interface{}{},
+			"foo",
+			time.Duration(0),
+		},
+
+		"duration type, unset value with default": {
+			map[string]*FieldSchema{
+				"foo": &FieldSchema{
+					Type:    TypeDuration,
+					Default: 30 * time.Second,
+				},
+			},
+			map[string]interface{}{},
+			"foo",
+			30 * time.Second,
+		},
+
+		"string type, unset value with default func": {
+			map[string]*FieldSchema{
+				"foo": &FieldSchema{
+					Type:    TypeString,
+					Default: "bar",
+					DefaultFunc: func() (interface{}, error) {
+						return "computed", nil
+					},
+				},
+			},
+			map[string]interface{}{},
+			"foo",
+			"computed",
+		},
+
+		"string type, set value with default func": {
+			map[string]*FieldSchema{
+				"foo": &FieldSchema{
+					Type: TypeString,
+					DefaultFunc: func() (interface{}, error) {
+						return "computed", nil
+					},
+				},
+			},
+			map[string]interface{}{
+				"foo": "bar",
+			},
+			"foo",
+			"bar",
+		},
+
+		"duration type, unset value with string default": {
+			map[string]*FieldSchema{
+				"foo": &FieldSchema{
+					Type:    TypeDuration,
+					Default: "30s",
+				},
+			},
+			map[string]interface{}{},
+			"foo",
+			30 * time.Second,
+		},
+
+		"duration type, duration value": {
+			map[string]*FieldSchema{
+				"foo": &FieldSchema{Type: TypeDuration},
+			},
+			map[string]interface{}{
+				"foo": 30 * time.Second,
+			},
+			"foo",
+			30 * time.Second,
+		},
+
+		"duration type, int value": {
+			map[string]*FieldSchema{
+				"foo": &FieldSchema{Type: TypeDuration},
+			},
+			map[string]interface{}{
+				"foo": 30,
+			},
+			"foo",
+			30 * time.Second,
+		},
+
+		"string list type, list value": {
+			map[string]*FieldSchema{
+				"foo": &FieldSchema{Type: TypeStringList},
+			},
+			map[string]interface{}{
+				"foo": []interface{}{"bar", "baz"},
+			},
+			"foo",
+			[]string{"bar", "baz"},
+		},
+
+		"string list type, string value": {
+			map[string]*FieldSchema{
+				"foo": &FieldSchema{Type: TypeStringList},
+			},
+			map[string]interface{}{
+				"foo": "bar",
+			},
+			"foo",
+			[]string{"bar"},
+		},
+
+		"string list type, unset value": {
+			map[string]*FieldSchema{
+				"foo": &FieldSchema{Type: TypeStringList},
+			},
+			map[string]interface{}{},
+			"foo",
+			[]string{},
+		},
+
+		"string list type, unset value with string default": {
+			map[string]*FieldSchema{
+				"foo": &FieldSchema{
+					Type:    TypeStringList,
+					Default: "bar",
+				},
+			},
+			map[string]interface{}{},
+			"foo",
+			[]string{"bar"},
+		},
+
+		"list type, list value": {
+			map[string]*FieldSchema{
+				"foo": &FieldSchema{
+					Type: TypeList,
+					Elem: map[string]*FieldSchema{
+						"name": &FieldSchema{Type: TypeString},
+						"port": &FieldSchema{Type: TypeInt, Default: 80},
+					},
+				},
+			},
+			map[string]interface{}{
+				"foo": []map[string]interface{}{
+					map[string]interface{}{"name": "web", "port": "8080"},
+					map[string]interface{}{"name": "api"},
+				},
+			},
+			"foo",
+			[]map[string]interface{}{
+				map[string]interface{}{"name": "web", "port": 8080},
+				map[string]interface{}{"name": "api", "port": 80},
+			},
+		},
+
+		"list type, map value": {
+			map[string]*FieldSchema{
+				"foo": &FieldSchema{
+					Type: TypeList,
+					Elem: map[string]*FieldSchema{
+						"name": &FieldSchema{Type: TypeString},
+					},
+				},
+			},
+			map[string]interface{}{
+				"foo": map[string]interface{}{"name": "web"},
+			},
+			"foo",
+			[]map[string]interface{}{
+				map[string]interface{}{"name": "web"},
+			},
+		},
+
+		"list type, unset value": {
+			map[string]*FieldSchema{
+				"foo": &FieldSchema{
+					Type: TypeList,
+					Elem: map[string]*FieldSchema{
+						"name": &FieldSchema{Type: TypeString},
+					},
+				},
+			},
+			map[string]interface{}{},
+			"foo",
+			[]map[string]interface{}{},
+		},
 	}
 
 	for name, tc := range cases {
@@ -107,3 +307,665 @@ func TestFieldDataGet(t *testing.T) {
 		}
 	}
 }
+
+func TestFieldDataValidate(t *testing.T) {
+	cases := map[string]struct {
+		Schema map[string]*FieldSchema
+		Raw    map[string]interface{}
+		Err    bool
+	}{
+		"duration type, valid value": {
+			map[string]*FieldSchema{
+				"foo": &FieldSchema{Type: TypeDuration},
+			},
+			map[string]interface{}{
+				"foo": "30s",
+			},
+			false,
+		},
+
+		"duration type, duration value": {
+			map[string]*FieldSchema{
+				"foo": &FieldSchema{Type: TypeDuration},
+			},
+			map[string]interface{}{
+				"foo": 5 * time.Minute,
+			},
+			false,
+		},
+
+		"duration type, int value": {
+			map[string]*FieldSchema{
+				"foo": &FieldSchema{Type: TypeDuration},
+			},
+			map[string]interface{}{
+				"foo": 30,
+			},
+			false,
+		},
+
+		"duration type, invalid value": {
+			map[string]*FieldSchema{
+				"foo": &FieldSchema{Type: TypeDuration},
+			},
+			map[string]interface{}{
+				"foo": "thirty seconds",
+			},
+			true,
+		},
+
+		"string list type, invalid value": {
+			map[string]*FieldSchema{
+				"foo": &FieldSchema{Type: TypeStringList},
+			},
+			map[string]interface{}{
+				"foo": []interface{}{
+					map[string]interface{}{"bar": "baz"},
+				},
+			},
+			true,
+		},
+
+		"list type, valid value": {
+			map[string]*FieldSchema{
+				"foo": &FieldSchema{
+					Type: TypeList,
+					Elem: map[string]*FieldSchema{
+						"port": &FieldSchema{Type: TypeInt},
+					},
+				},
+			},
+			map[string]interface{}{
+				"foo": []interface{}{
+					map[string]interface{}{"port": 8080},
+				},
+			},
+			false,
+		},
+
+		"list type, invalid element": {
+			map[string]*FieldSchema{
+				"foo": &FieldSchema{
+					Type: TypeList,
+					Elem: map[string]*FieldSchema{
+						"port": &FieldSchema{Type: TypeInt},
+					},
+				},
+			},
+			map[string]interface{}{
+				"foo": []interface{}{
+					map[string]interface{}{"port": "eighty"},
+				},
+			},
+			true,
+		},
+
+		"list type, invalid value": {
+			map[string]*FieldSchema{
+				"foo": &FieldSchema{
+					Type: TypeList,
+					Elem: map[string]*FieldSchema{
+						"port": &FieldSchema{Type: TypeInt},
+					},
+				},
+			},
+			map[string]interface{}{
+				"foo": "bar",
+			},
+			true,
+		},
+	}
+
+	for name, tc := range cases {
+		data := &FieldData{
+			Raw:    tc.Raw,
+			Schema: tc.Schema,
+		}
+
+		err := data.Validate()
+		if (err != nil) != tc.Err {
+			t.Fatalf("bad: %s\n\n%s", name, err)
+		}
+	}
+}
+
+func TestFieldDataGetOkErr_durationFieldScoped(t *testing.T) {
+	data := &FieldData{
+		Raw: map[string]interface{}{
+			"timeout": "thirty seconds",
+		},
+		Schema: map[string]*FieldSchema{
+			"timeout": &FieldSchema{Type: TypeDuration},
+		},
+	}
+
+	_, _, err := data.GetOkErr("timeout")
+	if err == nil {
+		t.Fatal("should error")
+	}
+	if !strings.Contains(err.Error(), "timeout") {
+		t.Fatalf("error should name the field: %s", err)
+	}
+
+	err = data.Validate()
+	if err == nil {
+		t.Fatal("should error")
+	}
+	if !strings.Contains(err.Error(), "timeout") {
+		t.Fatalf("error should name the field: %s", err)
+	}
+}
+
+func TestFieldDataValidate_validateFunc(t *testing.T) {
+	data := &FieldData{
+		Raw: map[string]interface{}{
+			"foo": "bar",
+			"baz": 42,
+		},
+		Schema: map[string]*FieldSchema{
+			"foo": &FieldSchema{
+				Type: TypeString,
+				ValidateFunc: func(v interface{}) ([]string, []error) {
+					return []string{"warning for " + v.(string)}, nil
+				},
+			},
+			"baz": &FieldSchema{
+				Type: TypeInt,
+				ValidateFunc: func(v interface{}) ([]string, []error) {
+					if v.(int) > 10 {
+						return nil, []error{fmt.Errorf("too large")}
+					}
+
+					return nil, nil
+				},
+			},
+			"unset": &FieldSchema{
+				Type: TypeString,
+				ValidateFunc: func(v interface{}) ([]string, []error) {
+					return nil, []error{fmt.Errorf("should not be called")}
+				},
+			},
+		},
+	}
+
+	err := data.Validate()
+	if err == nil {
+		t.Fatal("should error")
+	}
+	if !strings.Contains(err.Error(), "baz: too large") {
+		t.Fatalf("bad: %s", err)
+	}
+	if strings.Contains(err.Error(), "should not be called") {
+		t.Fatalf("bad: %s", err)
+	}
+
+	expected := []string{"foo: warning for bar"}
+	if !reflect.DeepEqual(data.Warnings, expected) {
+		t.Fatalf("bad: %#v", data.Warnings)
+	}
+}
+
+func TestFieldDataValidate_validateRegexp(t *testing.T) {
+	re := regexp.MustCompile(`^[a-z]+$`)
+	schema := map[string]*FieldSchema{
+		"str":  &FieldSchema{Type: TypeString, ValidateRegexp: re},
+		"list": &FieldSchema{Type: TypeStringList, ValidateRegexp: re},
+	}
+
+	cases := map[string]struct {
+		Raw map[string]interface{}
+		Err string
+	}{
+		"unset": {
+			map[string]interface{}{},
+			"",
+		},
+
+		"string match": {
+			map[string]interface{}{"str": "foo"},
+			"",
+		},
+
+		"string mismatch": {
+			map[string]interface{}{"str": "Foo"},
+			`str: "Foo" doesn't match the pattern ^[a-z]+$`,
+		},
+
+		"list match": {
+			map[string]interface{}{"list": []interface{}{"foo", "bar"}},
+			"",
+		},
+
+		"list mismatch": {
+			map[string]interface{}{"list": []interface{}{"foo", "b4r"}},
+			`list: "b4r" doesn't match the pattern ^[a-z]+$`,
+		},
+	}
+
+	for name, tc := range cases {
+		data := &FieldData{Raw: tc.Raw, Schema: schema}
+		err := data.Validate()
+		if (err != nil) != (tc.Err != "") {
+			t.Fatalf("bad: %s\n\n%s", name, err)
+		}
+		if err != nil && !strings.Contains(err.Error(), tc.Err) {
+			t.Fatalf("bad: %s\n\n%s", name, err)
+		}
+	}
+}
+
+func TestFieldDataValidate_allowedValues(t *testing.T) {
+	schema := map[string]*FieldSchema{
+		"str": &FieldSchema{
+			Type:          TypeString,
+			AllowedValues: []string{"linux", "darwin"},
+		},
+		"list": &FieldSchema{
+			Type:          TypeStringList,
+			AllowedValues: []string{"amd64", "arm64"},
+		},
+	}
+
+	cases := map[string]struct {
+		Raw map[string]interface{}
+		Err string
+	}{
+		"unset": {
+			map[string]interface{}{},
+			"",
+		},
+
+		"string allowed": {
+			map[string]interface{}{"str": "linux"},
+			"",
+		},
+
+		"string not allowed": {
+			map[string]interface{}{"str": "windows"},
+			`str: invalid value "windows", must be one of: linux, darwin`,
+		},
+
+		"list allowed": {
+			map[string]interface{}{"list": []interface{}{"amd64", "arm64"}},
+			"",
+		},
+
+		"list not allowed": {
+			map[string]interface{}{"list": []interface{}{"amd64", "386"}},
+			`list: invalid value "386", must be one of: amd64, arm64`,
+		},
+	}
+
+	for name, tc := range cases {
+		data := &FieldData{Raw: tc.Raw, Schema: schema}
+		err := data.Validate()
+		if (err != nil) != (tc.Err != "") {
+			t.Fatalf("bad: %s\n\n%s", name, err)
+		}
+		if err != nil && !strings.Contains(err.Error(), tc.Err) {
+			t.Fatalf("bad: %s\n\n%s", name, err)
+		}
+	}
+}
+
+func TestFieldDataValidate_conflictsWith(t *testing.T) {
+	schema := map[string]*FieldSchema{
+		"foo": &FieldSchema{
+			Type:          TypeString,
+			ConflictsWith: []string{"bar"},
+		},
+		"bar": &FieldSchema{Type: TypeBool},
+	}
+
+	cases := map[string]struct {
+		Raw map[string]interface{}
+		Err bool
+	}{
+		"neither set": {
+			map[string]interface{}{},
+			false,
+		},
+
+		"one set": {
+			map[string]interface{}{"foo": "value"},
+			false,
+		},
+
+		"other set": {
+			map[string]interface{}{"bar": true},
+			false,
+		},
+
+		"both set": {
+			map[string]interface{}{"foo": "value", "bar": true},
+			true,
+		},
+	}
+
+	for name, tc := range cases {
+		data := &FieldData{Raw: tc.Raw, Schema: schema}
+		err := data.Validate()
+		if (err != nil) != tc.Err {
+			t.Fatalf("bad: %s\n\n%s", name, err)
+		}
+		if err != nil && !strings.Contains(err.Error(), "foo: conflicts with bar") {
+			t.Fatalf("bad: %s\n\n%s", name, err)
+		}
+	}
+}
+
+func TestFieldDataValidate_requiredWith(t *testing.T) {
+	schema := map[string]*FieldSchema{
+		"foo": &FieldSchema{
+			Type:         TypeBool,
+			RequiredWith: []string{"bar"},
+		},
+		"bar": &FieldSchema{Type: TypeInt},
+	}
+
+	cases := map[string]struct {
+		Raw map[string]interface{}
+		Err bool
+	}{
+		"neither set": {
+			map[string]interface{}{},
+			false,
+		},
+
+		"one set": {
+			map[string]interface{}{"foo": true},
+			true,
+		},
+
+		"other set": {
+			map[string]interface{}{"bar": 42},
+			false,
+		},
+
+		"both set": {
+			map[string]interface{}{"foo": true, "bar": 42},
+			false,
+		},
+	}
+
+	for name, tc := range cases {
+		data := &FieldData{Raw: tc.Raw, Schema: schema}
+		err := data.Validate()
+		if (err != nil) != tc.Err {
+			t.Fatalf("bad: %s\n\n%s", name, err)
+		}
+		if err != nil && !strings.Contains(err.Error(), "foo: requires bar to be set") {
+			t.Fatalf("bad: %s\n\n%s", name, err)
+		}
+	}
+}
+
+func TestFieldDataValidate_strict(t *testing.T) {
+	schema := map[string]*FieldSchema{
+		"go_version":     &FieldSchema{Type: TypeString},
+		"go_import_path": &FieldSchema{Type: TypeString},
+	}
+
+	cases := map[string]struct {
+		Raw    map[string]interface{}
+		Strict bool
+		Err    string
+	}{
+		"known field": {
+			map[string]interface{}{"go_version": "1.5"},
+			true,
+			"",
+		},
+
+		"unknown field, not strict": {
+			map[string]interface{}{"go_verison": "1.5"},
+			false,
+			"",
+		},
+
+		"typo": {
+			map[string]interface{}{"go_verison": "1.5"},
+			true,
+			`go_verison: unknown field, did you mean "go_version"?`,
+		},
+
+		"unknown field": {
+			map[string]interface{}{"something_else": "1.5"},
+			true,
+			"something_else: unknown field",
+		},
+	}
+
+	for name, tc := range cases {
+		data := &FieldData{Raw: tc.Raw, Schema: schema, Strict: tc.Strict}
+		err := data.Validate()
+		if (err != nil) != (tc.Err != "") {
+			t.Fatalf("bad: %s\n\n%s", name, err)
+		}
+		if err != nil && !strings.Contains(err.Error(), tc.Err) {
+			t.Fatalf("bad: %s\n\n%s", name, err)
+		}
+	}
+}
+
+func TestLevenshtein(t *testing.T) {
+	cases := []struct {
+		A, B string
+		Dist int
+	}{
+		{"", "", 0},
+		{"abc", "", 3},
+		{"", "abc", 3},
+		{"kitten", "sitting", 3},
+		{"go_verison", "go_version", 2},
+	}
+
+	for _, tc := range cases {
+		if actual := levenshtein(tc.A, tc.B); actual != tc.Dist {
+			t.Fatalf("bad: %q %q: %d", tc.A, tc.B, actual)
+		}
+	}
+}
+
+func TestFieldDataGetErr_defaultFunc(t *testing.T) {
+	data := &FieldData{
+		Raw: map[string]interface{}{},
+		Schema: map[string]*FieldSchema{
+			"foo": &FieldSchema{
+				Type: TypeString,
+				DefaultFunc: func() (interface{}, error) {
+					return nil, fmt.Errorf("failed")
+				},
+			},
+		},
+	}
+
+	if _, err := data.GetErr("foo"); err == nil {
+		t.Fatal("should error")
+	}
+	if _, err := data.GetErr("unknown"); err == nil {
+		t.Fatal("should error")
+	}
+}
+
+func TestFieldDataGetErr_defaultEnv(t *testing.T) {
+	const env = "OTTO_SCHEMA_TEST_FOO"
+	defer os.Setenv(env, os.Getenv(env))
+
+	schema := map[string]*FieldSchema{
+		"foo": &FieldSchema{
+			Type:       TypeInt,
+			Default:    1,
+			DefaultEnv: env,
+			ValidateFunc: func(v interface{}) ([]string, []error) {
+				if v.(int) > 10 {
+					return nil, []error{fmt.Errorf("too large")}
+				}
+
+				return nil, nil
+			},
+		},
+	}
+
+	cases := map[string]struct {
+		Env   string
+		Raw   map[string]interface{}
+		Value interface{}
+		Err   bool
+	}{
+		"env unset": {
+			"",
+			map[string]interface{}{},
+			1,
+			false,
+		},
+
+		"env set": {
+			"5",
+			map[string]interface{}{},
+			5,
+			false,
+		},
+
+		"env set, value set": {
+			"5",
+			map[string]interface{}{"foo": 3},
+			3,
+			false,
+		},
+
+		"env invalid": {
+			"five",
+			map[string]interface{}{},
+			nil,
+			true,
+		},
+
+		"env fails validation": {
+			"42",
+			map[string]interface{}{},
+			nil,
+			true,
+		},
+	}
+
+	for name, tc := range cases {
+		os.Setenv(env, tc.Env)
+
+		data := &FieldData{Raw: tc.Raw, Schema: schema}
+		actual, err := data.GetErr("foo")
+		if (err != nil) != tc.Err {
+			t.Fatalf("bad: %s\n\n%s", name, err)
+		}
+		if err != nil {
+			if !strings.Contains(err.Error(), env) {
+				t.Fatalf("error should name the variable: %s\n\n%s", name, err)
+			}
+
+			continue
+		}
+		if !reflect.DeepEqual(actual, tc.Value) {
+			t.Fatalf("bad: %s\n\n%#v", name, actual)
+		}
+	}
+}
+
+func TestFieldDataValidate_sensitive(t *testing.T) {
+	schema := map[string]*FieldSchema{
+		"token": &FieldSchema{
+			Type:      TypeString,
+			Sensitive: true,
+			ValidateFunc: func(v interface{}) ([]string, []error) {
+				return nil, []error{fmt.Errorf("bad token %s", v)}
+			},
+		},
+		"port": &FieldSchema{
+			Type:      TypeInt,
+			Sensitive: true,
+		},
+	}
+
+	data := &FieldData{
+		Raw:    map[string]interface{}{"token": "secret"},
+		Schema: schema,
+	}
+	err := data.Validate()
+	if err == nil {
+		t.Fatal("should error")
+	}
+	if strings.Contains(err.Error(), "secret") {
+		t.Fatalf("bad: %s", err)
+	}
+	if !strings.Contains(err.Error(), "token: bad token <sensitive>") {
+		t.Fatalf("bad: %s", err)
+	}
+	if v := data.Get("token"); v != "secret" {
+		t.Fatalf("bad: %#v", v)
+	}
+
+	data = &FieldData{
+		Raw:    map[string]interface{}{"port": "secret"},
+		Schema: schema,
+	}
+	err = data.Validate()
+	if err == nil {
+		t.Fatal("should error")
+	}
+	if strings.Contains(err.Error(), "secret") {
+		t.Fatalf("bad: %s", err)
+	}
+}
+
+func TestFieldDataSensitiveValues(t *testing.T) {
+	data := &FieldData{
+		Raw: map[string]interface{}{
+			"token":  "secret",
+			"public": "value",
+		},
+		Schema: map[string]*FieldSchema{
+			"token":  &FieldSchema{Type: TypeString, Sensitive: true},
+			"unset":  &FieldSchema{Type: TypeString, Sensitive: true},
+			"public": &FieldSchema{Type: TypeString},
+		},
+	}
+
+	actual := data.SensitiveValues()
+	expected := []string{"secret"}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("bad: %#v", actual)
+	}
+}
+
+func TestFieldDataValidate_deprecated(t *testing.T) {
+	schema := map[string]*FieldSchema{
+		"old": &FieldSchema{
+			Type:       TypeString,
+			Deprecated: "use 'new' instead",
+		},
+		"new": &FieldSchema{Type: TypeString},
+	}
+
+	data := &FieldData{
+		Raw:    map[string]interface{}{"new": "value"},
+		Schema: schema,
+	}
+	if err := data.Validate(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(data.Warnings) > 0 {
+		t.Fatalf("bad: %#v", data.Warnings)
+	}
+
+	data = &FieldData{
+		Raw:    map[string]interface{}{"old": "value"},
+		Schema: schema,
+	}
+	if err := data.Validate(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := []string{"old is deprecated: use 'new' instead"}
+	if !reflect.DeepEqual(data.Warnings, expected) {
+		t.Fatalf("bad: %#v", data.Warnings)
+	}
+}
@@ -1,22 +1,176 @@
 package schema
 
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+)
+
 // FieldSchema is a basic schema to describe the format of a path field.
 type FieldSchema struct {
 	Type        FieldType
 	Default     interface{}
 	Description string
+
+	// Elem is the schema of each element of a TypeList field. Elements
+	// are decoded into a map with a value for every field in Elem, with
+	// defaults applied for fields that aren't set.
+	Elem map[string]*FieldSchema
+
+	// DefaultFunc, if set, is called to compute the default value when
+	// the field isn't set. It is evaluated lazily every time the default
+	// is requested and takes precedence over Default.
+	DefaultFunc func() (interface{}, error)
+
+	// DefaultEnv, if set, is the name of an environment variable whose
+	// value is used when the field isn't set. It takes precedence over
+	// DefaultFunc and Default, and is ignored if the variable is empty.
+	// The value is converted like any other raw value and checked with
+	// ValidateFunc.
+	DefaultEnv string
+
+	// ValidateFunc, if set, is called during FieldData.Validate with the
+	// converted value of the field. It is only called if the field is set.
+	ValidateFunc FieldValidateFunc
+
+	// ValidateRegexp, if set, is a pattern that the value of a TypeString
+	// field, or every element of a TypeStringList field, must match.
+	// Like ValidateFunc, it is only checked if the field is set.
+	ValidateRegexp *regexp.Regexp
+
+	// AllowedValues, if non-empty, is the list of values that a TypeString
+	// field, or every element of a TypeStringList field, can be set to.
+	AllowedValues []string
+
+	// ConflictsWith is a list of other fields that can't be set at the
+	// same time as this field. If this field and any of these are set,
+	// validation will fail.
+	ConflictsWith []string
+
+	// RequiredWith is a list of other fields that must be set whenever
+	// this field is set. If this field is set and any of these aren't,
+	// validation will fail.
+	RequiredWith []string
+
+	// Sensitive marks the value of this field as secret, such as a token
+	// or password. The value is still available as usual, but it is
+	// masked in any diagnostic output such as validation errors.
+	Sensitive bool
+
+	// Deprecated, if non-empty, marks this field as deprecated. If the
+	// field is set, validation will emit a warning containing this
+	// message, which should point to the replacement field.
+	Deprecated string
 }
 
+// FieldValidateFunc is the signature of a function that validates a
+// single field value. It returns a list of warnings and a list of errors.
+// Warnings are reported to the user but don't cause validation to fail.
+type FieldValidateFunc func(interface{}) ([]string, []error)
+
 // DefaultOrZero returns the default value if it is set, or otherwise
 // the zero value of the type.
+//
+// Defaults for TypeDuration are converted the same way as raw values, so
+// a Default of "30s" is returned as a time.Duration. An invalid duration
+// default is a programming error and will panic. Likewise, defaults for
+// TypeStringList and TypeList are converted to a []string and a
+// []map[string]interface{} respectively.
 func (s *FieldSchema) DefaultOrZero() interface{} {
 	if s.Default != nil {
+		switch s.Type {
+		case TypeDuration:
+			result, err := parseDuration(s.Default)
+			if err != nil {
+				panic(fmt.Sprintf("invalid duration default %v: %s", s.Default, err))
+			}
+
+			return result
+		case TypeStringList:
+			result, err := parseStringList(s.Default)
+			if err != nil {
+				panic(fmt.Sprintf("invalid string list default %v: %s", s.Default, err))
+			}
+
+			return result
+		case TypeList:
+			result, err := parseList(s.Default, s.Elem)
+			if err != nil {
+				panic(fmt.Sprintf("invalid list default %v: %s", s.Default, err))
+			}
+
+			return result
+		}
+
 		return s.Default
 	}
 
 	return s.Type.Zero()
 }
 
+// DefaultValue returns the default value for this field. If DefaultEnv
+// is set and the environment variable isn't empty then its value is used.
+// Otherwise, if DefaultFunc is set then it is called to compute the value,
+// or else this behaves like DefaultOrZero.
+func (s *FieldSchema) DefaultValue() (interface{}, error) {
+	if s.DefaultEnv != "" {
+		if v := os.Getenv(s.DefaultEnv); v != "" {
+			return s.envValue(v)
+		}
+	}
+
+	if s.DefaultFunc == nil {
+		return s.DefaultOrZero(), nil
+	}
+
+	result, err := s.DefaultFunc()
+	if err != nil {
+		return nil, err
+	}
+	if result == nil {
+		return s.Type.Zero(), nil
+	}
+	switch s.Type {
+	case TypeDuration:
+		return parseDuration(result)
+	case TypeStringList:
+		return parseStringList(result)
+	case TypeList:
+		return parseList(result, s.Elem)
+	}
+
+	return result, nil
+}
+
+// envValue converts and validates the value of the DefaultEnv variable.
+func (s *FieldSchema) envValue(v string) (interface{}, error) {
+	d := &FieldData{
+		Raw:    map[string]interface{}{s.DefaultEnv: v},
+		Schema: map[string]*FieldSchema{s.DefaultEnv: s},
+	}
+
+	result, _, err := d.getPrimitive(s.DefaultEnv, s)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading %s: %s", s.DefaultEnv, err)
+	}
+
+	if s.ValidateFunc != nil {
+		var errs error
+		_, es := s.ValidateFunc(result)
+		for _, e := range es {
+			errs = multierror.Append(errs, fmt.Errorf("%s: %s", s.DefaultEnv, e))
+		}
+		if errs != nil {
+			return nil, errs
+		}
+	}
+
+	return result, nil
+}
+
 func (t FieldType) Zero() interface{} {
 	switch t {
 	case TypeString:
@@ -27,6 +181,12 @@ func (t FieldType) Zero() interface{} {
 		return false
 	case TypeMap:
 		return map[string]interface{}{}
+	case TypeDuration:
+		return time.Duration(0)
+	case TypeStringList:
+		return []string{}
+	case TypeList:
+		return []map[string]interface{}{}
 	default:
 		panic("unknown type: " + t.String())
 	}
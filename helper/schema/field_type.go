@@ -9,6 +9,16 @@ const (
 	TypeInt
 	TypeBool
 	TypeMap
+	TypeDuration
+
+	// TypeStringList is a list of strings. A single string is also
+	// accepted as a list of one element.
+	TypeStringList
+
+	// TypeList is a list of objects, each of which is decoded with the
+	// schema in FieldSchema.Elem. A single object is also accepted as a
+	// list of one element.
+	TypeList
 )
 
 func (t FieldType) String() string {
@@ -21,6 +31,12 @@ func (t FieldType) String() string {
 		return "bool"
 	case TypeMap:
 		return "map"
+	case TypeDuration:
+		return "duration"
+	case TypeStringList:
+		return "string list"
+	case TypeList:
+		return "list"
 	default:
 		return "unknown type"
 	}
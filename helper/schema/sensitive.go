@@ -0,0 +1,40 @@
+package schema
+
+import (
+	"sort"
+	"strings"
+)
+
+// SensitiveMask is what the values of Sensitive fields are replaced
+// with in output.
+const SensitiveMask = "<sensitive>"
+
+// Redact replaces all occurrences of the given values in s with
+// SensitiveMask. Longer values are replaced first so that a value
+// containing another is fully masked.
+func Redact(s string, values []string) string {
+	if len(values) == 0 {
+		return s
+	}
+
+	sorted := make([]string, len(values))
+	copy(sorted, values)
+	sort.Sort(byLength(sorted))
+
+	for _, v := range sorted {
+		if v == "" {
+			continue
+		}
+
+		s = strings.Replace(s, v, SensitiveMask, -1)
+	}
+
+	return s
+}
+
+// byLength sorts strings from longest to shortest.
+type byLength []string
+
+func (s byLength) Len() int           { return len(s) }
+func (s byLength) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byLength) Less(i, j int) bool { return len(s[i]) > len(s[j]) }
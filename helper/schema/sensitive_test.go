@@ -0,0 +1,25 @@
+package schema
+
+import (
+	"testing"
+)
+
+func TestRedact(t *testing.T) {
+	cases := []struct {
+		Input  string
+		Values []string
+		Output string
+	}{
+		{"token is abc", nil, "token is abc"},
+		{"token is abc", []string{"abc"}, "token is <sensitive>"},
+		{"abc and abcdef", []string{"abc", "abcdef"}, "<sensitive> and <sensitive>"},
+		{"nothing here", []string{""}, "nothing here"},
+	}
+
+	for _, tc := range cases {
+		actual := Redact(tc.Input, tc.Values)
+		if actual != tc.Output {
+			t.Fatalf("bad: %q\n\n%q", tc.Input, actual)
+		}
+	}
+}
@@ -50,9 +50,7 @@ func TestAppfile(t TestT, path string) *appfile.Compiled {
 	}
 
 	// Compile it!
-	compiler, err := appfile.NewCompiler(&appfile.CompileOpts{
-		Dir: td,
-	})
+	compiler, err := appfile.NewCompiler(appfile.DefaultCompileOpts(td))
 	if err != nil {
 		t.Fatal("err: ", err)
 	}